@@ -42,4 +42,63 @@ const (
 const LUA_MINSTACK = 20                         //LUA调用栈最小容量
 const LUAI_MAXSTACK = 1000000                   //LUA调用栈最大容量（可正负）
 const LUA_REGISTRYINDEX = -LUAI_MAXSTACK - 1000 //负有效索引减1000就是注册表的伪索引
+const LUA_RIDX_MAINTHREAD int64 = 1             //主线程在注册表里的索引
 const LUA_RIDX_GLOBALS int64 = 2                //全局环境在注册表里的索引
+
+const LUA_LOADED_TABLE = "_LOADED"       //注册表里记录已加载模块的表（也就是package.loaded）
+const LUA_PRELOAD_TABLE = "_PRELOAD"     //注册表里记录模块预加载函数的表（也就是package.preload）
+const LUA_GOMODULES_TABLE = "_GOMODULES" //注册表里记录宿主注册的Go模块的表（见RegisterModule()）
+
+const LUA_MULTRET = -1 //Call()和PCall()的nResults参数为LUA_MULTRET时，被调函数的返回值会全部留在栈顶
+
+//函数调用（以及加载chunk）的状态码
+const (
+	LUA_OK           = iota //成功
+	LUA_YIELD               //协程挂起
+	LUA_ERRRUN              //运行时错误
+	LUA_ERRSYNTAX           //加载chunk时的格式（语法）错误
+	LUA_ERRMEM              //内存分配错误
+	LUA_ERRGCMM             //执行__gc元方法时出错
+	LUA_ERRERR              //执行消息处理函数时出错
+	LUA_ERRFILE             //打开或者读取文件出错
+	LUA_ERRINTERRUPT        //执行被宿主中断（Context被取消、超时或者指令预算用完，见SetContext()）
+	LUA_ERREXIT             //脚本调用了os.exit()，宿主钩子返回之后执行被终止，错误对象是退出码（见Exit()）
+)
+
+//引用系统（Ref/Unref）的特殊引用值
+const (
+	LUA_NOREF  = -2 //不引用任何值，对它调用Unref()或者RawGetI()都是安全的
+	LUA_REFNIL = -1 //对nil值的引用，RawGetI()得到的也是nil
+)
+
+//钩子事件（见SetHook()）
+const (
+	LUA_HOOKCALL     = iota //调用函数（进入被调函数之后，执行第一条指令之前）
+	LUA_HOOKRET             //函数返回（离开被调函数之前）
+	LUA_HOOKLINE            //开始执行新的一行代码
+	LUA_HOOKCOUNT           //每执行count条指令
+	LUA_HOOKTAILCALL        //尾调用函数（被调函数取代了主调函数，之后只有被调函数返回时才会触发返回事件），与调用事件一样由LUA_MASKCALL开启
+)
+
+//钩子事件掩码，SetHook()的mask参数是它们的组合
+const (
+	LUA_MASKCALL  = 1 << LUA_HOOKCALL
+	LUA_MASKRET   = 1 << LUA_HOOKRET
+	LUA_MASKLINE  = 1 << LUA_HOOKLINE
+	LUA_MASKCOUNT = 1 << LUA_HOOKCOUNT
+)
+
+//垃圾回收器的操作（见GC()）
+const (
+	LUA_GCSTOP       = 0  //停止自动回收
+	LUA_GCRESTART    = 1  //重新开始自动回收
+	LUA_GCCOLLECT    = 2  //执行一次完整的回收
+	LUA_GCCOUNT      = 3  //返回内存占用（以KB为单位）
+	LUA_GCCOUNTB     = 4  //返回内存占用除以1024的余数（以字节为单位）
+	LUA_GCSTEP       = 5  //执行一步回收
+	LUA_GCSETPAUSE   = 6  //设置回收间歇率，返回旧值
+	LUA_GCSETSTEPMUL = 7  //设置回收步进倍率，返回旧值
+	LUA_GCISRUNNING  = 9  //自动回收是否开启
+	LUA_GCGEN        = 10 //切换到分代模式，返回之前的模式
+	LUA_GCINC        = 11 //切换到增量模式，返回之前的模式
+)
@@ -0,0 +1,78 @@
+package api
+
+// 注册Go函数时使用的函数表，键是函数名，值是Go函数
+type FuncReg map[string]GoFunction
+
+/*
+ *沙箱配置（见NewSandboxEnv()），键是库名（基础库为"_G"），值是允许使用的字段名
+ *值为nil表示整个库都可以使用，对于基础库来说是除了其他库（表）以外的全部函数
+ */
+type SandboxProfile map[string][]string
+
+/*
+ *辅助库（相当于官方实现里的lauxlib），完全建立在基础API之上，
+ *用来简化Go函数（比如标准库）的编写：参数检查、错误报告、加载chunk、注册函数等
+ *按照约定，参数arg表示Go函数的第几个参数（从1开始），也就是栈索引
+ */
+type AuxLib interface {
+	/* 错误报告 */
+
+	Where(level int)                              //把第level层调用帧当前执行到的位置（"chunkname:currentline: "）推入栈顶，通常用作错误信息的前缀
+	Error2(fmt string, a ...interface{}) int      //格式化错误信息，加上位置前缀后抛出错误（相当于luaL_error），该方法不会返回
+	ArgError(arg int, extraMsg string) int        //抛出"bad argument #arg to 'f' (extraMsg)"错误，该方法不会返回
+	TypeError(arg int, tname string) int          //抛出"bad argument #arg to 'f' (tname expected, got xxx)"错误，该方法不会返回
+	ArgCheck(cond bool, arg int, extraMsg string) //如果cond为false，则抛出参数错误
+
+	/* 参数检查 */
+
+	CheckStack2(sz int, msg string)       //确保栈里还能容纳sz个值，否则抛出"stack overflow (msg)"错误
+	CheckAny(arg int)                     //确保第arg个参数存在（可以是nil）
+	CheckType(arg int, t LuaType)         //确保第arg个参数是指定类型
+	CheckTable(arg int)                   //确保第arg个参数是表
+	CheckInteger(arg int) int64           //确保第arg个参数是（或者可以转换成）整数，并返回该整数
+	CheckNumber(arg int) float64          //确保第arg个参数是（或者可以转换成）数字，并返回该数字
+	CheckString(arg int) string           //确保第arg个参数是字符串（或者数字），并返回该字符串
+	OptInteger(arg int, d int64) int64    //第arg个参数可选，如果是none或者nil则返回默认值d，否则同CheckInteger()
+	OptNumber(arg int, d float64) float64 //第arg个参数可选，如果是none或者nil则返回默认值d，否则同CheckNumber()
+	OptString(arg int, d string) string   //第arg个参数可选，如果是none或者nil则返回默认值d，否则同CheckString()
+
+	/* 加载函数 */
+
+	LoadString(s string) int                                   //加载字符串形式的chunk，把主函数推入栈顶，返回状态码
+	LoadFile(filename string) int                              //加载文件里的chunk，把主函数推入栈顶，返回状态码
+	LoadFileX(filename, mode string) int                       //同LoadFile()，可以指定加载模式
+	DoString(str string) bool                                  //加载并执行字符串形式的chunk，成功返回true，否则错误对象留在栈顶
+	DoFile(filename string) bool                               //加载并执行文件里的chunk，成功返回true，否则错误对象留在栈顶
+	LoadEnv(chunk []byte, chunkName, mode string, env int) int //同Load()，但是用env处的表作为主函数的_ENV（第一个Upvalue），env为0时使用全局环境
+
+	/* 元表与用户数据 */
+
+	NewMetatable(tname string) bool               //在注册表里创建名为tname的元表并推入栈顶，如果已经存在，则推入已有的元表并返回false
+	TestUdata(arg int, tname string) interface{}  //如果第arg个参数是元表为tname的用户数据，则返回其中的数据，否则返回nil
+	CheckUdata(arg int, tname string) interface{} //确保第arg个参数是元表为tname的用户数据，并返回其中的数据
+	GetMetafield(obj int, e string) LuaType       //把指定索引处的值的元表里的e字段推入栈顶并返回其类型，如果没有元表或者没有该字段，则什么都不推入，返回LUA_TNIL
+	CallMeta(obj int, e string) bool              //如果指定索引处的值有元方法e，则以该值为参数调用它，把结果推入栈顶并返回true
+
+	/* 引用 */
+
+	Ref(t int) int    //弹出栈顶的值，在t处的表里为它分配一个唯一的整数键（引用）并返回，之后可以用RawGetI(t, ref)取回该值
+	Unref(t, ref int) //释放t处的表里的引用ref，被引用的值可以被回收，引用也可以被再次分配
+
+	/* 其他 */
+
+	TypeName2(idx int) string                            //返回指定索引处的值的类型名
+	Len2(idx int) int64                                  //返回指定索引处的值的长度（会触发__len元方法），长度必须是整数
+	ToStringMeta(idx int) string                         //把任意Lua值按照tostring()的规则（考虑__tostring和__name）转换成字符串，推入栈顶并返回
+	FileResult(err error, fname string) int              //把文件操作的结果转换成Lua的惯用返回值：成功时推入true，失败时推入nil、错误信息（"fname: 原因"）和错误码，返回推入的值的数量
+	GetSubTable(idx int, fname string) bool              //确保t[fname]是一个表（t位于idx处）并推入栈顶，如果原来就有，返回true，否则创建一个新表，返回false
+	OpenLibs()                                           //打开全部标准库
+	RequireF(modname string, openf GoFunction, glb bool) //如果模块还没有加载（不在package.loaded里），则调用openf加载它，并把模块推入栈顶，glb为true时同时设置同名全局变量
+	RegisterModule(name string, open GoFunction)         //注册一个Go模块，之后Lua脚本就可以通过require(name)加载它，open的用法与RequireF()的openf相同
+	NewLib(l FuncReg)                                    //创建一个新表，把函数表里的函数全部注册进去，并推入栈顶
+	NewLibTable(l FuncReg)                               //创建一个足以容纳函数表的空表，并推入栈顶
+	SetFuncs(l FuncReg, nup int)                         //把函数表里的函数全部注册到栈顶下面的表里，栈顶的nup个值会成为每个函数的Upvalue（调用结束后被弹出）
+
+	/* 沙箱 */
+
+	NewSandboxEnv(profile SandboxProfile) //按照profile从已经打开的标准库里挑选库和函数，创建一个新的全局环境并推入栈顶，每次创建的环境（包括里面的库表）都是独立的
+}
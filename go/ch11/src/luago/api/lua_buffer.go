@@ -0,0 +1,53 @@
+package api
+
+import "strings"
+
+/*
+ *字符串缓冲区（相当于官方实现里的luaL_Buffer），用于在Go函数里逐步构造大字符串，比如table.concat、gsub、序列化等。
+ *如果反复调用PushString()和Concat()来拼接，每一步都会分配一个新字符串，还可能触发__concat元方法，
+ *而Buffer在内部使用strings.Builder，所有片段最后一次性推入栈顶。
+ *构造过程中Buffer本身不占用Lua栈：AddValue()弹出一个值，PushResult()推入一个值，其他方法都不改变栈的状态
+ *缓冲区里的内容也算Lua解释器的内存占用，追加内容之前会检查内存上限（见LuaState.CheckMemory()）
+ */
+type Buffer struct {
+	ls LuaState
+	sb strings.Builder
+}
+
+// 创建一个与Lua解释器绑定的缓冲区
+func NewBuffer(ls LuaState) *Buffer {
+	return &Buffer{ls: ls}
+}
+
+// 往缓冲区里追加一个字符串
+func (self *Buffer) AddString(s string) {
+	self.ls.CheckMemory(self.sb.Len() + len(s))
+	self.sb.WriteString(s)
+}
+
+// 往缓冲区里追加一个字节
+func (self *Buffer) AddChar(c byte) {
+	self.ls.CheckMemory(self.sb.Len() + 1)
+	self.sb.WriteByte(c)
+}
+
+// 从栈顶弹出一个值（必须是字符串或者数字）追加到缓冲区里
+func (self *Buffer) AddValue() {
+	s, ok := self.ls.ToStringX(-1)
+	if !ok {
+		self.ls.Error2("attempt to add a %s value to a string buffer", self.ls.TypeName2(-1))
+	}
+	self.ls.CheckMemory(self.sb.Len() + len(s))
+	self.sb.WriteString(s)
+	self.ls.Pop(1)
+}
+
+// 返回缓冲区里已经积累的字节数
+func (self *Buffer) Len() int {
+	return self.sb.Len()
+}
+
+// 把缓冲区里的内容作为一个字符串推入栈顶
+func (self *Buffer) PushResult() {
+	self.ls.PushString(self.sb.String())
+}
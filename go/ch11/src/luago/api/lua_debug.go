@@ -0,0 +1,31 @@
+package api
+
+/*
+ *活动记录（相当于官方实现里的lua_Debug），描述调用栈里的某个函数
+ *GetStack()（以及传给钩子的活动记录）只会记下对应的调用帧，其他字段需要用GetInfo()按需填写，what参数里的每个字符对应一组字段：
+ *	'S'：Source、ShortSrc、LineDefined、LastLineDefined、What
+ *	'l'：CurrentLine
+ *	'u'：NUps、NParams、IsVararg
+ *	'n'：Name、NameWhat
+ *	't'：IsTailCall
+ */
+type ActivationRecord struct {
+	Event           int    //触发钩子的事件（LUA_HOOKCALL等），只有传给钩子的活动记录才有意义
+	Name            string //函数名（根据调用指令推断），推断不出来时为空字符串
+	NameWhat        string //函数名的种类："global"、"local"、"method"、"field"、"upvalue"、"metamethod"等，推断不出来时为空字符串
+	What            string //函数类型："Lua"、"main"（主函数）或者"C"（Go函数）
+	Source          string //函数所在chunk的名字，Go函数为"=[C]"
+	ShortSrc        string //便于显示的简短版本的Source
+	CurrentLine     int    //当前正在执行的行号，没有行号信息（比如Go函数）时为-1
+	LineDefined     int    //函数定义开始的行号，Go函数为-1
+	LastLineDefined int    //函数定义结束的行号，Go函数为-1
+	NUps            int    //Upvalue的数量
+	NParams         int    //固定参数的数量（Go函数为0）
+	IsVararg        bool   //是否有变长参数（Go函数总是true）
+	IsTailCall      bool   //函数是不是被尾调用的（这时推断不出函数名）
+
+	CallInfo interface{} //对应的调用帧（仅供解释器内部使用）
+}
+
+// 钩子函数，由SetHook()设置，在指定的事件发生时被调用，ar描述触发事件的函数（Event字段表示事件，行事件还会填写CurrentLine）
+type Hook func(ls LuaState, ar *ActivationRecord)
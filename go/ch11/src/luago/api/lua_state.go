@@ -1,5 +1,10 @@
 package api
 
+import (
+	"context"
+	"io"
+)
+
 /*
  *我们约定，Go函数必须满足这样的签名：接收一个LuaState接口类型的参数，返回一个整数。
  *在Go函数开始执行之前，Lua栈里是传入的参数值，别无它值。
@@ -10,6 +15,7 @@ type GoFunction func(LuaState) int //Go函数类型
 type LuaType = int                 //数据类型
 type ArithOp = int                 //运算类型
 type CompareOp = int               //比较类型
+type ExitHook func(code int)       //os.exit()的宿主钩子，参数是退出码
 
 //对于任何一个Upvalue索引，用注册表伪索引减去该索引就可以得到对应的Upvalue伪索引
 //在Lua虚拟机指令的操作数里，Upvalue索引是从0开始的，但是在转换成Lua栈伪索引时，Upvalue指令是从1开始的
@@ -17,7 +23,13 @@ func LuaUpvalueIndex(i int) int {
 	return LUA_REGISTRYINDEX - i
 }
 
+//Lua API由基础API和辅助库两部分组成，Go函数通过它来操作Lua解释器
 type LuaState interface {
+	BasicAPI
+	AuxLib
+}
+
+type BasicAPI interface {
 	/* api_stack.go：基础栈操作方法 */
 
 	GetTop() int             //栈顶索引，Lua从1开始
@@ -59,6 +71,10 @@ type LuaState interface {
 	PushNumber(n float64) //将数字压入栈顶
 	PushString(s string)  //将字符串压入栈顶
 
+	NewUserdata(data interface{})   //创建一个完全用户数据（包装任意Go值）并推入栈顶，用户数据可以拥有自己的元表
+	IsUserdata(idx int) bool        //判断指定索引处的值是否是用户数据
+	ToUserdata(idx int) interface{} //返回指定索引处的用户数据包装的Go值，如果值不是用户数据，返回nil
+
 	/* api_arith.go & api_compare & api_misc.go：运算操作 */
 
 	Arith(op ArithOp)                          //从栈顶取出操作数，按照一定规则运算，并将结果压回栈顶
@@ -67,6 +83,8 @@ type LuaState interface {
 	Len(idx int)                               //访问指定索引处的值，取其长度，然后推入栈顶
 	RawLen(idx int) uint
 	RawEqual(idx1, idx2 int) bool
+	Next(idx int) bool            //从栈顶弹出一个键，把表（索引由参数指定）里的下一个键值对推入栈顶并返回true，如果已经没有下一个键了，则什么都不推入，返回false
+	StringToNumber(s string) bool //把字符串转换成数字（整数或者浮点数）推入栈顶，如果转换失败，则什么都不推入，返回false
 
 	/* api_get.go：Table访问方法 (Lua -> stack) */
 
@@ -92,6 +110,8 @@ type LuaState interface {
 
 	Load(chunk []byte, chunkName, mode string) int //从资源加载主函数原型并压入栈顶（只有主函数需要从资源加载，子函数都包括在主函数里面了）
 	Call(nArgs, nResults int)                      //对Lua函数进行调用。在执行Call方法之前，必须先把被调函数推入栈顶，然后把参数值依次推入栈顶。方法结束之后，参数值和函数会被弹出栈顶，取而代之的是指定数量的返回值压入栈顶。
+	PCall(nArgs, nResults, msgh int) int           //以保护模式调用函数，用法与Call()相同。如果调用过程中出现错误，则捕获错误，把错误对象（经过msgh处的消息处理函数处理后）推入栈顶，并返回错误码
+	Error() int                                    //以栈顶的值为错误对象抛出错误，该方法不会返回
 
 	/* api_push.go & api_access：Go的转换与返回 */
 
@@ -106,4 +126,68 @@ type LuaState interface {
 	GetGlobal(name string) LuaType      //把全局环境中的某个字段（名字由参数指定）推入栈顶
 	SetGlobal(name string)              //往全局环境里写入一个值，其中字段名由参数指定，值从栈顶弹出
 	Register(name string, f GoFunction) //用于给全局环境注册Go函数值
+
+	/* api_coroutine.go：线程与协程 */
+
+	NewThread() LuaState                 //创建一个新线程（协程）并推入栈顶，新线程与当前线程共享全局状态，但拥有自己独立的调用栈
+	Resume(from LuaState, nArgs int) int //启动或者继续运行协程，from是恢复它的线程，返回LUA_YIELD（挂起）、LUA_OK（运行结束）或者错误码
+	Yield(nResults int) int              //挂起当前协程，把栈顶的nResults个值交给恢复者，再次被恢复后返回恢复者传过来的值的数量
+	Status() int                         //返回线程的状态：LUA_OK、LUA_YIELD或者错误码
+	IsYieldable() bool                   //当前线程能否挂起（主线程不能挂起）
+	HasFrames() bool                     //线程里是否有正在执行的函数，用于区分还没启动（或者已经结束）的协程和正在运行的协程
+	ToThread(idx int) LuaState           //如果指定索引处的值是线程，则返回该线程，否则返回nil
+	PushThread() bool                    //把当前线程推入栈顶，如果当前线程是主线程，返回true
+	XMove(to LuaState, n int)            //从当前线程的栈顶弹出n个值，按照原来的顺序推入另一个线程的栈顶
+	Close()                              //关闭Lua解释器：杀死所有挂起的协程，释放它们的goroutine，宿主用完解释器之后应该调用
+
+	/* api_debug.go：调试信息 */
+
+	Traceback(msg string, level int)                //生成从第level层调用帧（0表示当前函数）开始的调用栈回溯信息，并推入栈顶
+	GetUpvalue(funcIdx, n int) (string, bool)       //把指定索引处的闭包的第n个Upvalue推入栈顶，返回Upvalue的名字，如果Upvalue不存在，则什么都不推入，返回false
+	SetUpvalue(funcIdx, n int) (string, bool)       //从栈顶弹出一个值，赋给指定索引处的闭包的第n个Upvalue，返回Upvalue的名字，如果Upvalue不存在，则不弹出值，返回false
+	UpvalueId(funcIdx, n int) bool                  //把指定索引处的闭包的第n个Upvalue的唯一标识（轻量用户数据）推入栈顶，共享同一个Upvalue的闭包得到的标识相等，如果Upvalue不存在，则什么都不推入，返回false
+	UpvalueJoin(f1, n1, f2, n2 int)                 //让f1处的Lua闭包的第n1个Upvalue引用f2处的Lua闭包的第n2个Upvalue
+	GetStack(level int) (ActivationRecord, bool)    //获取第level层调用帧（0表示当前函数，1表示调用它的函数，依此类推）的活动记录，层数超出调用栈深度时返回false
+	GetInfo(what string, ar *ActivationRecord) bool //按照what填写活动记录的字段；what以'>'开头时描述的是从栈顶弹出的函数；'f'推入函数本身，'L'推入有效行号表；what不合法时返回false
+	GetLocal(ar *ActivationRecord, n int) string    //把活动记录对应的函数的第n个局部变量推入栈顶，返回变量名，不存在时什么都不推入，返回空字符串；n为负数时表示第-n个变长参数（名字是"(*vararg)"）；ar为nil时返回栈顶函数的第n个参数名，不推入任何值
+	SetLocal(ar *ActivationRecord, n int) string    //从栈顶弹出一个值，赋给活动记录对应的函数的第n个局部变量，返回变量名，不存在时不弹出值，返回空字符串
+	SetHook(f Hook, mask, count int)                //设置当前线程的钩子，mask是LUA_MASKCALL等掩码的组合，count是LUA_MASKCOUNT的间隔指令数，f为nil或者mask为0时关闭钩子
+	GetHook() Hook                                  //返回当前线程的钩子
+	GetHookMask() int                               //返回当前线程的钩子掩码
+	GetHookCount() int                              //返回当前线程的钩子间隔指令数
+
+	/* api_trace.go：追踪器 */
+
+	SetTracer(t Tracer) //设置追踪器（整个Lua解释器共用一个，包括全部协程），nil表示关闭追踪
+	GetTracer() Tracer  //返回当前的追踪器，没有设置时返回nil
+
+	/* api_gc.go：垃圾回收 */
+
+	GC(what, arg int) int     //控制垃圾回收器（相当于lua_gc），what是LUA_GCCOLLECT等操作，arg是操作的参数，返回值的含义取决于操作
+	SetMemoryLimit(limit int) //设置内存上限（字节数，按照估算的内存占用计算），超过上限时抛出"not enough memory"错误（LUA_ERRMEM），0表示不限制
+	MemoryLimit() int         //返回内存上限，0表示不限制
+	CheckMemory(n int)        //确保还能再分配n个字节，否则抛出"not enough memory"错误，Go函数应该在分配大块内存（比如构造大字符串）之前调用
+
+	/* api_check.go：API检查模式 */
+
+	SetAPICheck(enable bool) //开启或关闭API检查模式（类似于官方实现的LUA_USE_APICHECK），开启后会校验API索引、栈空间以及Go函数的返回值数量，检查失败时的panic不能被PCall()捕获
+
+	/* api_host.go：与宿主程序的交互 */
+
+	SetExitHook(hook ExitHook) //设置os.exit()的宿主钩子，嵌入Lua的程序可以借此拦截退出请求，nil表示恢复默认行为（直接结束进程）
+	Exit(code int)             //请求以退出码code结束程序：设置了钩子则调用钩子，钩子返回后抛出Lua代码无法捕获的LUA_ERREXIT错误（该方法不会返回），否则直接结束进程
+	SetStdin(r io.Reader)      //替换标准输入（io.stdin、io.read()等使用），nil表示恢复为os.Stdin
+	SetStdout(w io.Writer)     //替换标准输出（print()、io.stdout、io.write()等使用），nil表示恢复为os.Stdout
+	SetStderr(w io.Writer)     //替换标准错误（io.stderr使用），nil表示恢复为os.Stderr
+	Stdin() io.Reader          //返回当前的标准输入
+	Stdout() io.Writer         //返回当前的标准输出
+	Stderr() io.Writer         //返回当前的标准错误
+
+	/* api_interrupt.go：中断执行（超时、取消与指令预算） */
+
+	SetContext(ctx context.Context)       //设置Context，它被取消（或者超时）之后，正在执行的Lua代码会被中断，nil表示不再检查
+	Context() context.Context             //返回当前的Context，没有设置时返回context.Background()，Go函数在执行耗时操作时可以用它
+	SetInstructionLimit(limit int)        //设置指令预算并把指令计数清零，执行的指令数超过预算之后，正在执行的Lua代码会被中断，0表示不限制
+	InstructionCount() int                //返回上一次调用SetInstructionLimit()之后执行过的指令数
+	SetInterruptCatchable(catchable bool) //中断错误能否被Lua代码里的pcall()、coroutine.resume()等捕获，默认可以；不可以时只有宿主（最外层的PCall()）能捕获
 }
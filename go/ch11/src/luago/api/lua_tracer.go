@@ -0,0 +1,14 @@
+package api
+
+/*
+ *追踪器（见SetTracer()）：在虚拟机运行的关键时刻被调用，用来观察解释器的运行过程，比如打印执行过的指令、统计函数调用等
+ *与钩子不同，追踪器是给宿主程序用的，Lua脚本看不到它；追踪器的方法里不应该修改Lua栈，也不应该调用Lua函数
+ *ar描述发生事件的调用帧，可以用GetInfo()查询它的详细信息
+ */
+type Tracer interface {
+	Instruction(ls LuaState, ar *ActivationRecord, pc int, inst uint32) //执行完一条指令，ar描述执行指令的调用帧，pc是该指令在函数原型指令表里的索引（从0开始）
+	PushFrame(ls LuaState, ar *ActivationRecord)                        //推入调用帧（Lua函数或者Go函数开始执行）
+	PopFrame(ls LuaState, ar *ActivationRecord)                         //弹出调用帧（函数返回，或者因为出错而被弹出），此时调用帧还在调用栈里
+	GoCall(ls LuaState, f GoFunction)                                   //调用Go函数（在推入调用帧之前）
+	Metamethod(ls LuaState, event string)                               //分派元方法，event是元方法的名字，比如"__index"
+}
@@ -21,6 +21,10 @@ func main() {
 			test.TestGo(load_lua_data(), os.Args[2])
 		case "6":
 			test.TestMetatable(load_lua_data(), os.Args[2])
+		case "7":
+			test.TestStdlib(load_lua_data(), os.Args[2])
+		case "8":
+			test.TestLib()
 		}
 	}
 }
@@ -1,13 +1,139 @@
 package number
 
-import "strconv"
+import (
+	"math"
+	"strconv"
+	"strings"
+)
 
+/*
+ *按照Lua的规则把字符串解析成整数：允许首尾有空白，可以带正负号，支持十进制和十六进制（0x前缀）
+ *十进制整数溢出时解析失败（交给ParseFloat()按浮点数处理），十六进制整数溢出时则按2^64取模回绕
+ */
 func ParseInteger(str string) (int64, bool) {
-	i, err := strconv.ParseInt(str, 10, 64)
-	return i, err == nil
+	str = strings.TrimSpace(str)
+	neg := false
+	if strings.HasPrefix(str, "-") {
+		neg = true
+		str = str[1:]
+	} else if strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+
+	var i int64
+	if strings.HasPrefix(str, "0x") || strings.HasPrefix(str, "0X") {
+		str = str[2:]
+		if str == "" {
+			return 0, false
+		}
+		for _, c := range str {
+			d, ok := digitValue(c)
+			if !ok || d >= 16 {
+				return 0, false
+			}
+			i = i*16 + int64(d)
+		}
+	} else {
+		if str == "" || strings.IndexFunc(str, func(c rune) bool { return c < '0' || c > '9' }) >= 0 {
+			return 0, false
+		}
+		u, err := strconv.ParseUint(str, 10, 64)
+		if err != nil || !neg && u > math.MaxInt64 || neg && u > 1<<63 {
+			return 0, false
+		}
+		i = int64(u)
+	}
+
+	if neg {
+		i = -i
+	}
+	return i, true
 }
 
+/*
+ *按照Lua的规则把字符串解析成浮点数：允许首尾有空白，支持十进制和十六进制（比如0x1.8p3，指数部分可以省略）
+ *但是不接受"inf"、"nan"这样的写法
+ */
 func ParseFloat(str string) (float64, bool) {
+	str = strings.TrimSpace(str)
+	if strings.ContainsAny(str, "nN_") {
+		return 0, false
+	}
+	if s := strings.TrimPrefix(strings.TrimPrefix(str, "-"), "+"); strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		//Go要求十六进制浮点数必须带p指数，而Lua可以省略
+		if !strings.ContainsAny(str, "pP") {
+			str += "p0"
+		}
+	}
 	f, err := strconv.ParseFloat(str, 64)
-	return f, err == nil
+	if err != nil {
+		//超出范围时strconv会返回±Inf和ErrRange，这和C语言的strtod()行为一致，也算解析成功
+		if ne, ok := err.(*strconv.NumError); !ok || ne.Err != strconv.ErrRange {
+			return 0, false
+		}
+	}
+	return f, true
+}
+
+/*
+ *按照指定进制（2~36）把字符串解析成整数，供tonumber(s, base)使用
+ *字母不区分大小写，允许首尾有空白和正负号，溢出时按2^64取模回绕
+ */
+func ParseIntegerWithBase(str string, base int64) (int64, bool) {
+	str = strings.TrimSpace(str)
+	neg := false
+	if strings.HasPrefix(str, "-") {
+		neg = true
+		str = str[1:]
+	} else if strings.HasPrefix(str, "+") {
+		str = str[1:]
+	}
+	if str == "" {
+		return 0, false
+	}
+
+	var i int64
+	for _, c := range str {
+		d, ok := digitValue(c)
+		if !ok || int64(d) >= base {
+			return 0, false
+		}
+		i = i*base + int64(d)
+	}
+
+	if neg {
+		i = -i
+	}
+	return i, true
+}
+
+// 数字字符（0-9、a-z、A-Z）对应的值
+func digitValue(c rune) (int, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0'), true
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10, true
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10, true
+	default:
+		return 0, false
+	}
+}
+
+// 按照Lua的规则把浮点数转换成字符串：最多保留14位有效数字，如果结果看起来像整数，则加上".0"以示区别
+func FormatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', 14, 64)
+	if strings.Trim(s, "-0123456789") == "" {
+		s += ".0"
+	}
+	return s
 }
@@ -17,12 +17,15 @@
 		ToNumberX(idx int) (float64, bool)
 		ToString(idx int) string
 		ToStringX(idx int) (string, bool)
+		IsUserdata(idx int) bool
+		ToUserdata(idx int) interface{}
 */
 package state
 
 import (
 	"fmt"
 	. "luago/api"
+	"luago/number"
 )
 
 func (self *luaState) RawLen(idx int) uint {
@@ -38,6 +41,10 @@ func (self *luaState) RawLen(idx int) uint {
 }
 
 func (self *luaState) TypeName(tp LuaType) string {
+	return typeName(tp)
+}
+
+func typeName(tp LuaType) string {
 	switch tp {
 	case LUA_TNONE:
 		return "no value"
@@ -141,17 +148,36 @@ func (self *luaState) ToStringX(idx int) (string, bool) {
 	switch x := val.(type) {
 	case string:
 		return x, true
-	case int64, float64:
+	case int64:
 		//如果值是数字，则将值转换为字符串（注意会修改栈）
-		s := fmt.Sprintf("%v", x)
+		s := fmt.Sprintf("%d", x)
 		self.stack.set(idx, s) // 注意这里会修改栈！
 		return s, true
+	case float64:
+		//浮点数按照Lua的规则格式化，比如1.0转换成"1.0"而不是"1"，以便和整数区分
+		s := number.FormatFloat(x)
+		self.stack.set(idx, s)
+		return s, true
 	default:
 		//其他返回空字符串
 		return "", false
 	}
 }
 
+// 判断指定索引处的值是否是用户数据
+func (self *luaState) IsUserdata(idx int) bool {
+	return self.Type(idx) == LUA_TUSERDATA
+}
+
+// 返回指定索引处的用户数据包装的Go值，如果值不是用户数据，返回nil
+func (self *luaState) ToUserdata(idx int) interface{} {
+	val := self.stack.get(idx)
+	if u, ok := val.(*userdata); ok {
+		return u.data
+	}
+	return nil
+}
+
 // 判断指定索引处的值是否可以转换为Go函数
 func (self *luaState) IsGoFunction(idx int) bool {
 	val := self.stack.get(idx)
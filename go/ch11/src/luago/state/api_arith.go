@@ -62,6 +62,12 @@ var operators = []operator{
 func (self *luaState) Arith(op ArithOp) {
 	var a, b luaValue
 
+	if op != LUA_OPUNM && op != LUA_OPBNOT {
+		self.checkElems(2)
+	} else {
+		self.checkElems(1)
+	}
+
 	//不管任何运算，都至少需要一个操作数，即栈顶的数
 	b = self.stack.pop()
 
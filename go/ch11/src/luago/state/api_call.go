@@ -4,13 +4,13 @@ import (
 	"fmt"
 	. "luago/api"
 	"luago/binchunk"
-	"luago/utils"
 	"luago/vm"
+	"strings"
 )
 
 /*
  *如果加载的是二进制chunk，那么只要读取文件、解析主函数原型、实例化为闭包、推入栈顶就可以了；
- *如果加载的是Lua脚本，则要先进行编译（暂时不支持加载lua脚本）
+ *如果加载的是Lua脚本，则要先进行编译（暂时不支持加载lua脚本，需要先用luac预编译）
  *chunk：要加载的chunk数据
  *chunkName：指定chunk的名字，供加载错误或调试时使用
  *mode：加载模式（b、t、bt）
@@ -18,12 +18,35 @@ import (
  *		-t：第一个参数必须是文本chunk数据，否则加载失败
  *		-bt：第一个参数可以是二进制或者文本chunk数据，会根据实际的数据格式进行处理
  *return：
- *		-0：加载成功
+ *		-LUA_OK：加载成功，主函数被推入栈顶
+ *		-LUA_ERRSYNTAX：加载失败，错误信息被推入栈顶
+ *超过内存上限时与其他分配内存的API一样抛出LUA_ERRMEM错误
  */
 func (self *luaState) Load(chunk []byte, chunkName, mode string) int {
-	proto := binchunk.Undump(chunk)
-	//把主函数原型实例化为闭包并推入栈顶。
+	if mode == "" {
+		mode = "bt"
+	}
+
+	//根据签名的第一个字节判断是二进制chunk还是文本chunk，并检查是否符合加载模式
+	isBinary := len(chunk) > 0 && chunk[0] == binchunk.LUA_SIGNATURE[0]
+	if isBinary && !strings.Contains(mode, "b") {
+		return self.loadError("attempt to load a binary chunk (mode is '%s')", mode)
+	}
+	if !isBinary {
+		if !strings.Contains(mode, "t") {
+			return self.loadError("attempt to load a text chunk (mode is '%s')", mode)
+		}
+		return self.loadError("%s: text chunks are not supported (precompile it with luac)", shortSrc(chunkName))
+	}
+
+	proto, err := undump(chunk)
+	if err != nil {
+		return self.loadError("%s: bad binary format (%v)", shortSrc(chunkName), err)
+	}
+	//把主函数原型实例化为闭包并推入栈顶。先记账，这样超过内存上限时栈上不会留下闭包
 	c := newLuaClosure(proto)
+	self.allocate(c.size() + protoSize(proto))
+	self.stack.check(1)
 	self.stack.push(c)
 
 	//Lua函数全部都是闭包，就连编译器为我们生成的主函数也是闭包，捕获了_ENV这个特殊的Upvalue
@@ -35,7 +58,24 @@ func (self *luaState) Load(chunk []byte, chunkName, mode string) int {
 		env := self.registry.get(LUA_RIDX_GLOBALS)
 		c.upvals[0] = &upvalue{&env}
 	}
-	return 0
+	return LUA_OK
+}
+
+// 二进制chunk格式不对时binchunk.Undump()会调用panic()，这里把它转换成error
+func undump(chunk []byte) (proto *binchunk.Prototype, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return binchunk.Undump(chunk), nil
+}
+
+// 把加载错误信息推入栈顶，返回LUA_ERRSYNTAX
+func (self *luaState) loadError(format string, a ...interface{}) int {
+	self.stack.check(1)
+	self.stack.push(fmt.Sprintf(format, a...))
+	return LUA_ERRSYNTAX
 }
 
 /*
@@ -45,6 +85,11 @@ func (self *luaState) Load(chunk []byte, chunkName, mode string) int {
  *nResults：需要的返回值数量（多退少补），如果是-1，则被调函数的返回值会全部留在栈顶。
  */
 func (self *luaState) Call(nArgs, nResults int) {
+	self.checkElems(nArgs + 1)
+	if self.ctx != nil || self.instLimit > 0 {
+		self.checkInterrupt()
+	}
+
 	//此时栈里的状态是，传参在栈顶，接下来是被调函数，因此可以通过栈顶减去参数的数量来获得被调函数的位置
 	val := self.stack.get(-(nArgs + 1))
 
@@ -60,6 +105,7 @@ func (self *luaState) Call(nArgs, nResults int) {
 		if mf := getMetafield(val, "__call", self); mf != nil {
 			//判断该值的__call元方法是否为一个闭包
 			if c, ok = mf.(*closure); ok {
+				self.traceMetamethod("__call")
 				//如果是闭包的话，将该值插入到第一个参数
 				self.stack.push(val)
 				self.Insert(-(nArgs + 2))
@@ -78,7 +124,9 @@ func (self *luaState) Call(nArgs, nResults int) {
 			self.callLuaClosure(nArgs, nResults, c)
 		} else {
 			//否则，证明这是一个Go调用
-			fmt.Printf("go call %s\n", utils.GetFunctionName(c.goFunc))
+			if self.tracer != nil {
+				self.tracer.GoCall(self, c.goFunc)
+			}
 			self.callGoClosure(nArgs, nResults, c)
 		}
 	} else {
@@ -106,10 +154,26 @@ func (self *luaState) callLuaClosure(nArgs, nResults int, c *closure) {
 		newStack.varargs = funcAndArgs[nParams+1:]
 	}
 
+	//主调帧正在执行TAILCALL指令的话，被调函数相当于取代了主调函数（虽然我们并没有真的复用调用帧）
+	if self.stack.isExecuting(vm.OP_TAILCALL) {
+		newStack.isTailCall = true
+		self.stack.tailCalled = true
+	}
+
 	//把新调用帧推入调用栈顶，让它成为当前帧
 	self.pushLuaStack(newStack)
+	if self.hookMask&LUA_MASKCALL != 0 {
+		if newStack.isTailCall {
+			self.callHook(LUA_HOOKTAILCALL, -1)
+		} else {
+			self.callHook(LUA_HOOKCALL, -1)
+		}
+	}
 	//执行被调函数的指令
 	self.runLuaClosure()
+	if self.hookMask&LUA_MASKRET != 0 && !newStack.tailCalled {
+		self.callHook(LUA_HOOKRET, -1)
+	}
 	//指令执行完毕之后，新调用帧的使命就结束了，把它从调用栈顶弹出，这样主调帧就又成了当前帧
 	self.popLuaStack()
 
@@ -125,11 +189,20 @@ func (self *luaState) callLuaClosure(nArgs, nResults int, c *closure) {
 
 func (self *luaState) runLuaClosure() {
 	for {
+		pc := self.PC()
 		inst := vm.Instruction(self.Fetch())
+		if self.hookMask&(LUA_MASKLINE|LUA_MASKCOUNT) != 0 {
+			self.traceExec()
+		}
 		inst.Execute(self)
-
-		utils.PrintInstruction(self.PC(), inst)
-		utils.PrintStack(self)
+		self.instCount++
+		if self.tracer != nil {
+			self.tracer.Instruction(self, &ActivationRecord{CallInfo: self.stack}, pc, uint32(inst))
+		}
+		//向后跳转（循环）时检查是否需要中断执行
+		if self.PC() <= pc && (self.ctx != nil || self.instLimit > 0) {
+			self.checkInterrupt()
+		}
 
 		if inst.Opcode() == vm.OP_RETURN {
 			break
@@ -149,8 +222,18 @@ func (self *luaState) callGoClosure(nArgs, nResults int, c *closure) {
 
 	//把新调用帧推入调用栈顶，让它成为当前帧
 	self.pushLuaStack(newStack)
+	if self.hookMask&LUA_MASKCALL != 0 {
+		self.callHook(LUA_HOOKCALL, -1)
+	}
 	//执行Go函数，r表示Go函数返回参数的个数
 	r := c.goFunc(self)
+	if self.apiCheck {
+		//校验Go函数声明的返回值数量，否则下面的popN()会把主调帧弄乱
+		self.checkResults(c, newStack, r)
+	}
+	if self.hookMask&LUA_MASKRET != 0 {
+		self.callHook(LUA_HOOKRET, -1)
+	}
 	//执行完毕之后把被调帧从调用栈里弹出，这样主调帧就又成了当前帧
 	self.popLuaStack()
 
@@ -161,3 +244,76 @@ func (self *luaState) callGoClosure(nArgs, nResults int, c *closure) {
 		self.stack.pushN(results, nResults)
 	}
 }
+
+/*
+ *以保护模式调用函数，用法与Call()相同。
+ *如果调用过程中没有出现错误，效果和Call()完全一样，返回LUA_OK；
+ *否则捕获错误，把调用栈恢复到调用前的状态（被调函数和参数都被弹出），把错误对象推入栈顶，并返回错误码。
+ *msgh：消息处理函数在栈里的索引，0表示没有。如果有，那么在出错的那一刻（调用帧还没有被弹出时）
+ *会以错误对象为参数调用消息处理函数，用其返回值作为最终的错误对象，这样就可以在消息处理函数里生成调用栈回溯信息
+ */
+func (self *luaState) PCall(nArgs, nResults, msgh int) (status int) {
+	caller := self.stack
+	//被调函数所在位置，出错时栈要恢复到它下面
+	oldTop := caller.top - (nArgs + 1)
+
+	var handler luaValue
+	if msgh != 0 {
+		handler = caller.get(msgh)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(apiCheckError); ok {
+				panic(r) //API检查失败说明宿主代码有bug，不能被Lua代码捕获
+			}
+			err := toLuaError(r)
+			if self.propagateInterrupt(err, caller) {
+				panic(err) //中断错误（以及退出错误）不能被Lua代码捕获，继续传播给宿主
+			}
+			if handler != nil && err.status == LUA_ERRRUN {
+				err = self.callMsgHandler(handler, err)
+			}
+			//把出错时还没来得及弹出的调用帧全部弹出，恢复主调帧的栈顶
+			for self.stack != caller {
+				self.popLuaStack()
+			}
+			for caller.top > oldTop {
+				caller.pop()
+			}
+			caller.check(1)
+			caller.push(err.value)
+			status = err.status
+		}
+	}()
+
+	self.Call(nArgs, nResults)
+	return LUA_OK
+}
+
+// 在出错的调用帧上调用消息处理函数，如果消息处理函数本身也出错了，返回LUA_ERRERR
+func (self *luaState) callMsgHandler(handler luaValue, err *luaError) (result *luaError) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(apiCheckError); ok {
+				panic(r)
+			}
+			if err, ok := r.(*luaError); ok && (err == errKilled || !self.catchable(err.status)) {
+				panic(r) //协程被杀死、中断或者退出时，消息处理函数里抛出的错误也不能被吞掉
+			}
+			result = &luaError{LUA_ERRERR, "error in error handling"}
+		}
+	}()
+
+	self.stack.check(2)
+	self.stack.push(handler)
+	self.stack.push(err.value)
+	self.Call(1, 1)
+	return &luaError{err.status, self.stack.pop()}
+}
+
+// 以栈顶的值为错误对象抛出错误，该方法不会返回
+func (self *luaState) Error() int {
+	self.checkElems(1)
+	panic(&luaError{LUA_ERRRUN, self.stack.pop()})
+}
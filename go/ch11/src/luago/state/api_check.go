@@ -0,0 +1,117 @@
+/*
+ *该脚本是luago/api/lua_state.go里的接口的具体实现
+ *主要实现：API检查模式（相当于官方实现里编译时打开LUA_USE_APICHECK）
+ *	SetAPICheck(enable bool)
+ *
+ *默认情况下，API方法并不会严格检查传入的参数，比如get()遇到无效索引会直接返回nil，
+ *Go函数返回的结果数量比实际压栈的数量多时，主调帧会被popN()弄乱。这些问题往往要到很久以后才会以奇怪的形式暴露出来。
+ *打开检查模式后，每次API调用都会校验索引、栈里的元素数量以及Go函数声明的返回值数量，
+ *一旦发现问题立即panic，并在错误信息里带上出错的Go代码位置，方便定位。
+ *检查失败说明宿主代码有bug，所以与官方实现里的断言一样，Lua代码的pcall()捕获不了它，它会一直传播到宿主那里。
+ */
+package state
+
+import (
+	"fmt"
+	. "luago/api"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+const _MAXUPVAL = 255 //Go闭包最多能拥有的Upvalue数量，用于校验Upvalue伪索引
+
+// API检查失败时panic()的参数，PCall()遇到它会原样重新抛出，而不是当作Lua错误交给主调方
+type apiCheckError string
+
+func (self apiCheckError) Error() string {
+	return string(self)
+}
+
+// 开启或关闭API检查模式
+func (self *luaState) SetAPICheck(enable bool) {
+	self.apiCheck = enable
+}
+
+/*
+ *校验索引是否可以接受，mustBeValid表示索引是否必须是有效索引（即位于[1, top]区间或者有效的伪索引）
+ *读取操作只要求可接受索引（位于[1, n]区间），写入操作则要求有效索引
+ */
+func (self *luaStack) checkIndex(idx int, mustBeValid bool) {
+	switch {
+	case idx == LUA_REGISTRYINDEX:
+	case idx < LUA_REGISTRYINDEX:
+		uvIdx := LUA_REGISTRYINDEX - idx - 1
+		if uvIdx >= _MAXUPVAL {
+			apiCheckFailed("upvalue index too large: %d", uvIdx+1)
+		}
+		if mustBeValid && !self.isValid(idx) {
+			apiCheckFailed("invalid upvalue index: %d", uvIdx+1)
+		}
+	case idx == 0:
+		apiCheckFailed("invalid index: 0")
+	case idx > 0:
+		if idx > len(self.slots) {
+			apiCheckFailed("unacceptable index: %d (stack size %d)", idx, len(self.slots))
+		}
+		if mustBeValid && idx > self.top {
+			apiCheckFailed("invalid index: %d (top %d)", idx, self.top)
+		}
+	default:
+		if -idx > self.top {
+			apiCheckFailed("invalid index: %d (top %d)", idx, self.top)
+		}
+	}
+}
+
+// 校验索引是否是有效的栈索引，Rotate()、Insert()和Remove()只能操作栈里的值，不能是伪索引
+func (self *luaStack) checkStackIndex(idx int) {
+	if idx <= LUA_REGISTRYINDEX {
+		apiCheckFailed("pseudo-index not allowed: %d", idx)
+	}
+	self.checkIndex(idx, true)
+}
+
+// 校验栈里是否至少有n个元素（比如Call()需要被调函数和参数，Arith()需要操作数）
+func (self *luaState) checkElems(n int) {
+	if self.apiCheck && (n < 0 || n > self.stack.top) {
+		apiCheckFailed("not enough elements in the stack: need %d, have %d", n, self.stack.top)
+	}
+}
+
+/*
+ *校验Go函数声明的返回值数量是否与其调用帧里实际压入的值相符
+ *此时Go函数已经返回了，Go调用栈里找不到出错的位置，所以错误信息里带上函数名和函数定义的位置
+ */
+func (self *luaState) checkResults(c *closure, stack *luaStack, r int) {
+	if r >= 0 && r <= stack.top {
+		return
+	}
+	fn := runtime.FuncForPC(reflect.ValueOf(c.goFunc).Pointer())
+	file, line := fn.FileLine(fn.Entry())
+	panic(apiCheckError(fmt.Sprintf("api check failed: go function %s returned %d results but only %d values on its stack (%s:%d)",
+		fn.Name(), r, stack.top, file, line)))
+}
+
+// 报告API检查失败，错误信息里带上调用API的Go代码位置
+func apiCheckFailed(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	panic(apiCheckError(fmt.Sprintf("api check failed: %s (%s)", msg, apiCaller())))
+}
+
+// 沿着Go调用栈向上查找，第一个不属于本包（以及Go运行时）的函数就是调用API的位置
+func apiCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "luago/state.") &&
+			!strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "?"
+		}
+	}
+}
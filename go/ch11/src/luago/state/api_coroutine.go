@@ -0,0 +1,187 @@
+/*
+ *该脚本是luago/api/lua_state.go里的接口的具体实现
+ *主要实现：线程与协程
+ *	NewThread() LuaState
+ *	Resume(from LuaState, nArgs int) int
+ *	Yield(nResults int) int
+ *	Status() int
+ *	IsYieldable() bool
+ *	HasFrames() bool
+ *	ToThread(idx int) LuaState
+ *	PushThread() bool
+ *	XMove(to LuaState, n int)
+ *	Close()
+ *
+ *官方实现用longjmp在挂起时跳出C函数，我们的虚拟机则是用Go的调用栈来嵌套调用Lua函数的，
+ *挂起时必须把整个Go调用栈保存下来，所以每个协程都运行在自己的goroutine里：
+ *Resume()唤醒协程的goroutine之后就阻塞等待，直到协程调用Yield()或者运行结束；
+ *Yield()唤醒恢复者之后也阻塞等待，直到再次被Resume()。两边通过无缓冲的通道交接控制权，
+ *所以任意时刻只有一个goroutine在运行Lua代码，不需要额外加锁。
+ *注意：一直没有运行结束的协程，它的goroutine会一直阻塞在Yield()里，即使协程本身已经访问不到了，Go也不会回收它。
+ *所以全局状态里记录了goroutine还活着的协程，宿主用完Lua解释器之后应该调用Close()杀死它们；
+ *这些goroutine的栈也会被计入内存占用（见lua_gc.go），受内存上限的约束
+ */
+package state
+
+import . "luago/api"
+
+// 协程被Close()杀死时Yield()抛出的错误，Lua代码捕获不了它，它会一直传播到协程最底层的PCall()，结束协程的goroutine
+var errKilled = &luaError{LUA_ERRRUN, "coroutine killed"}
+
+// 创建一个新线程并推入栈顶，新线程与当前线程共享全局状态（注册表、全局环境等），但拥有自己独立的调用栈
+func (self *luaState) NewThread() LuaState {
+	t := &luaState{globalState: self.globalState}
+	//新线程继承当前线程的钩子（与官方实现一致）
+	t.hook, t.hookMask = self.hook, self.hookMask
+	t.baseHookCount, t.hookCount = self.baseHookCount, self.baseHookCount
+	t.pushLuaStack(newLuaStack(LUA_MINSTACK, t))
+	self.stack.check(1)
+	self.stack.push(t)
+	self.allocate(_SIZE_THREAD + LUA_MINSTACK*_SIZE_SLOT)
+	return t
+}
+
+/*
+ *启动或者继续运行协程（相当于lua_resume）
+ *启动时，栈里是主函数和nArgs个参数；继续运行时，栈里的nArgs个值会成为Yield()的返回值
+ *返回LUA_YIELD表示协程挂起了，栈里是传给Yield()的值；返回LUA_OK表示协程运行结束，栈里是主函数的返回值；
+ *否则表示协程出错了，栈顶是错误对象，协程也就结束了
+ */
+func (self *luaState) Resume(from LuaState, nArgs int) int {
+	if self.status == LUA_OK { // 可能是启动协程
+		if self.HasFrames() { // 不是在最底层，说明协程正在运行
+			return self.resumeError("cannot resume non-suspended coroutine", nArgs)
+		}
+	} else if self.status != LUA_YIELD {
+		return self.resumeError("cannot resume dead coroutine", nArgs)
+	}
+
+	self.caller, _ = from.(*luaState)
+	if self.status == LUA_OK { // 启动协程
+		self.allocate(_SIZE_GOROUTINE)
+		self.resumeCh = make(chan struct{})
+		self.yieldCh = make(chan struct{})
+		self.coroutines[self] = true
+		go func() {
+			defer func() {
+				//PCall()不会捕获API检查失败，交给恢复者重新抛出，否则goroutine里没有被捕获的panic会让整个进程崩溃
+				if r := recover(); r != nil {
+					err, ok := r.(apiCheckError)
+					if !ok {
+						panic(r)
+					}
+					self.checkFailed = err
+					self.status = LUA_ERRRUN
+				}
+				delete(self.coroutines, self)
+				self.yieldCh <- struct{}{}
+			}()
+			//出错时PCall()会把错误对象留在栈顶，协程也就结束了
+			self.status = self.PCall(nArgs, LUA_MULTRET, 0)
+		}()
+	} else { // 从挂起的地方继续运行
+		self.status = LUA_OK
+		self.resumeCh <- struct{}{}
+	}
+	<-self.yieldCh // 等待协程挂起或者结束
+	if self.checkFailed != "" {
+		panic(self.checkFailed)
+	}
+	if self.caller != nil && !self.catchable(self.status) {
+		//错误（中断或者退出）不能被Lua代码捕获时，在恢复者里继续传播
+		err := &luaError{self.status, self.stack.get(-1)}
+		if self.caller.propagateInterrupt(err, self.caller.stack) {
+			panic(err)
+		}
+	}
+	return self.status
+}
+
+// 弹出参数，把错误信息推入栈顶，返回LUA_ERRRUN
+func (self *luaState) resumeError(msg string, nArgs int) int {
+	self.stack.popN(nArgs)
+	self.stack.check(1)
+	self.stack.push(msg)
+	return LUA_ERRRUN
+}
+
+/*
+ *挂起当前协程（相当于lua_yield），栈顶的nResults个值会被交给恢复者（作为Resume()的结果）
+ *协程再次被恢复之后，该方法才会返回，返回值是恢复者传过来的值的数量，这些值就在栈里
+ */
+func (self *luaState) Yield(nResults int) int {
+	if self.killed {
+		panic(errKilled) // 协程已经被杀死了，不能再挂起
+	}
+	if !self.IsYieldable() {
+		panic(&luaError{LUA_ERRRUN, "attempt to yield from outside a coroutine"})
+	}
+	self.checkElems(nResults)
+	//只保留栈顶的nResults个值
+	if n := self.stack.top - nResults; n > 0 {
+		results := self.stack.popN(nResults)
+		self.stack.popN(n)
+		self.stack.pushN(results, nResults)
+	}
+	self.status = LUA_YIELD
+	self.yieldCh <- struct{}{} // 唤醒恢复者
+	<-self.resumeCh            // 等待再次被恢复
+	if self.killed {
+		panic(errKilled) // 不是被恢复，而是被Close()唤醒的
+	}
+	return self.stack.top
+}
+
+// 返回线程的状态：LUA_OK、LUA_YIELD或者错误码
+func (self *luaState) Status() int {
+	return self.status
+}
+
+// 当前线程能否挂起：主线程不能挂起，被Resume()运行的协程可以
+func (self *luaState) IsYieldable() bool {
+	return self != self.mainThread && self.caller != nil
+}
+
+// 线程里是否有正在执行（或者调用了其他函数而在等待）的函数，最底层那个空的调用帧不算
+func (self *luaState) HasFrames() bool {
+	return self.stack.prev != nil
+}
+
+// 如果指定索引处的值是线程，则返回该线程，否则返回nil
+func (self *luaState) ToThread(idx int) LuaState {
+	if t, ok := self.stack.get(idx).(*luaState); ok {
+		return t
+	}
+	return nil
+}
+
+// 把当前线程推入栈顶，如果当前线程是主线程，返回true
+func (self *luaState) PushThread() bool {
+	self.stack.push(self)
+	return self == self.mainThread
+}
+
+// 从当前线程的栈顶弹出n个值，按照原来的顺序推入另一个线程的栈顶（两个线程必须属于同一个Lua解释器）
+func (self *luaState) XMove(to LuaState, n int) {
+	t := to.(*luaState)
+	if t == self {
+		return
+	}
+	self.checkElems(n)
+	vals := self.stack.popN(n)
+	t.stack.check(n)
+	t.stack.pushN(vals, n)
+}
+
+/*
+ *关闭Lua解释器（相当于lua_close）：杀死所有挂起的协程，让它们的goroutine运行结束
+ *被杀死的协程的Yield()会抛出Lua代码捕获不了的错误，从而结束协程，之后协程就是dead状态
+ *只能由宿主在Lua代码没有运行的时候调用，关闭之后仍然可以访问解释器里的值，但是不应该再运行Lua代码
+ */
+func (self *luaState) Close() {
+	for co := range self.coroutines {
+		co.killed = true
+		co.resumeCh <- struct{}{}
+		<-co.yieldCh // 等待goroutine运行结束
+	}
+}
@@ -0,0 +1,372 @@
+/*
+ *该脚本是luago/api/lua_state.go里的接口的具体实现
+ *主要实现：调试信息
+ *	Traceback(msg string, level int)
+ *	GetUpvalue(funcIdx, n int) (string, bool)
+ *	SetUpvalue(funcIdx, n int) (string, bool)
+ *	UpvalueId(funcIdx, n int) bool
+ *	UpvalueJoin(f1, n1, f2, n2 int)
+ *	GetStack(level int) (ActivationRecord, bool)
+ *	GetInfo(what string, ar *ActivationRecord) bool
+ *	GetLocal(ar *ActivationRecord, n int) string
+ *	SetLocal(ar *ActivationRecord, n int) string
+ *	SetHook(f Hook, mask, count int)
+ *	GetHook() Hook
+ *	GetHookMask() int
+ *	GetHookCount() int
+ */
+package state
+
+import (
+	"fmt"
+	. "luago/api"
+	"strings"
+)
+
+const (
+	_LEVELS1 = 10 //调用栈太深时，回溯信息开头保留的层数
+	_LEVELS2 = 11 //调用栈太深时，回溯信息结尾保留的层数
+)
+
+/*
+ *收集从第level层开始的全部调用帧。第0层是当前正在运行的函数，第1层是调用它的函数，依此类推
+ *最底层那个空的调用帧（New()时推入的）并不对应任何函数，所以不计入层数
+ */
+func (self *luaState) callFrames(level int) []*luaStack {
+	var frames []*luaStack
+	for stack := self.stack; stack != nil; stack = stack.prev {
+		if stack.closure == nil {
+			continue
+		}
+		if level > 0 {
+			level--
+			continue
+		}
+		frames = append(frames, stack)
+	}
+	return frames
+}
+
+/*
+ *生成调用栈回溯信息并推入栈顶，格式与官方的luaL_traceback()一致：
+ *	msg
+ *	stack traceback:
+ *		[C]: in function 'error'
+ *		foo.lua:3: in function 'f'
+ *		foo.lua:7: in main chunk
+ *msg为空时省略第一行，level表示从第几层调用帧开始回溯
+ */
+func (self *luaState) Traceback(msg string, level int) {
+	var buf strings.Builder
+	if msg != "" {
+		buf.WriteString(msg)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("stack traceback:")
+
+	frames := self.callFrames(level)
+	for i := 0; i < len(frames); i++ {
+		if len(frames) > _LEVELS1+_LEVELS2 && i == _LEVELS1 {
+			//调用栈太深，只保留开头和结尾的部分
+			buf.WriteString("\n\t...")
+			i = len(frames) - _LEVELS2
+		}
+		stack := frames[i]
+		buf.WriteString(fmt.Sprintf("\n\t%s:", stack.shortSrc()))
+		if line := stack.currentLine(); line > 0 {
+			buf.WriteString(fmt.Sprintf("%d:", line))
+		}
+		buf.WriteString(" in ")
+		buf.WriteString(stack.funcDescription())
+	}
+
+	self.stack.check(1)
+	self.stack.push(buf.String())
+}
+
+/*
+ *按照索引（从1开始）找到闭包的Upvalue，返回Upvalue的名字以及它的引用
+ *Lua闭包的Upvalue名字来自函数原型的调试信息（调试信息被去掉时为"(*no name)"），Go闭包的Upvalue名字都是空字符串
+ */
+func (self *luaState) getUpvalue(funcIdx, n int) (string, *upvalue, bool) {
+	c, ok := self.stack.get(funcIdx).(*closure)
+	if !ok || n < 1 || n > len(c.upvals) {
+		return "", nil, false
+	}
+
+	//主函数只有第一个Upvalue（_ENV）在加载时被初始化了，其他Upvalue在第一次访问时再创建
+	if c.upvals[n-1] == nil {
+		var val luaValue
+		c.upvals[n-1] = &upvalue{&val}
+	}
+
+	name := ""
+	if c.proto != nil {
+		name = "(*no name)"
+		if n <= len(c.proto.UpvalueNames) {
+			name = c.proto.UpvalueNames[n-1]
+		}
+	}
+	return name, c.upvals[n-1], true
+}
+
+func (self *luaState) GetUpvalue(funcIdx, n int) (string, bool) {
+	name, uv, ok := self.getUpvalue(funcIdx, n)
+	if ok {
+		self.stack.check(1)
+		self.stack.push(*uv.val)
+	}
+	return name, ok
+}
+
+func (self *luaState) SetUpvalue(funcIdx, n int) (string, bool) {
+	self.checkElems(1)
+	name, uv, ok := self.getUpvalue(funcIdx, n)
+	if ok {
+		*uv.val = self.stack.pop()
+	}
+	return name, ok
+}
+
+// 把Upvalue本身（而不是它的值）当作轻量用户数据推入栈顶，共享同一个Upvalue的闭包得到的是同一个指针
+func (self *luaState) UpvalueId(funcIdx, n int) bool {
+	_, uv, ok := self.getUpvalue(funcIdx, n)
+	if ok {
+		self.stack.check(1)
+		self.stack.push(uv)
+	}
+	return ok
+}
+
+// 让f1处闭包的第n1个Upvalue引用f2处闭包的第n2个Upvalue，此后两个闭包共享这个Upvalue（只支持Lua闭包）
+func (self *luaState) UpvalueJoin(f1, n1, f2, n2 int) {
+	c1, ok := self.stack.get(f1).(*closure)
+	if !ok || c1.proto == nil || n1 < 1 || n1 > len(c1.upvals) {
+		return
+	}
+	if _, uv, ok := self.getUpvalue(f2, n2); ok {
+		c1.upvals[n1-1] = uv
+	}
+}
+
+func (self *luaState) GetStack(level int) (ActivationRecord, bool) {
+	if level < 0 {
+		return ActivationRecord{}, false
+	}
+	frames := self.callFrames(level)
+	if len(frames) == 0 {
+		return ActivationRecord{}, false
+	}
+	return ActivationRecord{CallInfo: frames[0]}, true
+}
+
+/*
+ *按照what填写活动记录（相当于lua_getinfo），what里的每个字符的含义见ActivationRecord的注释，另外：
+ *	'f'：把函数本身推入栈顶
+ *	'L'：把函数的有效行号表推入栈顶，表的键是有指令的行号，值都是true，Go函数推入nil
+ *what以'>'开头时，描述的是从栈顶弹出的函数（而不是调用帧），此时没有CurrentLine和Name等运行时信息
+ */
+func (self *luaState) GetInfo(what string, ar *ActivationRecord) bool {
+	var frame *luaStack
+	var c *closure
+	if strings.HasPrefix(what, ">") {
+		self.checkElems(1)
+		c, _ = self.stack.pop().(*closure)
+		what = what[1:]
+	} else if frame, _ = ar.CallInfo.(*luaStack); frame != nil {
+		c = frame.closure
+	}
+	if c == nil {
+		return false
+	}
+
+	ok := true
+	for _, option := range what {
+		switch option {
+		case 'S':
+			ar.What = funcWhat(c)
+			if c.proto == nil {
+				ar.Source = "=[C]"
+				ar.LineDefined, ar.LastLineDefined = -1, -1
+			} else {
+				ar.Source = c.proto.Source
+				if ar.Source == "" {
+					ar.Source = "=?"
+				}
+				ar.LineDefined = int(c.proto.LineDefined)
+				ar.LastLineDefined = int(c.proto.LastLineDefined)
+			}
+			ar.ShortSrc = shortSrc(ar.Source)
+		case 'l':
+			ar.CurrentLine = -1
+			if frame != nil {
+				ar.CurrentLine = frame.currentLine()
+			}
+		case 'u':
+			ar.NUps = len(c.upvals)
+			if c.proto == nil {
+				ar.NParams, ar.IsVararg = 0, true
+			} else {
+				ar.NParams, ar.IsVararg = int(c.proto.NumParams), c.proto.IsVararg == 1
+			}
+		case 'n':
+			ar.Name, ar.NameWhat = "", ""
+			if frame != nil {
+				ar.Name, ar.NameWhat = frame.funcName()
+			}
+		case 't':
+			ar.IsTailCall = frame != nil && frame.isTailCall
+		case 'f', 'L': //需要推入值，下面再处理
+		default:
+			ok = false
+		}
+	}
+
+	if strings.ContainsRune(what, 'f') {
+		self.stack.check(1)
+		self.stack.push(c)
+	}
+	if strings.ContainsRune(what, 'L') {
+		self.stack.check(1)
+		if c.proto == nil {
+			self.stack.push(nil)
+		} else {
+			lines := newLuaTable(0, len(c.proto.LineInfo))
+			for _, line := range c.proto.LineInfo {
+				lines.put(int64(line), true)
+			}
+			self.stack.push(lines)
+			self.allocate(lines.size())
+		}
+	}
+	return ok
+}
+
+/*
+ *找到调用帧的第n个局部变量，返回变量名以及变量值所在的位置，找不到返回空字符串和nil。变量的值就在slots[n-1]里
+ *有名字的局部变量来自函数原型的调试信息，其他寄存器（以及Go函数的栈）里的值当作临时变量
+ *n为负数时表示变长参数：-1是第一个变长参数，-2是第二个，依此类推（与官方实现一致）
+ */
+func (self *luaStack) findLocal(n int) (string, *luaValue) {
+	if n < 0 {
+		if proto := self.closure.proto; proto != nil && proto.IsVararg == 1 && -n <= len(self.varargs) {
+			return "(*vararg)", &self.varargs[-n-1]
+		}
+		return "", nil
+	}
+	if n < 1 || n > self.top {
+		return "", nil
+	}
+	if proto := self.closure.proto; proto != nil {
+		//与currentLine()一样，正在执行的是pc-1处的指令（刚进入函数时是第一条指令）
+		pc := self.pc - 1
+		if pc < 0 {
+			pc = 0
+		}
+		if name := localName(proto, n, pc); name != "" {
+			return name, &self.slots[n-1]
+		}
+		return "(*temporary)", &self.slots[n-1]
+	}
+	return "(*C temporary)", &self.slots[n-1]
+}
+
+func (self *luaState) GetLocal(ar *ActivationRecord, n int) string {
+	if ar == nil {
+		//非活动函数没有运行时的值，只能返回第n个参数的名字
+		if c, ok := self.stack.get(-1).(*closure); ok && c.proto != nil {
+			return localName(c.proto, n, 0)
+		}
+		return ""
+	}
+
+	frame := ar.CallInfo.(*luaStack)
+	name, val := frame.findLocal(n)
+	if name != "" {
+		self.stack.check(1)
+		self.stack.push(*val)
+	}
+	return name
+}
+
+func (self *luaState) SetLocal(ar *ActivationRecord, n int) string {
+	self.checkElems(1)
+	frame := ar.CallInfo.(*luaStack)
+	name, val := frame.findLocal(n)
+	if name != "" {
+		*val = self.stack.pop()
+	}
+	return name
+}
+
+func (self *luaState) SetHook(f Hook, mask, count int) {
+	if f == nil || mask == 0 {
+		//关闭钩子
+		f, mask = nil, 0
+	}
+	self.hook = f
+	self.hookMask = mask
+	self.baseHookCount = count
+	self.hookCount = count
+}
+
+func (self *luaState) GetHook() Hook {
+	return self.hook
+}
+
+func (self *luaState) GetHookMask() int {
+	return self.hookMask
+}
+
+func (self *luaState) GetHookCount() int {
+	return self.baseHookCount
+}
+
+/*
+ *在当前调用帧上调用钩子，line是行事件的行号（其他事件为-1）
+ *钩子推入栈里的值会被丢掉，执行钩子期间（包括钩子调用的Lua函数）不会再次触发钩子
+ */
+func (self *luaState) callHook(event, line int) {
+	if self.hook == nil || self.inHook {
+		return
+	}
+	stack := self.stack
+	top := stack.top
+	self.inHook = true
+	defer func() { self.inHook = false }()
+
+	stack.check(LUA_MINSTACK)
+	self.hook(self, &ActivationRecord{Event: event, CurrentLine: line, CallInfo: stack})
+	for stack.top > top {
+		stack.pop()
+	}
+}
+
+/*
+ *在执行每条指令之前调用（此时PC已经指向下一条指令），触发计数事件和行事件：
+ *每执行baseHookCount条指令触发一次计数事件；进入新函数、执行到新的一行或者向后跳转时触发行事件
+ */
+func (self *luaState) traceExec() {
+	//尾调用之后主调函数就被取代了，剩下的RETURN指令不再触发事件
+	if self.inHook || self.stack.tailCalled {
+		return
+	}
+	stack := self.stack
+	npc := stack.pc - 1
+	if self.hookMask&LUA_MASKCOUNT != 0 {
+		self.hookCount--
+		if self.hookCount == 0 {
+			self.hookCount = self.baseHookCount
+			self.callHook(LUA_HOOKCOUNT, -1)
+		}
+	}
+	if self.hookMask&LUA_MASKLINE != 0 {
+		proto := stack.closure.proto
+		newLine := currentLine(proto, npc)
+		//进入新函数、执行到新的一行或者向后跳转（循环）时触发行事件
+		if npc == 0 || npc <= stack.oldPC || newLine != currentLine(proto, stack.oldPC) {
+			self.callHook(LUA_HOOKLINE, newLine)
+		}
+	}
+	stack.oldPC = npc
+}
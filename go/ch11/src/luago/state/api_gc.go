@@ -0,0 +1,67 @@
+/*
+ *该脚本是luago/api/lua_state.go里的接口的具体实现
+ *主要实现：垃圾回收
+ *	GC(what, arg int) int
+ *	SetMemoryLimit(limit int)
+ *	MemoryLimit() int
+ *	CheckMemory(n int)
+ *
+ *Lua值的内存由Go的垃圾回收器管理，这里控制的是内存统计（见lua_gc.go）：
+ *回收一个周期就是重新统计一次存活对象，只有LUA_GCCOLLECT会真正让Go执行垃圾回收
+ */
+package state
+
+import . "luago/api"
+
+func (self *luaState) GC(what, arg int) int {
+	switch what {
+	case LUA_GCSTOP:
+		self.gcRunning = false
+	case LUA_GCRESTART:
+		self.gcRunning = true
+	case LUA_GCCOLLECT:
+		self.fullGC(true)
+	case LUA_GCCOUNT:
+		return int(self.totalBytes >> 10)
+	case LUA_GCCOUNTB:
+		return int(self.totalBytes & 0x3FF)
+	case LUA_GCSTEP:
+		//Go的垃圾回收器不需要我们推进，每一步都直接完成一个统计周期
+		self.fullGC(false)
+		return 1
+	case LUA_GCSETPAUSE:
+		old := self.gcPause
+		self.gcPause = arg
+		return old
+	case LUA_GCSETSTEPMUL:
+		old := self.gcStepMul
+		self.gcStepMul = arg
+		return old
+	case LUA_GCISRUNNING:
+		if self.gcRunning {
+			return 1
+		}
+	case LUA_GCGEN, LUA_GCINC:
+		old := self.gcMode
+		self.gcMode = what
+		return old
+	default:
+		return -1 //不合法的操作
+	}
+	return 0
+}
+
+func (self *luaState) SetMemoryLimit(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	self.memLimit = int64(limit)
+}
+
+func (self *luaState) MemoryLimit() int {
+	return int(self.memLimit)
+}
+
+func (self *luaState) CheckMemory(n int) {
+	self.checkMemory(n)
+}
@@ -13,6 +13,8 @@ import . "luago/api"
 
 //创建一个表并推入栈顶
 func (self *luaState) CreateTable(nArr, nRec int) {
+	//先按照预估的容量记账（超过内存上限时不会真的创建）
+	self.allocate(_SIZE_TABLE + nArr*_SIZE_ARRSLOT + nRec*_SIZE_NODE)
 	t := newLuaTable(nArr, nRec)
 	self.stack.push(t)
 }
@@ -79,6 +81,7 @@ func (self *luaState) getTable(t, k luaValue, raw bool) LuaType {
 	//或者t不是表
 	if !raw {
 		if mf := getMetafield(t, "__index", self); mf != nil {
+			self.traceMetamethod("__index")
 			switch x := mf.(type) {
 			case *luaTable:
 				//如果元方法是一个Table，Lua会以k为键访问该表，以值为结果（可能会继续触发__index元方法）
@@ -0,0 +1,77 @@
+/*
+ *该脚本是luago/api/lua_state.go里的接口的具体实现
+ *主要实现：与宿主程序的交互
+ *	SetExitHook(hook ExitHook)
+ *	Exit(code int)
+ *	SetStdin(r io.Reader)
+ *	SetStdout(w io.Writer)
+ *	SetStderr(w io.Writer)
+ *	Stdin() io.Reader
+ *	Stdout() io.Writer
+ *	Stderr() io.Writer
+ *
+ *Lua脚本可能会调用os.exit()，对于独立的解释器来说，结束进程是合理的；
+ *但是对于嵌入了Lua的程序（比如游戏服务器）来说，脚本不应该有能力直接杀死整个进程，
+ *所以os.exit()并不直接调用os.Exit()，而是通过每个Lua解释器自己的钩子来处理，宿主程序可以替换这个钩子，
+ *钩子返回之后脚本的执行会被终止，控制权回到宿主手里
+ *同理，print()和io库使用的标准输入输出也是每个Lua解释器自己的，宿主程序可以把它们换成任意的io.Reader/io.Writer，
+ *比如在测试里捕获脚本的输出
+ */
+package state
+
+import (
+	"io"
+	. "luago/api"
+	"os"
+)
+
+// 设置os.exit()的宿主钩子，nil表示恢复默认行为
+func (self *luaState) SetExitHook(hook ExitHook) {
+	self.exitHook = hook
+}
+
+/*
+ *请求以退出码code结束程序，该方法不会返回
+ *设置了宿主钩子时，钩子返回之后抛出LUA_ERREXIT错误（错误对象是退出码）来终止脚本的执行：
+ *与不可捕获的中断错误一样，pcall()和coroutine.resume()都捕获不了它，只有宿主直接发起的PCall()才能捕获
+ */
+func (self *luaState) Exit(code int) {
+	if self.exitHook == nil {
+		os.Exit(code)
+	}
+	self.exitHook(code)
+	panic(&luaError{LUA_ERREXIT, int64(code)})
+}
+
+func (self *luaState) SetStdin(r io.Reader) {
+	self.stdin = r
+}
+
+func (self *luaState) SetStdout(w io.Writer) {
+	self.stdout = w
+}
+
+func (self *luaState) SetStderr(w io.Writer) {
+	self.stderr = w
+}
+
+func (self *luaState) Stdin() io.Reader {
+	if self.stdin == nil {
+		return os.Stdin
+	}
+	return self.stdin
+}
+
+func (self *luaState) Stdout() io.Writer {
+	if self.stdout == nil {
+		return os.Stdout
+	}
+	return self.stdout
+}
+
+func (self *luaState) Stderr() io.Writer {
+	if self.stderr == nil {
+		return os.Stderr
+	}
+	return self.stderr
+}
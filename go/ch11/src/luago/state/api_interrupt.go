@@ -0,0 +1,83 @@
+/*
+ *该脚本是luago/api/lua_state.go里的接口的具体实现
+ *主要实现：中断执行
+ *	SetContext(ctx context.Context)
+ *	Context() context.Context
+ *	SetInstructionLimit(limit int)
+ *	InstructionCount() int
+ *	SetInterruptCatchable(catchable bool)
+ *
+ *runLuaClosure()会一直取指令、执行指令，直到遇到RETURN指令，所以像"while true do end"这样的脚本永远不会结束，
+ *对于每个请求都要执行脚本的服务器来说，这是不能接受的。为此宿主可以给Lua解释器设置一个Context和（或者）一个指令预算，
+ *虚拟机在向后跳转（循环）和调用函数时检查它们，Context被取消或者指令预算用完时，抛出LUA_ERRINTERRUPT错误。
+ *只在向后跳转和调用函数时检查就够了：不循环也不调用函数的话，一个函数能执行的指令数不会超过它的指令条数
+ *Context、指令预算以及指令计数都放在全局状态里，所以协程里执行的指令也会被计算在内
+ */
+package state
+
+import (
+	"context"
+	"fmt"
+	. "luago/api"
+)
+
+func (self *luaState) SetContext(ctx context.Context) {
+	self.ctx = ctx
+}
+
+func (self *luaState) Context() context.Context {
+	if self.ctx == nil {
+		return context.Background()
+	}
+	return self.ctx
+}
+
+func (self *luaState) SetInstructionLimit(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	self.instLimit = int64(limit)
+	self.instCount = 0
+}
+
+func (self *luaState) InstructionCount() int {
+	return int(self.instCount)
+}
+
+func (self *luaState) SetInterruptCatchable(catchable bool) {
+	self.interruptCatchable = catchable
+}
+
+// 检查Context是否已经被取消、指令预算是否已经用完，是的话抛出LUA_ERRINTERRUPT错误
+func (self *luaState) checkInterrupt() {
+	if self.instLimit > 0 && self.instCount > self.instLimit {
+		panic(&luaError{LUA_ERRINTERRUPT, fmt.Sprintf("interrupted: instruction limit exceeded (%d)", self.instLimit)})
+	}
+	if self.ctx != nil {
+		select {
+		case <-self.ctx.Done():
+			panic(&luaError{LUA_ERRINTERRUPT, "interrupted: " + self.ctx.Err().Error()})
+		default:
+		}
+	}
+}
+
+// 错误能否被Lua代码捕获：退出错误（见Exit()）总是不能，中断错误取决于SetInterruptCatchable()，其他错误都可以
+func (self *luaState) catchable(status int) bool {
+	switch status {
+	case LUA_ERREXIT:
+		return false
+	case LUA_ERRINTERRUPT:
+		return self.interruptCatchable
+	default:
+		return true
+	}
+}
+
+/*
+ *错误不可以被Lua代码捕获时，判断当前线程上的保护调用（caller是它的主调帧）是否应该把错误继续传播出去：
+ *只有宿主直接发起的调用（主调帧是线程最底层的调用帧）才能捕获这样的错误。协程被杀死时的错误也是这样（见Close()）
+ */
+func (self *luaState) propagateInterrupt(err *luaError, caller *luaStack) bool {
+	return (err == errKilled || !self.catchable(err.status)) && caller.prev != nil
+}
@@ -3,9 +3,13 @@
 	 *主要实现：运算操作
 	 	Len(idx int)
 		Concat(n int)
+		Next(idx int) bool
+		StringToNumber(s string) bool
 */
 package state
 
+import "luago/number"
+
 //访问指定索引处的值，取其长度，然后推入栈顶
 func (self *luaState) Len(idx int) {
 	val := self.stack.get(idx)
@@ -26,6 +30,7 @@ func (self *luaState) Len(idx int) {
 
 //从栈顶弹出n个值，对这些值进行拼接，然后把结果推入栈顶
 func (self *luaState) Concat(n int) {
+	self.checkElems(n)
 	if n == 0 {
 		self.stack.push("")
 	} else if n >= 2 {
@@ -34,6 +39,8 @@ func (self *luaState) Concat(n int) {
 			if self.IsString(-1) && self.IsString(-2) {
 				s2 := self.ToString(-1)
 				s1 := self.ToString(-2)
+				//先记账再拼接，超过内存上限时不会真的分配
+				self.allocate(stringSize(s1) + len(s2))
 				self.stack.pop()
 				self.stack.pop()
 				self.stack.push(s1 + s2)
@@ -53,3 +60,34 @@ func (self *luaState) Concat(n int) {
 	}
 	// n == 1, do nothing
 }
+
+//从栈顶弹出一个键，把表里的下一个键值对推入栈顶。键为nil时从头开始遍历，遍历结束时返回false
+//遍历过程中被赋值为nil的键会被跳过
+func (self *luaState) Next(idx int) bool {
+	val := self.stack.get(idx)
+	if t, ok := val.(*luaTable); ok {
+		key := self.stack.pop()
+		for nextKey := t.nextKey(key); nextKey != nil; nextKey = t.nextKey(nextKey) {
+			if v := t.get(nextKey); v != nil {
+				self.stack.push(nextKey)
+				self.stack.push(v)
+				return true
+			}
+		}
+		return false
+	}
+	panic("table expected!")
+}
+
+//把字符串按照Lua的规则转换成整数或者浮点数推入栈顶
+func (self *luaState) StringToNumber(s string) bool {
+	if i, ok := number.ParseInteger(s); ok {
+		self.PushInteger(i)
+		return true
+	}
+	if f, ok := number.ParseFloat(s); ok {
+		self.PushNumber(f)
+		return true
+	}
+	return false
+}
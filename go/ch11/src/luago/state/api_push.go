@@ -6,26 +6,44 @@
 		PushInteger(n int64)
 		PushNumber(n float64)
 		PushString(s string)
+		NewUserdata(data interface{})
 */
 package state
 
 import . "luago/api"
 
-func (self *luaState) PushNil()                    { self.stack.push(nil) }
-func (self *luaState) PushBoolean(b bool)          { self.stack.push(b) }
-func (self *luaState) PushInteger(n int64)         { self.stack.push(n) }
-func (self *luaState) PushNumber(n float64)        { self.stack.push(n) }
-func (self *luaState) PushString(s string)         { self.stack.push(s) }
-func (self *luaState) PushGoFunction(f GoFunction) { self.stack.push(newGoClosure(f, 0)) }
+func (self *luaState) PushNil()             { self.stack.push(nil) }
+func (self *luaState) PushBoolean(b bool)   { self.stack.push(b) }
+func (self *luaState) PushInteger(n int64)  { self.stack.push(n) }
+func (self *luaState) PushNumber(n float64) { self.stack.push(n) }
+
+func (self *luaState) PushString(s string) {
+	self.stack.push(s)
+	self.allocate(stringSize(s))
+}
+
+func (self *luaState) PushGoFunction(f GoFunction) {
+	c := newGoClosure(f, 0)
+	self.stack.push(c)
+	self.allocate(c.size())
+}
+
+//创建一个包装了Go值的完全用户数据并推入栈顶
+func (self *luaState) NewUserdata(data interface{}) {
+	self.stack.push(newUserdata(data))
+	self.allocate(_SIZE_UDATA)
+}
 
 func (self *luaState) PushGoClosure(f GoFunction, n int) {
+	self.checkElems(n)
 	//先创建Go闭包，然后从栈顶弹出指定数量的值让它们变成闭包的Upvalue
 	closure := newGoClosure(f, n)
 	for i := n; i > 0; i-- {
 		val := self.stack.pop()
-		closure.upvals[n-1] = &upvalue{&val}
+		closure.upvals[i-1] = &upvalue{&val}
 	}
 	self.stack.push(closure)
+	self.allocate(closure.size() + n*_SIZE_UPVAL)
 }
 
 //由于全局环境也只是个普通的Lua表，所以GetTable()和SetTable()等表操作方法也同样适用于它，
@@ -11,6 +11,7 @@ import . "luago/api"
 
 //作用是把键值对写入表。其中键和值从栈里弹出，表则位于指定索引处
 func (self *luaState) SetTable(idx int) {
+	self.checkElems(2)
 	t := self.stack.get(idx)
 	v := self.stack.pop()
 	k := self.stack.pop()
@@ -19,6 +20,7 @@ func (self *luaState) SetTable(idx int) {
 
 //SetTable的忽略元方法版本
 func (self *luaState) RawSet(idx int) {
+	self.checkElems(2)
 	t := self.stack.get(idx)
 	v := self.stack.pop()
 	k := self.stack.pop()
@@ -27,6 +29,7 @@ func (self *luaState) RawSet(idx int) {
 
 //作用是把键值对写入表。其中键由参数传入（字符串），值从栈里弹出，表则位于指定索引处
 func (self *luaState) SetField(idx int, k string) {
+	self.checkElems(1)
 	t := self.stack.get(idx)
 	v := self.stack.pop()
 	self.setTable(t, k, v, false)
@@ -35,6 +38,7 @@ func (self *luaState) SetField(idx int, k string) {
 //作用是把键值对写入表。其中键由参数传入（整数），值从栈里弹出，表则位于指定索引处
 //用于按索引修改数组元素
 func (self *luaState) SetI(idx int, i int64) {
+	self.checkElems(1)
 	t := self.stack.get(idx)
 	v := self.stack.pop()
 	self.setTable(t, i, v, false)
@@ -42,6 +46,7 @@ func (self *luaState) SetI(idx int, i int64) {
 
 //SetI的忽略元方法版本
 func (self *luaState) RawSetI(idx int, i int64) {
+	self.checkElems(1)
 	t := self.stack.get(idx)
 	v := self.stack.pop()
 	self.setTable(t, i, v, true)
@@ -59,7 +64,14 @@ func (self *luaState) setTable(t, k, v luaValue, raw bool) {
 		//增加了raw参数，如果该参数值为true，表示需要忽略元方法。
 		//如果t是表，并且键已经在表里了，或者需要忽略元方法，或者表没有__newindex元方法，则维持原来的逻辑
 		if raw || tbl.get(k) != nil || !tbl.hasMetafield("__newindex") {
+			//表的大小可能会变化（增加了键，数组扩展，或者删除了键），按照变化量记账。
+			//表会变大的话先检查内存上限，这样超过上限时值不会被写进表里
+			if n := tbl.growth(k, v); n > 0 {
+				self.checkMemory(n)
+			}
+			oldSize := tbl.size()
 			tbl.put(k, v)
+			self.allocate(tbl.size() - oldSize)
 			return
 		}
 	}
@@ -69,6 +81,7 @@ func (self *luaState) setTable(t, k, v luaValue, raw bool) {
 	//或者t不是表
 	if !raw {
 		if mf := getMetafield(t, "__newindex", self); mf != nil {
+			self.traceMetamethod("__newindex")
 			switch x := mf.(type) {
 			case *luaTable:
 				//如果是表，Lua会以k为键v为值给该表赋值（可能会继续触发__newindex元方法）
@@ -91,6 +104,7 @@ func (self *luaState) setTable(t, k, v luaValue, raw bool) {
 
 //往全局环境里写入一个值，其中字段名由参数指定，值从栈顶弹出
 func (self *luaState) SetGlobal(name string) {
+	self.checkElems(1)
 	t := self.registry.get(LUA_RIDX_GLOBALS)
 	v := self.stack.pop()
 	self.setTable(t, name, v, false)
@@ -106,6 +120,7 @@ func (self *luaState) Register(name string, f GoFunction) {
 
 //从栈顶弹出一个表，然后把指定索引处值的元表设置成该表
 func (self *luaState) SetMetatable(idx int) {
+	self.checkElems(1)
 	val := self.stack.get(idx)
 	mtVal := self.stack.pop()
 
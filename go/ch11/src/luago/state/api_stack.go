@@ -15,6 +15,8 @@
 */
 package state
 
+import . "luago/api"
+
 func (self *luaState) GetTop() int {
 	return self.stack.top
 }
@@ -24,17 +26,25 @@ func (self *luaState) AbsIndex(idx int) int {
 }
 
 func (self *luaState) CheckStack(n int) bool {
+	//单个调用帧的栈不能超过最大容量，否则扩容失败
+	if n < 0 || self.stack.top+n > LUAI_MAXSTACK {
+		return false
+	}
 	self.stack.check(n)
-	return true // never fails
+	return true
 }
 
 func (self *luaState) Pop(n int) {
+	self.checkElems(n)
 	for i := 0; i < n; i++ {
 		self.stack.pop()
 	}
 }
 
 func (self *luaState) Copy(fromIdx, toIdx int) {
+	if self.apiCheck {
+		self.stack.checkIndex(toIdx, true) // 读取fromIdx时get()会检查
+	}
 	val := self.stack.get(fromIdx)
 	self.stack.set(toIdx, val)
 }
@@ -47,18 +57,25 @@ func (self *luaState) PushValue(idx int) {
 
 //是PushValue()的反操作：将栈顶值弹出，然后写入指定位置
 func (self *luaState) Replace(idx int) {
+	self.checkElems(1)
 	val := self.stack.pop()
 	self.stack.set(idx, val)
 }
 
 //将栈顶值弹出，然后插入指定位置
 func (self *luaState) Insert(idx int) {
+	if self.apiCheck {
+		self.stack.checkStackIndex(idx)
+	}
 	//可以理解为从idx开始朝栈顶旋转一个单位
 	self.Rotate(idx, 1)
 }
 
 //删除指定索引处的值，然后将该值上面的值全部下移一个位置
 func (self *luaState) Remove(idx int) {
+	if self.apiCheck {
+		self.stack.checkStackIndex(idx)
+	}
 	//可以理解为从idx开始朝栈底方向旋转，然后删除最顶端的值
 	self.Rotate(idx, -1)
 	self.Pop(1)
@@ -67,6 +84,9 @@ func (self *luaState) Remove(idx int) {
 //将[idx, top]索引区间内的值朝栈顶方向旋转n个位置，如果n是负数，那么实际效果就是朝栈底方向旋转
 //所谓的旋转，可以理解为把从栈顶到idx的元素依次朝某个方向（栈顶或栈底）移动n个单位，移动后超出idx或者栈顶方向的，则循环插到栈顶或者idx处
 func (self *luaState) Rotate(idx, n int) {
+	if self.apiCheck {
+		self.stack.checkStackIndex(idx)
+	}
 	t := self.stack.top - 1
 	p := self.stack.absIndex(idx) - 1
 	var m int
@@ -0,0 +1,27 @@
+/*
+ *该脚本是luago/api/lua_state.go里的接口的具体实现
+ *主要实现：追踪器
+ *	SetTracer(t Tracer)
+ *	GetTracer() Tracer
+ *
+ *追踪器放在全局状态里，所以协程里发生的事件也会被追踪。没有设置追踪器时，虚拟机只多了一次nil判断
+ *内置的追踪器（输出可读文本的、输出JSON Lines的）见luago/utils/tracer.go
+ */
+package state
+
+import . "luago/api"
+
+func (self *luaState) SetTracer(t Tracer) {
+	self.tracer = t
+}
+
+func (self *luaState) GetTracer() Tracer {
+	return self.tracer
+}
+
+// 通知追踪器：正在分派元方法
+func (self *luaState) traceMetamethod(event string) {
+	if self.tracer != nil {
+		self.tracer.Metamethod(self, event)
+	}
+}
@@ -96,6 +96,7 @@ func (self *luaState) LoadProto(idx int) {
 			closure.upvals[i] = stack.closure.upvals[uvIdx]
 		}
 	}
+	self.allocate(closure.size())
 }
 
 func (self *luaState) CloseUpvalues(a int) {
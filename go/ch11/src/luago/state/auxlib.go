@@ -0,0 +1,573 @@
+/*
+ *该脚本是luago/api/lua_auxlib.go里的接口的具体实现
+ *主要实现：辅助库（相当于官方实现里的lauxlib），完全建立在基础API之上
+ */
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	. "luago/api"
+	"luago/stdlib"
+	"strings"
+	"syscall"
+)
+
+/* 错误报告 */
+
+//把第level层调用帧当前执行到的位置推入栈顶，格式为"chunkname:currentline: "，如果没有位置信息则推入空字符串
+//第0层是当前正在运行的函数，第1层是调用当前函数的函数，依此类推
+func (self *luaState) Where(level int) {
+	if frames := self.callFrames(level); len(frames) > 0 {
+		if line := frames[0].currentLine(); line > 0 {
+			self.PushString(fmt.Sprintf("%s:%d: ", frames[0].shortSrc(), line))
+			return
+		}
+	}
+	self.PushString("")
+}
+
+//格式化错误信息，加上调用当前Go函数的位置作为前缀，然后抛出错误
+func (self *luaState) Error2(fmtStr string, a ...interface{}) int {
+	self.Where(1)
+	self.PushString(fmt.Sprintf(fmtStr, a...))
+	self.Concat(2)
+	return self.Error()
+}
+
+//抛出参数错误，错误信息里带上当前函数的名字，比如"bad argument #1 to 'insert' (table expected, got nil)"
+func (self *luaState) ArgError(arg int, extraMsg string) int {
+	name, namewhat := self.stack.funcName()
+	if namewhat == "method" {
+		//方法调用时，第一个参数是隐含的self，不计入参数序号
+		arg--
+		if arg == 0 {
+			return self.Error2("calling '%s' on bad self (%s)", name, extraMsg)
+		}
+	}
+	if name == "" {
+		if name = self.globalFuncName(self.stack.closure); name == "" {
+			name = "?"
+		}
+	}
+	return self.Error2("bad argument #%d to '%s' (%s)", arg, name, extraMsg)
+}
+
+//抛出参数类型错误，如果实际参数的元表有__name字段，则用它作为类型名
+func (self *luaState) TypeError(arg int, tname string) int {
+	var typeArg string
+	if self.GetMetafield(arg, "__name") == LUA_TSTRING {
+		typeArg = self.ToString(-1)
+	} else if self.Type(arg) == LUA_TLIGHTUSERDATA {
+		typeArg = "light userdata"
+	} else {
+		typeArg = self.TypeName2(arg)
+	}
+	return self.ArgError(arg, fmt.Sprintf("%s expected, got %s", tname, typeArg))
+}
+
+func (self *luaState) ArgCheck(cond bool, arg int, extraMsg string) {
+	if !cond {
+		self.ArgError(arg, extraMsg)
+	}
+}
+
+/* 参数检查 */
+
+func (self *luaState) CheckStack2(sz int, msg string) {
+	if !self.CheckStack(sz) {
+		if msg != "" {
+			self.Error2("stack overflow (%s)", msg)
+		} else {
+			self.Error2("stack overflow")
+		}
+	}
+}
+
+func (self *luaState) CheckAny(arg int) {
+	if self.Type(arg) == LUA_TNONE {
+		self.ArgError(arg, "value expected")
+	}
+}
+
+func (self *luaState) CheckType(arg int, t LuaType) {
+	if self.Type(arg) != t {
+		self.TypeError(arg, self.TypeName(t))
+	}
+}
+
+func (self *luaState) CheckTable(arg int) {
+	self.CheckType(arg, LUA_TTABLE)
+}
+
+func (self *luaState) CheckInteger(arg int) int64 {
+	i, ok := self.ToIntegerX(arg)
+	if !ok {
+		self.intError(arg)
+	}
+	return i
+}
+
+//区分两种情况：参数是数字但不是整数（比如1.5），或者参数根本不是数字
+func (self *luaState) intError(arg int) {
+	if self.IsNumber(arg) {
+		self.ArgError(arg, "number has no integer representation")
+	} else {
+		self.TypeError(arg, "number")
+	}
+}
+
+func (self *luaState) CheckNumber(arg int) float64 {
+	f, ok := self.ToNumberX(arg)
+	if !ok {
+		self.TypeError(arg, "number")
+	}
+	return f
+}
+
+func (self *luaState) CheckString(arg int) string {
+	s, ok := self.ToStringX(arg)
+	if !ok {
+		self.TypeError(arg, "string")
+	}
+	return s
+}
+
+func (self *luaState) OptInteger(arg int, def int64) int64 {
+	if self.IsNoneOrNil(arg) {
+		return def
+	}
+	return self.CheckInteger(arg)
+}
+
+func (self *luaState) OptNumber(arg int, def float64) float64 {
+	if self.IsNoneOrNil(arg) {
+		return def
+	}
+	return self.CheckNumber(arg)
+}
+
+func (self *luaState) OptString(arg int, def string) string {
+	if self.IsNoneOrNil(arg) {
+		return def
+	}
+	return self.CheckString(arg)
+}
+
+/* 加载函数 */
+
+func (self *luaState) LoadString(s string) int {
+	return self.Load([]byte(s), s, "bt")
+}
+
+func (self *luaState) LoadFile(filename string) int {
+	return self.LoadFileX(filename, "bt")
+}
+
+//文件名会加上"@"前缀作为chunk名，文件名为空时从标准输入读取，读取文件失败时把错误信息推入栈顶，返回LUA_ERRFILE
+func (self *luaState) LoadFileX(filename, mode string) int {
+	if filename == "" {
+		data, err := ioutil.ReadAll(self.Stdin())
+		if err != nil {
+			self.PushString(fmt.Sprintf("cannot read stdin: %v", err))
+			return LUA_ERRFILE
+		}
+		return self.Load(data, "=stdin", mode)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		self.PushString(fmt.Sprintf("cannot open %s", filename))
+		return LUA_ERRFILE
+	}
+	return self.Load(data, "@"+filename, mode)
+}
+
+func (self *luaState) DoString(str string) bool {
+	return self.LoadString(str) == LUA_OK &&
+		self.PCall(0, LUA_MULTRET, 0) == LUA_OK
+}
+
+func (self *luaState) DoFile(filename string) bool {
+	return self.LoadFile(filename) == LUA_OK &&
+		self.PCall(0, LUA_MULTRET, 0) == LUA_OK
+}
+
+//给每个chunk一个自己的环境，同一个Lua解释器里的多个脚本就看不到彼此的全局变量了
+func (self *luaState) LoadEnv(chunk []byte, chunkName, mode string, env int) int {
+	if env != 0 {
+		env = self.AbsIndex(env)
+	}
+	status := self.Load(chunk, chunkName, mode)
+	if status == LUA_OK && env != 0 {
+		self.PushValue(env)
+		if _, ok := self.SetUpvalue(-2, 1); !ok {
+			self.Pop(1) // 主函数没有Upvalue，把env弹出
+		}
+	}
+	return status
+}
+
+/* 元表与用户数据 */
+
+//元表放在注册表里，键就是类型名，同时把类型名记录在元表的__name字段里（TypeError()和ToStringMeta()会用到）
+func (self *luaState) NewMetatable(tname string) bool {
+	if self.GetField(LUA_REGISTRYINDEX, tname) != LUA_TNIL {
+		return false // 已经有同名的元表了
+	}
+	self.Pop(1)
+	self.CreateTable(0, 2)
+	self.PushString(tname)
+	self.SetField(-2, "__name") // mt.__name = tname
+	self.PushValue(-1)
+	self.SetField(LUA_REGISTRYINDEX, tname) // registry[tname] = mt
+	return true
+}
+
+func (self *luaState) TestUdata(arg int, tname string) interface{} {
+	val := self.stack.get(arg)
+	if u, ok := val.(*userdata); ok && u.metatable != nil {
+		if mt, ok := self.registry.get(tname).(*luaTable); ok && mt == u.metatable {
+			return u.data
+		}
+	}
+	return nil
+}
+
+func (self *luaState) CheckUdata(arg int, tname string) interface{} {
+	data := self.TestUdata(arg, tname)
+	if data == nil {
+		self.TypeError(arg, tname)
+	}
+	return data
+}
+
+func (self *luaState) GetMetafield(obj int, e string) LuaType {
+	if !self.GetMetatable(obj) {
+		return LUA_TNIL // 没有元表
+	}
+	self.PushString(e)
+	tt := self.RawGet(-2)
+	if tt == LUA_TNIL {
+		self.Pop(2) // 元表里没有该字段，把nil和元表都弹出
+	} else {
+		self.Remove(-2) // 把元表弹出，只留下字段值
+	}
+	return tt
+}
+
+func (self *luaState) CallMeta(obj int, e string) bool {
+	obj = self.AbsIndex(obj)
+	if self.GetMetafield(obj, e) == LUA_TNIL {
+		return false
+	}
+	self.PushValue(obj)
+	self.Call(1, 1)
+	return true
+}
+
+/* 其他 */
+
+func (self *luaState) TypeName2(idx int) string {
+	return self.TypeName(self.Type(idx))
+}
+
+func (self *luaState) Len2(idx int) int64 {
+	self.Len(idx)
+	i, isNum := self.ToIntegerX(-1)
+	if !isNum {
+		self.Error2("object length is not an integer")
+	}
+	self.Pop(1)
+	return i
+}
+
+func (self *luaState) ToStringMeta(idx int) string {
+	idx = self.AbsIndex(idx)
+	if self.CallMeta(idx, "__tostring") {
+		if !self.IsString(-1) {
+			self.Error2("'__tostring' must return a string")
+		}
+	} else {
+		switch self.Type(idx) {
+		case LUA_TNUMBER, LUA_TSTRING:
+			self.PushValue(idx)
+		case LUA_TBOOLEAN:
+			if self.ToBoolean(idx) {
+				self.PushString("true")
+			} else {
+				self.PushString("false")
+			}
+		case LUA_TNIL:
+			self.PushString("nil")
+		default:
+			kind := self.TypeName2(idx)
+			if self.GetMetafield(idx, "__name") == LUA_TSTRING {
+				kind = self.ToString(-1)
+				self.Pop(1)
+			}
+			self.PushString(fmt.Sprintf("%s: %p", kind, self.stack.get(idx)))
+		}
+	}
+	return self.ToString(-1)
+}
+
+func (self *luaState) FileResult(err error, fname string) int {
+	if err == nil {
+		self.PushBoolean(true)
+		return 1
+	}
+	self.PushNil()
+	//*os.PathError等错误会带上操作名和文件名，只取最里面的原因（比如"no such file or directory"）
+	cause := err
+	for e := errors.Unwrap(cause); e != nil; e = errors.Unwrap(e) {
+		cause = e
+	}
+	msg := cause.Error()
+	if msg != "" { // 与C语言的strerror()保持一致，首字母大写
+		msg = strings.ToUpper(msg[:1]) + msg[1:]
+	}
+	if fname != "" {
+		self.PushString(fmt.Sprintf("%s: %s", fname, msg))
+	} else {
+		self.PushString(msg)
+	}
+	var errno syscall.Errno
+	errors.As(err, &errno)
+	self.PushInteger(int64(errno))
+	return 3
+}
+
+func (self *luaState) GetSubTable(idx int, fname string) bool {
+	if self.GetField(idx, fname) == LUA_TTABLE {
+		return true // 表已经存在
+	}
+	self.Pop(1)
+	idx = self.stack.absIndex(idx)
+	self.NewTable()
+	self.PushValue(-1)        // 复制一份新表
+	self.SetField(idx, fname) // t[fname] = 新表
+	return false
+}
+
+/*
+ *已经加载的模块记录在注册表的_LOADED表里（也就是package.loaded），
+ *如果模块还没有加载，则以模块名为参数调用openf，把返回值记录在_LOADED表里
+ */
+func (self *luaState) RequireF(modname string, openf GoFunction, glb bool) {
+	self.GetSubTable(LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	self.GetField(-1, modname) // LOADED[modname]
+	if !self.ToBoolean(-1) {   // 模块还没有加载？
+		self.Pop(1)
+		self.PushGoFunction(openf)
+		self.PushString(modname)   // 模块名作为openf的参数
+		self.Call(1, 1)            // 调用openf加载模块
+		self.PushValue(-1)         // 复制一份模块
+		self.SetField(-3, modname) // LOADED[modname] = 模块
+	}
+	self.Remove(-2) // 把_LOADED表弹出
+	if glb {
+		self.PushValue(-1)      // 复制一份模块
+		self.SetGlobal(modname) // _G[modname] = 模块
+	}
+}
+
+/*
+ *宿主注册的Go模块记录在注册表的_GOMODULES表里，require()找不到预加载函数和Lua文件时会在这里查找（见lib_package.go）
+ *与RequireF()不同，注册时并不会加载模块，只有脚本第一次require它的时候才会调用open
+ */
+func (self *luaState) RegisterModule(name string, open GoFunction) {
+	self.GetSubTable(LUA_REGISTRYINDEX, LUA_GOMODULES_TABLE)
+	self.PushGoFunction(open)
+	self.SetField(-2, name) // GOMODULES[name] = open
+	self.Pop(1)
+}
+
+//标准库，按照打开的顺序排列
+var loadedLibs = []struct {
+	name string
+	open GoFunction
+}{
+	{"_G", stdlib.OpenBase},
+	{"package", stdlib.OpenPackage},
+	{"coroutine", stdlib.OpenCoroutine},
+	{"table", stdlib.OpenTable},
+	{"io", stdlib.OpenIO},
+	{"os", stdlib.OpenOS},
+	{"string", stdlib.OpenString},
+	{"math", stdlib.OpenMath},
+	{"utf8", stdlib.OpenUTF8},
+	{"debug", stdlib.OpenDebug},
+}
+
+//打开全部标准库，每个库都记录在package.loaded里，同时设置为同名全局变量
+func (self *luaState) OpenLibs() {
+	for _, lib := range loadedLibs {
+		self.RequireF(lib.name, lib.open, true)
+		self.Pop(1)
+	}
+}
+
+func (self *luaState) NewLib(l FuncReg) {
+	self.NewLibTable(l)
+	self.SetFuncs(l, 0)
+}
+
+func (self *luaState) NewLibTable(l FuncReg) {
+	self.CreateTable(0, len(l))
+}
+
+//栈顶的nup个值会被复制给每一个函数作为Upvalue，表位于这些值的下面
+func (self *luaState) SetFuncs(l FuncReg, nup int) {
+	self.CheckStack(nup + 1)
+	for name, fun := range l {
+		for i := 0; i < nup; i++ {
+			self.PushValue(-nup)
+		}
+		self.PushGoClosure(fun, nup)
+		self.SetField(-(nup + 2), name)
+	}
+	self.Pop(nup)
+}
+
+/* 沙箱 */
+
+/*
+ *创建一个沙箱Lua解释器：先打开全部标准库（它们只记录在package.loaded里，脚本访问不到），
+ *然后按照profile创建新的全局环境，替换掉注册表里原来的全局环境
+ *整个解释器都是沙箱，所以还会保护字符串共享的元表（getmetatable("")返回false），否则脚本可以通过它修改别的脚本使用的字符串方法
+ */
+func NewSandbox(profile SandboxProfile) *luaState {
+	ls := New()
+	ls.OpenLibs()
+	ls.NewSandboxEnv(profile)
+	ls.RawSetI(LUA_REGISTRYINDEX, LUA_RIDX_GLOBALS)
+	ls.protectStringMetatable()
+	return ls
+}
+
+/*
+ *库表和全局环境都是新创建的，所以一个环境里的脚本修改了string.format之类的函数，也不会影响其他环境
+ *字符串共享的元表是整个解释器共享的，这里不会去动它（宿主自己的脚本可能要用），
+ *所以脚本仍然可以通过getmetatable("")修改别的脚本使用的字符串方法，要完全隔离请使用NewSandbox()
+ */
+func (self *luaState) NewSandboxEnv(profile SandboxProfile) {
+
+	self.CreateTable(0, len(profile["_G"])+len(profile))
+	env := self.GetTop()
+	self.GetSubTable(LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	for lib, names := range profile {
+		if self.GetField(-1, lib) != LUA_TTABLE { // 库没有打开
+			self.Pop(1)
+			continue
+		}
+		if lib == "_G" {
+			self.copySandboxFields(env, names, true, env)
+		} else {
+			self.CreateTable(0, len(names))
+			self.Insert(-2)
+			self.copySandboxFields(self.GetTop()-1, names, false, env)
+			self.SetField(env, lib) // env[lib] = 新的库表
+		}
+	}
+	self.Pop(1) // 弹出_LOADED表
+	self.PushValue(env)
+	self.SetField(env, "_G") // env._G = env
+}
+
+//给字符串共享的元表设置__metatable字段，让getmetatable()和setmetatable()都碰不到它
+func (self *luaState) protectStringMetatable() {
+	self.PushString("")
+	if self.GetMetatable(-1) {
+		self.PushBoolean(false)
+		self.SetField(-2, "__metatable")
+		self.Pop(1)
+	}
+	self.Pop(1)
+}
+
+/*
+ *把栈顶的库里允许使用的字段复制到dst处的表里，然后弹出库
+ *基础库里有受限版本的函数（见stdlib.SandboxFuncs）会换成受限版本，并以env处的沙箱环境为Upvalue
+ */
+func (self *luaState) copySandboxFields(dst int, names []string, isBase bool, env int) {
+	src := self.GetTop()
+	if names == nil {
+		self.PushNil()
+		for self.Next(src) {
+			if self.Type(-2) == LUA_TSTRING && !(isBase && self.Type(-1) == LUA_TTABLE) {
+				self.setSandboxField(dst, self.ToString(-2), isBase, env)
+			} else {
+				self.Pop(1)
+			}
+		}
+	} else {
+		for _, name := range names {
+			//基础库里的库表（比如"_G": {"string"}）也不能复制，否则沙箱里用的就是宿主的库表了，库要在profile里单独列出
+			if t := self.GetField(src, name); t == LUA_TNIL || (isBase && t == LUA_TTABLE) {
+				self.Pop(1)
+				continue
+			}
+			self.setSandboxField(dst, name, isBase, env)
+		}
+	}
+	self.Pop(1)
+}
+
+//从栈顶弹出一个值，设置为dst处的表的name字段，如果有受限版本的函数则用受限版本代替
+func (self *luaState) setSandboxField(dst int, name string, isBase bool, env int) {
+	if f, ok := stdlib.SandboxFuncs[name]; ok && isBase {
+		self.Pop(1)
+		self.PushValue(env)
+		self.PushGoClosure(f, 1)
+	}
+	self.SetField(dst, name)
+}
+
+/* 引用 */
+
+//引用表里的t[0]是空闲链表的表头，保存最近被释放的引用，被释放的引用处则保存下一个空闲的引用，链表以0结尾
+const _FREELIST = 0
+
+/*
+ *宿主往往需要在多次调用之间持有某个Lua值（比如按钮的onClick回调），
+ *引用系统把值存放在一个表（通常是注册表）里并返回其整数键，这样宿主只需要保存这个整数即可。
+ *被释放的引用会放进空闲链表，再次分配时优先复用，以免表无限增长
+ */
+func (self *luaState) Ref(t int) int {
+	if self.IsNil(-1) {
+		self.Pop(1)
+		return LUA_REFNIL // nil值不需要真正存放
+	}
+	t = self.AbsIndex(t)
+	self.RawGetI(t, _FREELIST)
+	ref := int(self.ToInteger(-1)) // ref = t[freelist]
+	self.Pop(1)
+	if ref != 0 {
+		//有空闲的引用，把它从空闲链表里摘下来：t[freelist] = t[ref]
+		self.RawGetI(t, int64(ref))
+		self.RawSetI(t, _FREELIST)
+	} else {
+		//没有空闲的引用，分配一个新的
+		ref = int(self.RawLen(t)) + 1
+	}
+	self.RawSetI(t, int64(ref)) // t[ref] = 栈顶的值
+	return ref
+}
+
+func (self *luaState) Unref(t, ref int) {
+	if ref < 0 {
+		return // LUA_NOREF和LUA_REFNIL都不需要释放
+	}
+	t = self.AbsIndex(t)
+	//把ref插入空闲链表的头部：t[ref] = t[freelist]; t[freelist] = ref
+	//链表的结尾保存0而不是nil，以免在数组部分中间制造空洞
+	self.RawGetI(t, _FREELIST)
+	next := self.ToInteger(-1)
+	self.Pop(1)
+	self.PushInteger(next)
+	self.RawSetI(t, int64(ref))
+	self.PushInteger(int64(ref))
+	self.RawSetI(t, _FREELIST)
+}
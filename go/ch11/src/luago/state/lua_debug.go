@@ -0,0 +1,366 @@
+/*
+ *调用帧的调试信息：当前行号、源文件名、函数名推断等
+ *这些信息全部来自函数原型里的调试信息（Source、LineInfo、LocVars、UpvalueNames）以及主调帧的PC
+ */
+package state
+
+import (
+	"fmt"
+	. "luago/api"
+	"luago/binchunk"
+	"luago/vm"
+	"sort"
+	"strings"
+)
+
+const LUA_IDSIZE = 60 //short_src的最大长度（包括结尾的'\0'，与官方实现保持一致）
+
+// 调用帧对应的函数类型："Lua"表示Lua函数，"main"表示主函数，"C"表示Go函数（为了与官方实现保持兼容，Go函数当作C函数汇报）
+func (self *luaStack) what() string {
+	return funcWhat(self.closure)
+}
+
+func funcWhat(c *closure) string {
+	if c.proto == nil {
+		return "C"
+	}
+	if c.proto.LineDefined == 0 {
+		return "main"
+	}
+	return "Lua"
+}
+
+// 调用帧对应的函数的源文件名（简短版本），Go函数统一为"[C]"
+func (self *luaStack) shortSrc() string {
+	if self.closure.proto == nil {
+		return "[C]"
+	}
+	return shortSrc(self.closure.proto.Source)
+}
+
+/*
+ *调用帧当前正在执行的指令所在的行号，如果是Go函数或者没有行号信息，返回-1
+ *由于Fetch()取出指令后会立刻把PC加1，所以正在执行的指令是pc-1处的那条
+ */
+func (self *luaStack) currentLine() int {
+	if self.closure == nil || self.closure.proto == nil {
+		return -1
+	}
+	return currentLine(self.closure.proto, self.pc-1)
+}
+
+// 调用帧当前正在执行的是不是op指令，Go函数的调用帧总是返回false
+func (self *luaStack) isExecuting(op int) bool {
+	if self.closure == nil || self.closure.proto == nil {
+		return false
+	}
+	pc := self.pc - 1
+	return pc >= 0 && pc < len(self.closure.proto.Code) && vm.Instruction(self.closure.proto.Code[pc]).Opcode() == op
+}
+
+func currentLine(proto *binchunk.Prototype, pc int) int {
+	if pc < 0 {
+		pc = 0
+	}
+	if pc < len(proto.LineInfo) {
+		return int(proto.LineInfo[pc])
+	}
+	return -1
+}
+
+/*
+ *Lua函数本身是没有名字的，函数名只能根据主调函数正在执行的指令来推断。
+ *比如主调帧正在执行CALL指令，那么就往前查找最后一次给被调函数所在寄存器赋值的指令，
+ *如果是GETTABUP _ENV "f"，说明被调函数是全局函数f；如果是SELF，说明是方法调用，依此类推。
+ *如果被调函数是由元方法触发的，那么名字就是元方法名，种类是"metamethod"
+ *返回值：name函数名，namewhat名字的种类（global、local、method、field、upvalue、constant、metamethod、for iterator），推断不出来则都为空
+ */
+func (self *luaStack) funcName() (name, namewhat string) {
+	if self.isTailCall {
+		//被尾调用的函数取代了原来的函数，原来的调用信息已经没有了（与官方实现一致）
+		return "", ""
+	}
+	caller := self.prev
+	if caller == nil || caller.closure == nil || caller.closure.proto == nil {
+		//主调帧是Go函数（或者没有主调帧），无从推断
+		return "", ""
+	}
+
+	proto := caller.closure.proto
+	pc := caller.pc - 1
+	if pc < 0 || pc >= len(proto.Code) {
+		return "", ""
+	}
+
+	i := vm.Instruction(proto.Code[pc])
+	switch op := i.Opcode(); op {
+	case vm.OP_CALL, vm.OP_TAILCALL:
+		a, _, _ := i.ABC()
+		return getObjName(proto, pc, a)
+	case vm.OP_TFORCALL:
+		return "for iterator", "for iterator"
+	case vm.OP_SELF, vm.OP_GETTABUP, vm.OP_GETTABLE:
+		return "index", "metamethod"
+	case vm.OP_SETTABUP, vm.OP_SETTABLE:
+		return "newindex", "metamethod"
+	case vm.OP_LEN:
+		return "len", "metamethod"
+	case vm.OP_CONCAT:
+		return "concat", "metamethod"
+	case vm.OP_EQ:
+		return "eq", "metamethod"
+	case vm.OP_LT:
+		return "lt", "metamethod"
+	case vm.OP_LE:
+		return "le", "metamethod"
+	default:
+		//算术和位运算指令与operators里的运算类型顺序一致
+		if op >= vm.OP_ADD && op <= vm.OP_BNOT {
+			return operators[op-vm.OP_ADD].metamethod[2:], "metamethod"
+		}
+	}
+	return "", ""
+}
+
+// 推断寄存器reg在第lastpc条指令处保存的值的名字
+func getObjName(proto *binchunk.Prototype, lastpc, reg int) (name, namewhat string) {
+	//如果寄存器是某个活跃的局部变量，直接用局部变量名
+	if name = localName(proto, reg+1, lastpc); name != "" {
+		return name, "local"
+	}
+
+	//否则找到最后一次给该寄存器赋值的指令，根据指令推断名字
+	pc := findSetReg(proto, lastpc, reg)
+	if pc == -1 {
+		return "", ""
+	}
+
+	i := vm.Instruction(proto.Code[pc])
+	switch i.Opcode() {
+	case vm.OP_MOVE:
+		a, b, _ := i.ABC()
+		if b < a {
+			//值是从别的寄存器拷贝过来的，继续推断源寄存器
+			return getObjName(proto, pc, b)
+		}
+	case vm.OP_GETTABUP:
+		_, b, c := i.ABC()
+		return rkName(proto, pc, c), tableKind(upvalName(proto, b))
+	case vm.OP_GETTABLE:
+		_, b, c := i.ABC()
+		return rkName(proto, pc, c), tableKind(localName(proto, b+1, pc))
+	case vm.OP_GETUPVAL:
+		_, b, _ := i.ABC()
+		return upvalName(proto, b), "upvalue"
+	case vm.OP_LOADK, vm.OP_LOADKX:
+		_, bx := i.ABx()
+		if i.Opcode() == vm.OP_LOADKX {
+			bx = vm.Instruction(proto.Code[pc+1]).Ax()
+		}
+		if s, ok := proto.Constants[bx].(string); ok {
+			return s, "constant"
+		}
+	case vm.OP_SELF:
+		_, _, c := i.ABC()
+		return rkName(proto, pc, c), "method"
+	}
+	return "", ""
+}
+
+// 如果表是_ENV，说明访问的是全局变量，否则就是普通的字段
+func tableKind(tableName string) string {
+	if tableName == "_ENV" {
+		return "global"
+	}
+	return "field"
+}
+
+// 获取RK操作数对应的名字，只有字符串常量才算名字
+func rkName(proto *binchunk.Prototype, pc, rk int) string {
+	if rk > 0xFF {
+		if s, ok := proto.Constants[rk&0xFF].(string); ok {
+			return s
+		}
+	} else if name, namewhat := getObjName(proto, pc, rk); namewhat == "constant" {
+		return name
+	}
+	return "?"
+}
+
+// 获取Upvalue的名字，如果调试信息被去掉了，返回"?"
+func upvalName(proto *binchunk.Prototype, idx int) string {
+	if idx < len(proto.UpvalueNames) {
+		return proto.UpvalueNames[idx]
+	}
+	return "?"
+}
+
+/*
+ *获取在第pc条指令处第n个（从1开始）活跃的局部变量的名字，找不到则返回空字符串
+ *局部变量表是按照作用域起始位置排序的，第n个活跃的局部变量恰好就位于第n-1个寄存器里
+ */
+func localName(proto *binchunk.Prototype, n, pc int) string {
+	for _, locVar := range proto.LocVars {
+		if int(locVar.StartPC) > pc {
+			break
+		}
+		if pc < int(locVar.EndPC) {
+			n--
+			if n == 0 {
+				return locVar.VarName
+			}
+		}
+	}
+	return ""
+}
+
+/*
+ *找到lastpc之前最后一次修改寄存器reg的指令，找不到则返回-1
+ *如果修改发生在某个跳转目标之前，那么执行流程可能并没有经过这条指令，这种情况下也返回-1
+ */
+func findSetReg(proto *binchunk.Prototype, lastpc, reg int) int {
+	setReg := -1
+	jmpTarget := 0
+	for pc := 0; pc < lastpc; pc++ {
+		i := vm.Instruction(proto.Code[pc])
+		a, b, _ := i.ABC()
+		change := false
+		switch i.Opcode() {
+		case vm.OP_LOADNIL:
+			change = a <= reg && reg <= a+b
+		case vm.OP_TFORCALL:
+			change = reg >= a+2
+		case vm.OP_CALL, vm.OP_TAILCALL:
+			change = reg >= a
+		case vm.OP_JMP:
+			_, sBx := i.AsBx()
+			dest := pc + 1 + sBx
+			if pc < dest && dest <= lastpc && dest > jmpTarget {
+				jmpTarget = dest
+			}
+		default:
+			change = i.TestAMode() && reg == a
+		}
+		if change {
+			if pc < jmpTarget {
+				setReg = -1
+			} else {
+				setReg = pc
+			}
+		}
+	}
+	return setReg
+}
+
+/*
+ *把源文件名转换成便于显示的简短版本，与官方的luaO_chunkid()逻辑一致
+ *"=stdin" -> "stdin"
+ *"@foo.lua" -> "foo.lua"（太长的话只保留尾部，前面用...代替）
+ *"print(1)" -> [string "print(1)"]（只保留第一行，太长的话尾部用...代替）
+ */
+func shortSrc(source string) string {
+	const retsLen = len("...")
+	bufLen := LUA_IDSIZE - 1
+
+	if strings.HasPrefix(source, "=") {
+		src := source[1:]
+		if len(src) > bufLen {
+			src = src[:bufLen]
+		}
+		return src
+	}
+
+	if strings.HasPrefix(source, "@") {
+		src := source[1:]
+		if len(src) > bufLen {
+			src = "..." + src[len(src)-bufLen+retsLen:]
+		}
+		return src
+	}
+
+	bufLen -= len(`[string "`) + retsLen + len(`"]`)
+	src := source
+	truncated := false
+	if nl := strings.IndexByte(src, '\n'); nl >= 0 {
+		src = src[:nl]
+		truncated = true
+	}
+	if len(src) > bufLen {
+		src = src[:bufLen]
+		truncated = true
+	}
+	if truncated {
+		return fmt.Sprintf(`[string "%s..."]`, src)
+	}
+	return fmt.Sprintf(`[string "%s"]`, src)
+}
+
+// 用于调用栈回溯的函数描述，比如"function 'print'"、"method 'draw'"、"main chunk"、"function <foo.lua:12>"
+func (self *luaStack) funcDescription() string {
+	name, namewhat := self.funcName()
+	if namewhat == "" && self.what() != "main" {
+		//调用指令推断不出名字时，再到已加载的模块里找
+		if name = self.state.globalFuncName(self.closure); name != "" {
+			namewhat = "global"
+		}
+	}
+	switch what := self.what(); {
+	case namewhat == "global":
+		return fmt.Sprintf("function '%s'", name)
+	case namewhat != "":
+		return fmt.Sprintf("%s '%s'", namewhat, name)
+	case what == "main":
+		return "main chunk"
+	case what == "Lua":
+		return fmt.Sprintf("function <%s:%d>", self.shortSrc(), self.closure.proto.LineDefined)
+	default:
+		return "?"
+	}
+}
+
+/*
+ *在已加载的模块（注册表的_LOADED表）里查找函数，找到的话返回"模块名.函数名"，
+ *全局函数（_G模块里的函数）则直接返回函数名。这样即使调用指令推断不出名字，也能给出有意义的函数名
+ *Go的map遍历顺序是随机的，所以先查_G，其他模块和字段都按名字排序后再查，保证同一个函数每次得到的名字都一样
+ */
+func (self *luaState) globalFuncName(c *closure) string {
+	loaded, ok := self.registry.get(LUA_LOADED_TABLE).(*luaTable)
+	if !ok {
+		return ""
+	}
+	if mod, ok := loaded.get("_G").(*luaTable); ok {
+		if name := fieldName(mod, c); name != "" {
+			return name
+		}
+	}
+	for _, modName := range sortedStringKeys(loaded) {
+		if mod, ok := loaded.get(modName).(*luaTable); ok && modName != "_G" {
+			if name := fieldName(mod, c); name != "" {
+				return modName + "." + name
+			}
+		}
+	}
+	return ""
+}
+
+// 按名字顺序查找表里值为c的字符串键，找不到返回空字符串
+func fieldName(t *luaTable, c *closure) string {
+	for _, name := range sortedStringKeys(t) {
+		if t.get(name) == c {
+			return name
+		}
+	}
+	return ""
+}
+
+// 返回表里全部字符串键（不包括数组部分），按字典序排好
+func sortedStringKeys(t *luaTable) []string {
+	var keys []string
+	for k := range t._map {
+		if name, ok := k.(string); ok {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
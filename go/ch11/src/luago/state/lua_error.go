@@ -0,0 +1,48 @@
+package state
+
+import (
+	"fmt"
+	. "luago/api"
+)
+
+/*
+ *Lua错误。Lua里的任何值都可以作为错误对象，
+ *抛出错误时以luaError为参数调用panic()，PCall()负责用recover()捕获并把错误对象交给主调方。
+ *用一个结构体把错误对象包装起来，是为了能和Go代码自身的panic区分开，同时还能带上错误码。
+ */
+type luaError struct {
+	status int      //错误码，比如LUA_ERRRUN、LUA_ERRMEM
+	value  luaValue //错误对象
+}
+
+// 实现error接口，这样错误一直没有被捕获、传到宿主那里时，也能得到可读的错误信息
+func (self *luaError) Error() string {
+	switch x := self.value.(type) {
+	case string:
+		return x
+	case int64, float64:
+		return fmt.Sprintf("%v", x)
+	case nil:
+		return "nil"
+	default:
+		return fmt.Sprintf("(error object is a %s value)", typeName(typeOf(x)))
+	}
+}
+
+/*
+ *把recover()得到的任意值转换成Lua错误。
+ *虚拟机内部有不少地方直接以字符串为参数调用panic()（比如"index error!"），
+ *这些字符串以及Go运行时错误都当作普通的运行时错误处理。
+ */
+func toLuaError(r interface{}) *luaError {
+	switch x := r.(type) {
+	case *luaError:
+		return x
+	case string:
+		return &luaError{LUA_ERRRUN, x}
+	case error:
+		return &luaError{LUA_ERRRUN, x.Error()}
+	default:
+		return &luaError{LUA_ERRRUN, fmt.Sprintf("%v", x)}
+	}
+}
@@ -0,0 +1,250 @@
+/*
+ *内存统计：Lua值的内存实际上由Go的垃圾回收器管理，我们只是估算Lua解释器占用了多少内存（相当于官方实现里的totalbytes）
+ *创建表、字符串、闭包、用户数据以及表变大时，调用allocate()把估算的字节数记到账上；
+ *但是对象什么时候被Go回收是不知道的，所以账上的数只会越来越大。为此，每当它超过上一次统计结果的gcPause%时，
+ *就从根对象（注册表和当前线程）出发遍历全部可以访问到的Lua值，重新统计存活对象的大小，这个过程就相当于Lua的一个回收周期
+ *对象的大小参考官方实现在64位平台上的数据结构大小，只是一个近似值
+ */
+package state
+
+import (
+	. "luago/api"
+	"luago/binchunk"
+	"math"
+	"runtime"
+)
+
+const (
+	_GCPAUSE        = 200       //默认的间歇率（与官方实现一致）
+	_GCSTEPMUL      = 200       //默认的步进倍率（与官方实现一致）
+	_GCMINTHRESHOLD = 64 * 1024 //自动统计的最低门槛，避免内存占用很小时频繁统计
+
+	_SIZE_STRING   = 25  //字符串的头部（加上结尾的'\0'）
+	_SIZE_TABLE    = 56  //表的头部
+	_SIZE_ARRSLOT  = 16  //表的数组部分的一个元素
+	_SIZE_NODE     = 32  //表的哈希部分的一个键值对
+	_SIZE_KEY      = 40  //表的哈希部分的一个遍历用的键（mapKeys里的键加上keyIdx里的位置）
+	_SIZE_LCLOSURE = 32  //Lua闭包的头部
+	_SIZE_GCLOSURE = 32  //Go闭包的头部
+	_SIZE_UPVAL    = 40  //一个Upvalue
+	_SIZE_UDATA    = 40  //用户数据的头部（包装的Go值的大小无从得知）
+	_SIZE_THREAD   = 200 //线程
+	_SIZE_FRAME    = 72  //一个调用帧
+	_SIZE_SLOT     = 16  //栈里的一个槽位
+	_SIZE_PROTO    = 120 //函数原型的头部
+
+	_SIZE_GOROUTINE = 8 * 1024 //协程的goroutine（主要是它的栈，运行Lua代码时栈会增长，只是一个估计）
+)
+
+// 字符串的估算大小
+func stringSize(s string) int {
+	return _SIZE_STRING + len(s)
+}
+
+// 表的估算大小：数组部分按照容量计算，哈希部分按照键值对的数量以及遍历用的键（包括被删除的键）的数量计算
+func (self *luaTable) size() int {
+	return _SIZE_TABLE + cap(self.arr)*_SIZE_ARRSLOT + len(self._map)*_SIZE_NODE + len(self.mapKeys)*_SIZE_KEY
+}
+
+// 估算put(key, val)会让表的大小增加多少（可能为负数），这样可以在写入之前检查内存上限
+func (self *luaTable) growth(key, val luaValue) int {
+	//删除键不会让表变大；nil和NaN不能作为键，put()会报错
+	if val == nil || key == nil {
+		return 0
+	}
+	if f, ok := key.(float64); ok && math.IsNaN(f) {
+		return 0
+	}
+	key = _floatToInteger(key)
+	_, inMap := self._map[key]
+	if idx, ok := key.(int64); ok && idx >= 1 {
+		arrLen := int64(len(self.arr))
+		if idx <= arrLen {
+			return 0
+		}
+		//追加到数组末尾：键（如果在哈希表里）以及随后的连续整数键从哈希表挪到数组里，数组可能需要扩容
+		if idx == arrLen+1 {
+			n := self._appendLen()
+			moved := n - len(self.arr) - 1
+			if inMap {
+				moved++
+			}
+			grown := -moved * _SIZE_NODE
+			if n > cap(self.arr) {
+				grown += (_growCap(cap(self.arr), n) - cap(self.arr)) * _SIZE_ARRSLOT
+			}
+			return grown
+		}
+	}
+	if inMap {
+		return 0
+	}
+	//被删除过的键还留在mapKeys里，新键则还要加到mapKeys里（可能先清理被删除的键，实际增加的只会更少）
+	if _, found := self.keyIdx[key]; found {
+		return _SIZE_NODE
+	}
+	return _SIZE_NODE + _SIZE_KEY
+}
+
+// 闭包的估算大小（不包括Upvalue和函数原型，它们可能是共享的）
+func (self *closure) size() int {
+	if self.proto != nil {
+		return _SIZE_LCLOSURE + len(self.upvals)*8
+	}
+	return _SIZE_GCLOSURE + len(self.upvals)*_SIZE_SLOT
+}
+
+// 函数原型的估算大小（不包括常量里的字符串和子函数原型）
+func protoSize(proto *binchunk.Prototype) int {
+	return _SIZE_PROTO + len(proto.Code)*4 + len(proto.Constants)*_SIZE_SLOT +
+		len(proto.Protos)*8 + len(proto.LineInfo)*4 + len(proto.LocVars)*16 + len(proto.Upvalues)*16
+}
+
+// 记账：新分配了n个字节（n为负数表示释放），账上的数超过门槛而且没有停止自动回收时，重新统计存活对象
+// 设置了内存上限的话，超过上限时会抛出内存错误（见checkMemory()）
+func (self *luaState) allocate(n int) {
+	if n > 0 {
+		self.checkMemory(n)
+	}
+	self.totalBytes += int64(n)
+	if self.gcRunning && self.totalBytes > self.gcThreshold() {
+		self.fullGC(false)
+	}
+}
+
+/*
+ *确保再分配n个字节之后不会超过内存上限，否则先紧急统计一次（账上的数里可能有很多已经不再使用的对象），
+ *仍然超过上限的话，抛出LUA_ERRMEM错误（与官方实现一样，错误对象是"not enough memory"，而且不会调用消息处理函数）
+ */
+func (self *luaState) checkMemory(n int) {
+	if self.memLimit <= 0 || self.totalBytes+int64(n) <= self.memLimit {
+		return
+	}
+	self.fullGC(false)
+	if self.totalBytes+int64(n) > self.memLimit {
+		panic(&luaError{LUA_ERRMEM, "not enough memory"})
+	}
+}
+
+// 触发自动统计的门槛：上一次统计结果的gcPause%
+func (self *luaState) gcThreshold() int64 {
+	threshold := self.gcEstimate / 100 * int64(self.gcPause)
+	if threshold < _GCMINTHRESHOLD {
+		threshold = _GCMINTHRESHOLD
+	}
+	return threshold
+}
+
+/*
+ *执行一个回收周期：重新统计存活对象的大小，作为新的内存占用
+ *forced为true时（collectgarbage("collect")）会先让Go执行一次垃圾回收，把Lua不再使用的对象真正释放掉
+ */
+func (self *luaState) fullGC(forced bool) {
+	if forced {
+		runtime.GC()
+	}
+	m := &gcMarker{seen: map[interface{}]bool{}}
+	m.mark(self.registry)
+	m.mark(self.mainThread)
+	m.mark(self)
+	m.propagate()
+	//协程的goroutine不会被Go回收（即使协程本身已经访问不到了），直到它运行结束或者被Close()杀死
+	m.total += int64(len(self.coroutines) * _SIZE_GOROUTINE)
+	self.gcEstimate = m.total
+	self.totalBytes = m.total
+}
+
+// 统计存活对象时使用的标记器，seen记录已经统计过的对象，gray是已经统计了自身但还没有遍历其引用的对象
+type gcMarker struct {
+	seen  map[interface{}]bool
+	gray  []interface{}
+	total int64
+}
+
+// 统计一个值（字符串按照内容去重，其他对象按照引用去重），需要遍历引用的对象放进gray
+func (self *gcMarker) mark(val luaValue) {
+	switch x := val.(type) {
+	case string:
+		if !self.seen[x] {
+			self.seen[x] = true
+			self.total += int64(stringSize(x))
+		}
+	case *luaTable, *closure, *userdata, *luaState:
+		if !self.seen[x] {
+			self.seen[x] = true
+			self.gray = append(self.gray, x)
+		}
+	}
+}
+
+// 依次遍历gray里的对象，直到没有新的对象为止
+func (self *gcMarker) propagate() {
+	for len(self.gray) > 0 {
+		obj := self.gray[len(self.gray)-1]
+		self.gray = self.gray[:len(self.gray)-1]
+		switch x := obj.(type) {
+		case *luaTable:
+			self.total += int64(x.size())
+			if x.metatable != nil {
+				self.mark(x.metatable)
+			}
+			for _, v := range x.arr {
+				self.mark(v)
+			}
+			for k, v := range x._map {
+				self.mark(k)
+				self.mark(v)
+			}
+			for _, k := range x.mapKeys {
+				self.mark(k) // 被删除的键也还被mapKeys引用着
+			}
+		case *closure:
+			self.total += int64(x.size())
+			if x.proto != nil {
+				self.markProto(x.proto)
+			}
+			for _, uv := range x.upvals {
+				if uv != nil && !self.seen[uv] {
+					self.seen[uv] = true
+					self.total += _SIZE_UPVAL
+					self.mark(*uv.val)
+				}
+			}
+		case *userdata:
+			self.total += _SIZE_UDATA
+			if x.metatable != nil {
+				self.mark(x.metatable)
+			}
+		case *luaState:
+			self.total += _SIZE_THREAD
+			for stack := x.stack; stack != nil; stack = stack.prev {
+				self.total += int64(_SIZE_FRAME + len(stack.slots)*_SIZE_SLOT)
+				for _, v := range stack.slots[:stack.top] {
+					self.mark(v)
+				}
+				for _, v := range stack.varargs {
+					self.mark(v)
+				}
+				if stack.closure != nil {
+					self.mark(stack.closure)
+				}
+			}
+		}
+	}
+}
+
+// 统计函数原型以及它的常量和子函数原型
+func (self *gcMarker) markProto(proto *binchunk.Prototype) {
+	if self.seen[proto] {
+		return
+	}
+	self.seen[proto] = true
+	self.total += int64(protoSize(proto))
+	self.mark(proto.Source)
+	for _, k := range proto.Constants {
+		self.mark(k)
+	}
+	for _, p := range proto.Protos {
+		self.markProto(p)
+	}
+}
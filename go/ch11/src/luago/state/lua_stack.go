@@ -29,7 +29,11 @@ type luaStack struct {
 	closure *closure         //闭包（函数原型）
 	varargs []luaValue       //变长参数列表
 	pc      int              //程序指令地址
+	oldPC   int              //上一次跟踪（行钩子）时执行的指令地址
 	openuvs map[int]*upvalue //key是寄存器索引，值是Upvalue指针
+	/* 尾调用（见callLuaClosure()） */
+	isTailCall bool //该帧的函数是不是被TAILCALL指令调用的
+	tailCalled bool //该帧的函数是不是用TAILCALL指令调用了别的Lua函数，是的话它返回时不再触发返回事件
 	/* 调用栈链接列表 */
 	prev *luaStack //调用帧的上一个调用帧
 }
@@ -43,9 +47,12 @@ func newLuaStack(size int, state *luaState) *luaStack {
 	}
 }
 
-//检查栈的剩余空间是否能够容纳至少n个值，如果不满足，就扩容
+//检查栈的剩余空间是否能够容纳至少n个值，如果不满足，就扩容（扩容的部分要记账，超过内存上限时抛出内存错误）
 func (self *luaStack) check(n int) {
 	free := len(self.slots) - self.top
+	if free < n {
+		self.state.allocate((n - free) * _SIZE_SLOT)
+	}
 	for i := free; i < n; i++ {
 		self.slots = append(self.slots, nil)
 	}
@@ -54,6 +61,9 @@ func (self *luaStack) check(n int) {
 //将值推入栈
 func (self *luaStack) push(val luaValue) {
 	if self.top == len(self.slots) {
+		if self.state.apiCheck {
+			apiCheckFailed("stack overflow (missing CheckStack?)")
+		}
 		panic("stack overflow! ")
 	}
 	self.slots[self.top] = val
@@ -129,6 +139,10 @@ func (self *luaStack) isValid(idx int) bool {
 
 //根据索引从栈里取值，如果索引无效则返回nil值
 func (self *luaStack) get(idx int) luaValue {
+	if self.state.apiCheck {
+		self.checkIndex(idx, false)
+	}
+
 	//如果索引是注册表伪索引，直接返回注册表
 	if idx == LUA_REGISTRYINDEX {
 		return self.state.registry
@@ -154,6 +168,10 @@ func (self *luaStack) get(idx int) luaValue {
 
 //根据索引往栈里写入值，如果索引无效，则调用panic()函数终止程序
 func (self *luaStack) set(idx int, val luaValue) {
+	if self.state.apiCheck {
+		self.checkIndex(idx, true)
+	}
+
 	//如果索引是注册表伪索引，直接修改注册表
 	if idx == LUA_REGISTRYINDEX {
 		self.state.registry = val.(*luaTable)
@@ -1,9 +1,16 @@
 package state
 
-import . "luago/api"
+import (
+	"context"
+	"io"
+	. "luago/api"
+)
 
-//Lua解释器
-type luaState struct {
+/*
+ *被同一个Lua解释器里的全部线程（协程）共享的状态（相当于官方实现里的global_State）
+ *每个线程都有自己的调用栈，但注册表、全局环境以及宿主的各种设置是大家共用的
+ */
+type globalState struct {
 	/*
 	 *Lua给用户提供了一个注册表，这个注册表实际上就是一个普通的Lua表，所以用户可以在里面存放任何Lua值。
 	 *有趣的是，这个注册表虽然是给用户准备的，但Lua本身也用到了它，比如说Lua全局变量就是借助这个注册表实现的。
@@ -15,11 +22,64 @@ type luaState struct {
 	 */
 	registry *luaTable
 
+	mainThread *luaState //主线程，也就是New()返回的那个
+
+	apiCheck bool //是否开启API检查模式，开启后每次API调用都会校验索引和栈空间（见api_check.go）
+
+	exitHook ExitHook //os.exit()的宿主钩子，为nil时直接结束进程（见api_host.go）
+
+	tracer Tracer //追踪器，为nil时不追踪（见api_trace.go）
+
+	coroutines map[*luaState]bool //goroutine还活着（正在运行或者挂起在Yield()里）的协程，Close()会杀死它们（见api_coroutine.go）
+
+	/* 内存统计（见lua_gc.go） */
+	totalBytes int64 //估算的内存占用：上一次统计的存活对象大小，加上之后新分配的大小
+	gcEstimate int64 //上一次统计的存活对象大小
+	gcRunning  bool  //是否自动统计，collectgarbage("stop")会关闭它
+	gcMode     int   //回收模式：LUA_GCINC或者LUA_GCGEN（只是记录下来，Go的垃圾回收器并不区分）
+	gcPause    int   //间歇率（百分比）：内存占用超过上一次统计结果的gcPause%时重新统计
+	gcStepMul  int   //步进倍率（百分比），只是记录下来
+	memLimit   int64 //内存上限（字节数），0表示不限制
+
+	/* 中断执行（见api_interrupt.go） */
+	ctx                context.Context //宿主设置的Context，被取消之后中断执行
+	instLimit          int64           //指令预算，0表示不限制
+	instCount          int64           //设置指令预算之后执行过的指令数
+	interruptCatchable bool            //中断错误能否被Lua代码捕获
+
+	//标准输入、输出和错误，为nil时使用进程的标准流（见api_host.go）
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+/*
+ *Lua解释器（线程）。嵌入的globalState是共享的，所以在任何一个线程上都可以直接访问注册表等全局状态
+ *Lua里的线程就是协程，协程之间并不会真正并发执行，任意时刻只有一个线程在运行（见api_coroutine.go）
+ */
+type luaState struct {
+	*globalState
+
 	/*
 	 *Lua栈（调用帧），在执行Lua函数时，Lua栈充当虚拟寄存器以供指令操作。
 	 *在调用Lua/Go函数时，Lua栈充当栈帧以供参数和返回值传递。
 	 */
 	stack *luaStack
+
+	/* 协程 */
+	status      int           //线程状态：LUA_OK（正常）、LUA_YIELD（挂起）或者错误码（因为出错而结束）
+	caller      *luaState     //最近一次恢复（resume）该协程的线程
+	resumeCh    chan struct{} //恢复者通过它通知挂起的协程继续运行
+	yieldCh     chan struct{} //协程通过它通知恢复者自己已经挂起或者结束
+	killed      bool          //协程被Close()杀死了，Yield()醒来之后要终止执行
+	checkFailed apiCheckError //协程里的API检查失败了，恢复者要把它重新抛出
+
+	/* 钩子（见api_debug.go），每个线程都有自己的钩子 */
+	hook          Hook //钩子函数
+	hookMask      int  //钩子事件掩码（LUA_MASKCALL等的组合）
+	baseHookCount int  //LUA_MASKCOUNT事件的间隔指令数
+	hookCount     int  //距离下一次LUA_MASKCOUNT事件还剩多少条指令
+	inHook        bool //是否正在执行钩子，执行钩子期间不会再触发钩子
 }
 
 func New() *luaState {
@@ -28,7 +88,19 @@ func New() *luaState {
 	//然后预先往里面放一个全局环境，所有的Lua全局变量都放在这个表里
 	registry.put(LUA_RIDX_GLOBALS, newLuaTable(0, 0))
 
-	ls := &luaState{registry: registry}
+	ls := &luaState{globalState: &globalState{
+		registry:  registry,
+		gcRunning: true,
+		gcMode:    LUA_GCINC,
+		gcPause:   _GCPAUSE,
+		gcStepMul: _GCSTEPMUL,
+
+		coroutines: map[*luaState]bool{},
+
+		interruptCatchable: true,
+	}}
+	ls.mainThread = ls
+	registry.put(LUA_RIDX_MAINTHREAD, ls)
 	//推入一个空的Lua栈（调用帧）
 	ls.pushLuaStack(newLuaStack(LUA_MINSTACK, ls))
 	return ls
@@ -40,11 +112,18 @@ func (self *luaState) pushLuaStack(stack *luaStack) {
 	//往栈顶推入一个调用帧相当于在链表头部插入一个节点，并让这个节点成为新的头部
 	stack.prev = self.stack
 	self.stack = stack
+	//最底层那个空的调用帧不对应任何函数，不需要追踪
+	if self.tracer != nil && stack.closure != nil {
+		self.tracer.PushFrame(self, &ActivationRecord{CallInfo: stack})
+	}
 }
 
 // 从栈顶弹出一个调用帧
 func (self *luaState) popLuaStack() {
 	stack := self.stack
+	if self.tracer != nil && stack.closure != nil {
+		self.tracer.PopFrame(self, &ActivationRecord{CallInfo: stack})
+	}
 	//将栈顶帧改为链接的上一个调用帧
 	self.stack = stack.prev
 	//原栈顶帧断开连接
@@ -24,6 +24,9 @@ type luaTable struct {
 	metatable *luaTable             //原表：每一个表都可以拥有自己的元表，其他值则是每种类型共享一个元表
 	arr       []luaValue            //数组
 	_map      map[luaValue]luaValue //哈希表：由于map是Go语言关键字，不能用来命名字段，所以加了下划线
+	mapKeys   []luaValue            //遍历表（next()）时使用的哈希表的键，按照加入的顺序排列，被删除的键也留在这里（见nextKey()）
+	keyIdx    map[luaValue]int      //键在mapKeys里的位置
+	arrMax    int                   //自上次整理mapKeys以来数组的最大长度，数组缩短之后，原来在数组里的键仍然可以用来继续遍历
 }
 
 // 该函数接受两个参数，用于预估表的用途和容量。
@@ -80,10 +83,18 @@ func (self *luaTable) put(key, val luaValue) {
 			//把原本存在哈希表里的某些值也挪到数组里
 			delete(self._map, key)
 			if val != nil {
-				//扩容追加到数组末尾
+				//扩容追加到数组末尾，容量不够时按照_growCap()扩容，这样表的大小在写入之前就能算出来（见growth()）
+				if n := self._appendLen(); n > cap(self.arr) {
+					arr := make([]luaValue, len(self.arr), _growCap(cap(self.arr), n))
+					copy(arr, self.arr)
+					self.arr = arr
+				}
 				self.arr = append(self.arr, val)
 				//重新调整Array，把之前放在Map里的，条件满足（key的值刚好是在Array尾部+1）的挪到Array里
 				self._expandArray()
+				if len(self.arr) > self.arrMax {
+					self.arrMax = len(self.arr)
+				}
 			}
 			return
 		}
@@ -94,7 +105,14 @@ func (self *luaTable) put(key, val luaValue) {
 			//由于在创建表的时候并不一定创建了哈希表部分，所以在第一次写入时，需要创建哈希表
 			self._map = make(map[luaValue]luaValue, 8)
 		}
+		n := len(self._map)
 		self._map[key] = val
+		//哈希表变大了说明是新键（只修改已有键的值时不需要额外的查找），被删除过的键还在mapKeys里，不用再加
+		if len(self._map) > n {
+			if _, found := self.keyIdx[key]; !found {
+				self._addKey(key)
+			}
+		}
 	} else {
 		delete(self._map, key)
 	}
@@ -126,6 +144,25 @@ func (self *luaTable) _shrinkArray() {
 	}
 }
 
+// 往数组末尾追加一个元素之后数组的长度，包括随后从哈希表挪到数组里的元素（见_expandArray()）
+func (self *luaTable) _appendLen() int {
+	n := len(self.arr) + 1
+	for {
+		if _, found := self._map[int64(n+1)]; !found {
+			return n
+		}
+		n++
+	}
+}
+
+// 数组需要放下n个元素时的新容量：至少翻倍，避免频繁扩容
+func _growCap(oldCap, n int) int {
+	if newCap := oldCap * 2; newCap > n {
+		return newCap
+	}
+	return n
+}
+
 /*
  *动态扩展数组，把存放在Map里的，且key是正整数，并且Key数值是在Array的当前容量之后的连续数据，从Map转为Array
  *比如当前的Array长度是5，Map里有{6:value, 7:value, 9:value}，则把6，7这两个数据挪到Array里
@@ -148,3 +185,63 @@ func (self *luaTable) hasMetafield(fieldName string) bool {
 	return self.metatable != nil &&
 		self.metatable.get(fieldName) != nil
 }
+
+/*
+ *返回表里key的下一个键，key为nil时返回第一个键，没有下一个键时返回nil。
+ *Go语言的map遍历顺序是随机的，而且无法从某个键继续遍历，所以先遍历数组部分，再按照mapKeys的顺序遍历哈希表部分。
+ *被删除的键（包括从哈希表挪到数组里的键）仍然留在mapKeys里，所以遍历过程中给已有的键赋值（包括赋值为nil），
+ *或者在遍历过程中再开始一次遍历都是允许的；只有增加新键时才会整理mapKeys（见_addKey()），这与Lua的规定一致
+ */
+func (self *luaTable) nextKey(key luaValue) luaValue {
+	i, j := 0, 0 // 接下来从数组的第i个元素、mapKeys的第j个键开始查找
+	if key = _floatToInteger(key); key != nil {
+		idx, isInt := key.(int64)
+		if isInt && idx >= 1 && idx <= int64(len(self.arr)) {
+			i = int(idx)
+		} else if pos, found := self.keyIdx[key]; found {
+			i, j = len(self.arr), pos+1
+		} else if isInt && idx >= 1 && idx <= int64(self.arrMax) {
+			i = len(self.arr) // 键原来在数组里，数组缩短之后它后面的元素都已经被删除了
+		} else {
+			panic("invalid key to 'next'")
+		}
+	}
+
+	for ; i < len(self.arr); i++ {
+		if self.arr[i] != nil {
+			return int64(i + 1)
+		}
+	}
+	for ; j < len(self.mapKeys); j++ {
+		if k := self.mapKeys[j]; self._map[k] != nil {
+			return k
+		}
+	}
+	return nil
+}
+
+/*
+ *把哈希表的新键加到mapKeys的末尾。被删除的键太多时先把它们清理掉（同时重新开始记录数组的最大长度），
+ *Lua规定遍历过程中不能增加新键，所以这时清理不会影响正在进行的遍历
+ */
+func (self *luaTable) _addKey(key luaValue) {
+	if len(self.mapKeys) >= 2*(len(self._map)-1)+8 { // 新键已经在哈希表里了
+		keys := make([]luaValue, 0, len(self._map))
+		for _, k := range self.mapKeys {
+			if _, found := self._map[k]; found {
+				keys = append(keys, k)
+			}
+		}
+		self.mapKeys = keys
+		self.keyIdx = make(map[luaValue]int, cap(keys))
+		for pos, k := range keys {
+			self.keyIdx[k] = pos
+		}
+		self.arrMax = len(self.arr)
+	}
+	if self.keyIdx == nil {
+		self.keyIdx = make(map[luaValue]int, 8)
+	}
+	self.keyIdx[key] = len(self.mapKeys)
+	self.mapKeys = append(self.mapKeys, key)
+}
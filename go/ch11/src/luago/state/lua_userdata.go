@@ -0,0 +1,15 @@
+package state
+
+/*
+ *完全用户数据（full userdata）：由宿主创建、包装了任意Go值的Lua值，
+ *主要用来把Go对象（比如文件句柄）交给Lua脚本使用。Lua脚本无法直接访问其中的数据，只能通过元方法来操作它。
+ *和表一样，每个用户数据都可以拥有自己的元表。
+ */
+type userdata struct {
+	metatable *luaTable   //元表
+	data      interface{} //包装的Go值
+}
+
+func newUserdata(data interface{}) *userdata {
+	return &userdata{data: data}
+}
@@ -24,6 +24,12 @@ func typeOf(val luaValue) LuaType {
 		return LUA_TTABLE
 	case *closure:
 		return LUA_TFUNCTION
+	case *userdata:
+		return LUA_TUSERDATA
+	case *luaState:
+		return LUA_TTHREAD
+	case *upvalue: //Upvalue的唯一标识（见UpvalueId()）
+		return LUA_TLIGHTUSERDATA
 	default:
 		panic("todo! ")
 	}
@@ -79,13 +85,18 @@ func _stringToInteger(s string) (int64, bool) {
 	return 0, false
 }
 
-// 设置元表，如果是Table的话，直接设置，否则到注册表里设置共享元表
+// 设置元表，如果是Table（或者用户数据）的话，直接设置，否则到注册表里设置共享元表
 func setMetatable(val luaValue, mt *luaTable, ls *luaState) {
 	//如果是表的话，直接设置元表
 	if t, ok := val.(*luaTable); ok {
 		t.metatable = mt
 		return
 	}
+	//用户数据和表一样，每个都有自己的元表
+	if u, ok := val.(*userdata); ok {
+		u.metatable = mt
+		return
+	}
 	//虽然注册表也是一个普通的表，不过按照约定，下划线开头后跟大写字母的字段名是保留给Lua实现使用的，
 	//所以我们使用了“_MT1”这样的字段名，以免和用户（通过API）放在注册表里的数据产生冲突
 	key := fmt.Sprintf("_MT%d", typeOf(val))
@@ -93,11 +104,14 @@ func setMetatable(val luaValue, mt *luaTable, ls *luaState) {
 	ls.registry.put(key, mt)
 }
 
-// 获取元表，如果是Table的话，直接获取，否则到注册表里获取共享元表
+// 获取元表，如果是Table（或者用户数据）的话，直接获取，否则到注册表里获取共享元表
 func getMetatable(val luaValue, ls *luaState) *luaTable {
 	if t, ok := val.(*luaTable); ok {
 		return t.metatable
 	}
+	if u, ok := val.(*userdata); ok {
+		return u.metatable
+	}
 	key := fmt.Sprintf("_MT%d", typeOf(val))
 	if mt := ls.registry.get(key); mt != nil {
 		return mt.(*luaTable)
@@ -123,6 +137,7 @@ func callMetamethod(a, b luaValue, mmName string, ls *luaState) (luaValue, bool)
 	}
 
 	//如果任何一个操作数有对应元方法，则以两个操作数为参数调用元方法，将元方法调用结果和true返回
+	ls.traceMetamethod(mmName)
 	ls.stack.check(4)
 	//压入元方法
 	ls.stack.push(mm)
@@ -0,0 +1,438 @@
+/*
+ *基础库：print、pairs、pcall、tonumber等最常用的函数，全部直接注册在全局环境里
+ *所有函数都只通过api.LuaState接口操作Lua解释器
+ */
+package stdlib
+
+import (
+	"fmt"
+	"io"
+	. "luago/api"
+	"luago/number"
+	"strings"
+)
+
+var baseFuncs = FuncReg{
+	"assert":         baseAssert,
+	"collectgarbage": baseCollectGarbage,
+	"error":          baseError,
+	"getmetatable":   baseGetMetatable,
+	"ipairs":         baseIPairs,
+	"load":           baseLoad,
+	"loadfile":       baseLoadFile,
+	"dofile":         baseDoFile,
+	"next":           baseNext,
+	"pairs":          basePairs,
+	"pcall":          basePCall,
+	"print":          basePrint,
+	"rawequal":       baseRawEqual,
+	"rawget":         baseRawGet,
+	"rawlen":         baseRawLen,
+	"rawset":         baseRawSet,
+	"select":         baseSelect,
+	"setmetatable":   baseSetMetatable,
+	"tonumber":       baseToNumber,
+	"tostring":       baseToString,
+	"type":           baseType,
+	"xpcall":         baseXPCall,
+}
+
+// 打开基础库：把基础函数注册到全局环境里，并设置_G和_VERSION，返回全局环境
+func OpenBase(ls LuaState) int {
+	ls.PushGlobalTable()
+	ls.SetFuncs(baseFuncs, 0)
+	//_G._G = _G
+	ls.PushValue(-1)
+	ls.SetField(-2, "_G")
+	//_G._VERSION = "Lua 5.3"
+	ls.PushString("Lua 5.3")
+	ls.SetField(-2, "_VERSION")
+	return 1
+}
+
+// print (···)
+// 把所有参数按照tostring()的规则转换成字符串，以制表符分隔输出到（Lua解释器的）标准输出，最后换行
+func basePrint(ls LuaState) int {
+	n := ls.GetTop()
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		s := ls.ToStringMeta(i)
+		ls.Pop(1)
+		if i > 1 {
+			sb.WriteByte('\t')
+		}
+		sb.WriteString(s)
+	}
+	sb.WriteByte('\n')
+	io.WriteString(ls.Stdout(), sb.String())
+	return 0
+}
+
+// assert (v [, message])
+// 如果v为假（nil或者false），则以message（默认为"assertion failed!"）为错误对象抛出错误，否则返回全部参数
+func baseAssert(ls LuaState) int {
+	if ls.ToBoolean(1) {
+		return ls.GetTop() // 返回全部参数
+	}
+	ls.CheckAny(1)                     // 必须有参数
+	ls.Remove(1)                       // 把v移除
+	ls.PushString("assertion failed!") // 默认错误信息
+	ls.SetTop(1)                       // 只保留错误信息（有message的话就是message）
+	return baseError(ls)
+}
+
+// error (message [, level])
+// 抛出错误，如果message是字符串，则在前面加上第level层函数的位置信息（level为0时不加）
+func baseError(ls LuaState) int {
+	level := int(ls.OptInteger(2, 1))
+	ls.SetTop(1)
+	if ls.Type(1) == LUA_TSTRING && level > 0 {
+		ls.Where(level)
+		ls.PushValue(1)
+		ls.Concat(2)
+	}
+	return ls.Error()
+}
+
+// getmetatable (object)
+// 返回对象的元表，如果元表里有__metatable字段，则返回该字段的值
+func baseGetMetatable(ls LuaState) int {
+	ls.CheckAny(1)
+	if !ls.GetMetatable(1) {
+		ls.PushNil()
+		return 1 // 没有元表
+	}
+	ls.GetMetafield(1, "__metatable")
+	return 1 // 返回__metatable字段的值（如果有的话）或者元表
+}
+
+// setmetatable (table, metatable)
+// 设置表的元表（metatable为nil时清除元表），受保护（有__metatable字段）的元表不能修改，返回table
+func baseSetMetatable(ls LuaState) int {
+	t := ls.Type(2)
+	ls.CheckTable(1)
+	ls.ArgCheck(t == LUA_TNIL || t == LUA_TTABLE, 2, "nil or table expected")
+	if ls.GetMetafield(1, "__metatable") != LUA_TNIL {
+		return ls.Error2("cannot change a protected metatable")
+	}
+	ls.SetTop(2)
+	ls.SetMetatable(1)
+	return 1
+}
+
+// next (table [, index])
+// 返回表里index的下一个键及其值，index为nil时返回第一个键值对，遍历结束时返回nil
+func baseNext(ls LuaState) int {
+	ls.CheckTable(1)
+	ls.SetTop(2) // 如果没有index参数，则补一个nil
+	if ls.Next(1) {
+		return 2
+	}
+	ls.PushNil()
+	return 1
+}
+
+// pairs (t)
+// 如果t有__pairs元方法，则以t为参数调用它，返回它的前三个返回值；否则返回next, t, nil
+func basePairs(ls LuaState) int {
+	ls.CheckAny(1)
+	if ls.GetMetafield(1, "__pairs") == LUA_TNIL {
+		ls.PushGoFunction(baseNext) // 迭代器
+		ls.PushValue(1)             // 不变状态
+		ls.PushNil()                // 控制变量初始值
+	} else {
+		ls.PushValue(1)
+		ls.Call(1, 3)
+	}
+	return 3
+}
+
+// ipairs (t)
+// 返回迭代器函数、t和0，用于按顺序遍历t[1]、t[2]...直到遇到第一个nil值（会触发__index元方法）
+func baseIPairs(ls LuaState) int {
+	ls.CheckAny(1)
+	ls.PushGoFunction(_iPairsAux) // 迭代器
+	ls.PushValue(1)               // 不变状态
+	ls.PushInteger(0)             // 控制变量初始值
+	return 3
+}
+
+func _iPairsAux(ls LuaState) int {
+	i := ls.CheckInteger(2) + 1
+	ls.PushInteger(i)
+	if ls.GetI(1, i) == LUA_TNIL {
+		return 1
+	}
+	return 2
+}
+
+// pcall (f [, arg1, ···])
+// 以保护模式调用f，成功时返回true和f的全部返回值，失败时返回false和错误对象
+func basePCall(ls LuaState) int {
+	ls.CheckAny(1)
+	ls.PushBoolean(true) // 第一个返回值
+	ls.Insert(1)
+	status := ls.PCall(ls.GetTop()-2, LUA_MULTRET, 0)
+	return _finishPCall(ls, status, 0)
+}
+
+// xpcall (f, msgh [, arg1, ···])
+// 与pcall类似，只不过出错时会以错误对象为参数调用消息处理函数msgh，返回其结果
+func baseXPCall(ls LuaState) int {
+	n := ls.GetTop()
+	ls.CheckType(2, LUA_TFUNCTION) // 检查消息处理函数
+	ls.PushBoolean(true)           // 第一个返回值
+	ls.PushValue(1)                // 被调函数
+	ls.Rotate(3, 2)                // 把它们移到参数的下面：f, msgh, true, f, args...
+	status := ls.PCall(n-2, LUA_MULTRET, 2)
+	return _finishPCall(ls, status, 2)
+}
+
+// extra表示栈底额外的值（不作为返回值）的数量
+func _finishPCall(ls LuaState, status, extra int) int {
+	if status != LUA_OK {
+		ls.PushBoolean(false)
+		ls.PushValue(-2) // 错误对象
+		return 2         // 返回false和错误对象
+	}
+	return ls.GetTop() - extra // 返回true和全部返回值
+}
+
+// rawequal (v1, v2)
+func baseRawEqual(ls LuaState) int {
+	ls.CheckAny(1)
+	ls.CheckAny(2)
+	ls.PushBoolean(ls.RawEqual(1, 2))
+	return 1
+}
+
+// rawlen (v)
+func baseRawLen(ls LuaState) int {
+	t := ls.Type(1)
+	ls.ArgCheck(t == LUA_TTABLE || t == LUA_TSTRING, 1, "table or string expected")
+	ls.PushInteger(int64(ls.RawLen(1)))
+	return 1
+}
+
+// rawget (table, index)
+func baseRawGet(ls LuaState) int {
+	ls.CheckTable(1)
+	ls.CheckAny(2)
+	ls.SetTop(2)
+	ls.RawGet(1)
+	return 1
+}
+
+// rawset (table, index, value)
+func baseRawSet(ls LuaState) int {
+	ls.CheckTable(1)
+	ls.CheckAny(2)
+	ls.CheckAny(3)
+	ls.SetTop(3)
+	ls.RawSet(1)
+	return 1
+}
+
+// select (index, ···)
+// index为数字时返回第index个参数之后（包括它）的全部参数，负数表示从末尾开始数；index为"#"时返回参数总数
+func baseSelect(ls LuaState) int {
+	n := int64(ls.GetTop())
+	if ls.Type(1) == LUA_TSTRING && ls.CheckString(1) == "#" {
+		ls.PushInteger(n - 1)
+		return 1
+	}
+
+	i := ls.CheckInteger(1)
+	if i < 0 {
+		i = n + i
+	} else if i > n {
+		i = n
+	}
+	ls.ArgCheck(1 <= i, 1, "index out of range")
+	return int(n - i)
+}
+
+/*
+ *collectgarbage ([opt [, arg]])
+ *控制垃圾回收器，opt可以是：
+ *	"collect"（默认）：执行一次完整的回收；"stop"/"restart"：停止/重新开始自动回收；"isrunning"：自动回收是否开启
+ *	"count"：返回内存占用（以KB为单位的浮点数）以及它除以1024的余数（以字节为单位）
+ *	"step"：执行一步回收，完成了一个回收周期时返回true；"setpause"/"setstepmul"：设置间歇率/步进倍率，返回旧值
+ *	"incremental"/"generational"：切换回收模式（之后的参数是模式的参数），返回之前的模式
+ */
+func baseCollectGarbage(ls LuaState) int {
+	opt := ls.OptString(1, "collect")
+	arg := int(ls.OptInteger(2, 0))
+	switch opt {
+	case "collect":
+		ls.PushInteger(int64(ls.GC(LUA_GCCOLLECT, 0)))
+	case "stop":
+		ls.PushInteger(int64(ls.GC(LUA_GCSTOP, 0)))
+	case "restart":
+		ls.PushInteger(int64(ls.GC(LUA_GCRESTART, 0)))
+	case "count":
+		k := ls.GC(LUA_GCCOUNT, 0)
+		b := ls.GC(LUA_GCCOUNTB, 0)
+		ls.PushNumber(float64(k) + float64(b)/1024)
+		ls.PushInteger(int64(b))
+		return 2
+	case "step":
+		ls.PushBoolean(ls.GC(LUA_GCSTEP, arg) != 0)
+	case "setpause":
+		ls.PushInteger(int64(ls.GC(LUA_GCSETPAUSE, arg)))
+	case "setstepmul":
+		ls.PushInteger(int64(ls.GC(LUA_GCSETSTEPMUL, arg)))
+	case "isrunning":
+		ls.PushBoolean(ls.GC(LUA_GCISRUNNING, 0) != 0)
+	case "incremental", "generational":
+		mode := LUA_GCINC
+		if opt == "incremental" {
+			//参数依次是间歇率和步进倍率，0表示不修改
+			if arg != 0 {
+				ls.GC(LUA_GCSETPAUSE, arg)
+			}
+			if stepMul := int(ls.OptInteger(3, 0)); stepMul != 0 {
+				ls.GC(LUA_GCSETSTEPMUL, stepMul)
+			}
+		} else {
+			mode = LUA_GCGEN
+		}
+		if ls.GC(mode, 0) == LUA_GCINC {
+			ls.PushString("incremental")
+		} else {
+			ls.PushString("generational")
+		}
+	default:
+		return ls.ArgError(1, fmt.Sprintf("invalid option '%s'", opt))
+	}
+	return 1
+}
+
+// tostring (v)
+func baseToString(ls LuaState) int {
+	ls.CheckAny(1)
+	ls.ToStringMeta(1)
+	return 1
+}
+
+// type (v)
+func baseType(ls LuaState) int {
+	t := ls.Type(1)
+	ls.ArgCheck(t != LUA_TNONE, 1, "value expected")
+	ls.PushString(ls.TypeName(t))
+	return 1
+}
+
+// tonumber (e [, base])
+// 没有base时，把数字或者可以转换成数字的字符串转换成数字；有base时，e必须是字符串，按照base进制（2~36）解析成整数
+// 转换失败返回nil
+func baseToNumber(ls LuaState) int {
+	if ls.IsNoneOrNil(2) {
+		if ls.Type(1) == LUA_TNUMBER {
+			ls.SetTop(1) // 已经是数字了，原样返回
+			return 1
+		}
+		if ls.Type(1) == LUA_TSTRING && ls.StringToNumber(ls.ToString(1)) {
+			return 1
+		}
+		ls.CheckAny(1) // 转换失败，但是必须有参数
+	} else {
+		base := ls.CheckInteger(2)
+		ls.CheckType(1, LUA_TSTRING) // 有base时，不接受数字参数
+		s := ls.ToString(1)
+		ls.ArgCheck(2 <= base && base <= 36, 2, "base out of range")
+		if n, ok := number.ParseIntegerWithBase(s, base); ok {
+			ls.PushInteger(n)
+			return 1
+		}
+	}
+	ls.PushNil() // 不是数字
+	return 1
+}
+
+// load (chunk [, chunkname [, mode [, env]]])
+// 加载chunk（字符串或者返回字符串片段的函数），成功时返回主函数，失败时返回nil和错误信息
+// 如果提供了env参数，则用它作为主函数的第一个Upvalue（_ENV）
+func baseLoad(ls LuaState) int {
+	var status int
+	mode := ls.OptString(3, "bt")
+	env := 0 // env参数的索引，0表示没有
+	if !ls.IsNone(4) {
+		env = 4
+	}
+
+	var chunk, chunkName string
+	if ls.Type(1) == LUA_TSTRING {
+		chunk = ls.ToString(1)
+		chunkName = ls.OptString(2, chunk)
+	} else {
+		chunkName = ls.OptString(2, "=(load)")
+		ls.CheckType(1, LUA_TFUNCTION)
+		chunk = _readChunk(ls)
+	}
+	status = ls.LoadEnv([]byte(chunk), chunkName, mode, env)
+	return _loadAux(ls, status)
+}
+
+// 反复调用读取函数（第1个参数），把它返回的片段拼接起来，直到它返回nil或者空字符串
+func _readChunk(ls LuaState) string {
+	var sb strings.Builder
+	for {
+		ls.PushValue(1)
+		ls.Call(0, 1)
+		if ls.IsNil(-1) {
+			ls.Pop(1)
+			break
+		}
+		if ls.Type(-1) != LUA_TSTRING {
+			ls.Error2("reader function must return a string")
+		}
+		piece := ls.ToString(-1)
+		ls.Pop(1)
+		if piece == "" {
+			break
+		}
+		sb.WriteString(piece)
+	}
+	return sb.String()
+}
+
+func _loadAux(ls LuaState, status int) int {
+	if status == LUA_OK {
+		return 1
+	}
+	ls.PushNil()
+	ls.Insert(-2) // 把nil放在错误信息的前面
+	return 2
+}
+
+// loadfile ([filename [, mode [, env]]])
+func baseLoadFile(ls LuaState) int {
+	fname := ls.OptString(1, "")
+	mode := ls.OptString(2, "bt")
+	env := 0
+	if !ls.IsNone(3) {
+		env = 3
+	}
+	status := ls.LoadFileX(fname, mode)
+	if status == LUA_OK && env != 0 {
+		//与LoadEnv()一样，用env作为主函数的第一个Upvalue（_ENV）
+		ls.PushValue(env)
+		if _, ok := ls.SetUpvalue(-2, 1); !ok {
+			ls.Pop(1)
+		}
+	}
+	return _loadAux(ls, status)
+}
+
+// dofile ([filename])
+// 加载并执行文件，返回主函数的全部返回值，出错时直接抛出错误
+func baseDoFile(ls LuaState) int {
+	fname := ls.OptString(1, "")
+	ls.SetTop(1)
+	if ls.LoadFile(fname) != LUA_OK {
+		return ls.Error()
+	}
+	ls.Call(0, LUA_MULTRET)
+	return ls.GetTop() - 1
+}
@@ -0,0 +1,156 @@
+/*
+ *协程库：建立在线程API（NewThread、Resume、Yield等）之上，与官方实现（lcorolib.c）一致
+ *协程的状态有四种：suspended（挂起，包括还没启动）、running（正在运行）、
+ *normal（正在运行，但是恢复了另一个协程，在等它挂起或者结束）、dead（运行结束或者出错）
+ */
+package stdlib
+
+import (
+	. "luago/api"
+)
+
+var coFuncs = FuncReg{
+	"create":      coCreate,
+	"resume":      coResume,
+	"running":     coRunning,
+	"status":      coStatus,
+	"wrap":        coWrap,
+	"yield":       coYield,
+	"isyieldable": coYieldable,
+}
+
+// 打开协程库，返回coroutine表
+func OpenCoroutine(ls LuaState) int {
+	ls.NewLib(coFuncs)
+	return 1
+}
+
+// 确保第1个参数是协程，并返回该协程
+func _getCo(ls LuaState) LuaState {
+	co := ls.ToThread(1)
+	ls.ArgCheck(co != nil, 1, "coroutine expected")
+	return co
+}
+
+/*
+ *恢复协程co，参数是栈顶的nArg个值，返回结果的数量（结果留在栈顶）
+ *出错时返回-1，错误对象留在栈顶
+ */
+func _auxResume(ls, co LuaState, nArg int) int {
+	if !co.CheckStack(nArg) {
+		ls.PushString("too many arguments to resume")
+		return -1
+	}
+	if co.Status() == LUA_OK && co.GetTop() == 0 {
+		ls.PushString("cannot resume dead coroutine")
+		return -1
+	}
+	ls.XMove(co, nArg)
+	status := co.Resume(ls, nArg)
+	if status == LUA_OK || status == LUA_YIELD {
+		nRes := co.GetTop()
+		if !ls.CheckStack(nRes + 1) {
+			co.Pop(nRes) // 结果放不下，扔掉
+			ls.PushString("too many results to resume")
+			return -1
+		}
+		co.XMove(ls, nRes) // 把挂起时传出来的值（或者返回值）移动过来
+		return nRes
+	}
+	co.XMove(ls, 1) // 把错误对象移动过来
+	return -1
+}
+
+// coroutine.resume (co [, val1, ···])
+// 启动或者继续运行协程co，成功时返回true以及传给yield的值（或者主函数的返回值），出错时返回false和错误对象
+func coResume(ls LuaState) int {
+	co := _getCo(ls)
+	r := _auxResume(ls, co, ls.GetTop()-1)
+	if r < 0 {
+		ls.PushBoolean(false)
+		ls.Insert(-2)
+		return 2 // 返回false和错误对象
+	}
+	ls.PushBoolean(true)
+	ls.Insert(-(r + 1))
+	return r + 1 // 返回true和resume的结果
+}
+
+// coroutine.wrap返回的函数：恢复协程，出错时把错误传播给调用者
+func _auxWrap(ls LuaState) int {
+	co := ls.ToThread(LuaUpvalueIndex(1))
+	r := _auxResume(ls, co, ls.GetTop())
+	if r < 0 {
+		if ls.Type(-1) == LUA_TSTRING { // 错误对象是字符串？
+			ls.Where(1) // 加上位置信息
+			ls.Insert(-2)
+			ls.Concat(2)
+		}
+		return ls.Error() // 传播错误
+	}
+	return r
+}
+
+// coroutine.create (f)
+// 以函数f为主函数创建一个新协程，返回该协程
+func coCreate(ls LuaState) int {
+	ls.CheckType(1, LUA_TFUNCTION)
+	nl := ls.NewThread()
+	ls.PushValue(1) // 把主函数移动到新协程里
+	ls.XMove(nl, 1)
+	return 1
+}
+
+// coroutine.wrap (f)
+// 以函数f为主函数创建一个新协程，返回一个函数，每次调用这个函数都会恢复协程，出错时错误会传播给调用者
+func coWrap(ls LuaState) int {
+	coCreate(ls)
+	ls.PushGoClosure(_auxWrap, 1)
+	return 1
+}
+
+// coroutine.yield (···)
+// 挂起正在运行的协程，参数会作为resume的结果，协程再次被恢复时，resume的参数会作为yield的返回值
+func coYield(ls LuaState) int {
+	return ls.Yield(ls.GetTop())
+}
+
+// coroutine.status (co)
+// 以字符串的形式返回协程co的状态："running"、"suspended"、"normal"或者"dead"
+func coStatus(ls LuaState) int {
+	co := _getCo(ls)
+	if ls == co {
+		ls.PushString("running")
+	} else {
+		switch co.Status() {
+		case LUA_YIELD:
+			ls.PushString("suspended")
+		case LUA_OK:
+			if co.HasFrames() { // 有正在执行的函数，说明它恢复了别的协程
+				ls.PushString("normal")
+			} else if co.GetTop() == 0 {
+				ls.PushString("dead")
+			} else {
+				ls.PushString("suspended") // 还没启动
+			}
+		default: // 出错了
+			ls.PushString("dead")
+		}
+	}
+	return 1
+}
+
+// coroutine.isyieldable ()
+// 正在运行的协程可以挂起时返回true（主线程不能挂起）
+func coYieldable(ls LuaState) int {
+	ls.PushBoolean(ls.IsYieldable())
+	return 1
+}
+
+// coroutine.running ()
+// 返回正在运行的协程，以及一个表示它是不是主线程的布尔值
+func coRunning(ls LuaState) int {
+	isMain := ls.PushThread()
+	ls.PushBoolean(isMain)
+	return 2
+}
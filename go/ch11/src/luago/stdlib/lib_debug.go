@@ -0,0 +1,411 @@
+/*
+ *调试库：与官方实现（ldblib.c）一致，完全建立在调试API（GetStack、GetInfo、GetLocal、SetHook等）之上
+ *大部分函数的第一个参数都可以是一个线程，表示操作的是该线程的调用栈，省略时操作的是当前线程
+ *注意：调试库会绕过Lua的很多限制（比如访问局部变量、修改元表），不应该开放给不受信任的脚本
+ */
+package stdlib
+
+import (
+	. "luago/api"
+	"reflect"
+	"strings"
+)
+
+// 注册表里记录每个线程的Lua钩子函数的表
+const _HOOKKEY = "_HKEY"
+
+var dbLib = FuncReg{
+	"gethook":      dbGetHook,
+	"getinfo":      dbGetInfo,
+	"getlocal":     dbGetLocal,
+	"getregistry":  dbGetRegistry,
+	"getmetatable": dbGetMetatable,
+	"getupvalue":   dbGetUpvalue,
+	"upvaluejoin":  dbUpvalueJoin,
+	"upvalueid":    dbUpvalueId,
+	"sethook":      dbSetHook,
+	"setlocal":     dbSetLocal,
+	"setmetatable": dbSetMetatable,
+	"setupvalue":   dbSetUpvalue,
+	"traceback":    dbTraceback,
+}
+
+// 钩子事件的名字，与LUA_HOOKCALL等一一对应
+var hookNames = []string{"call", "return", "line", "count", "tail call"}
+
+// 打开调试库，返回debug表
+func OpenDebug(ls LuaState) int {
+	ls.NewLib(dbLib)
+	return 1
+}
+
+// 如果第1个参数是线程，返回该线程和1（其他参数要往后挪一个位置），否则返回当前线程和0
+func _getThread(ls LuaState) (LuaState, int) {
+	if ls.Type(1) == LUA_TTHREAD {
+		return ls.ToThread(1), 1
+	}
+	return ls, 0
+}
+
+// 确保线程L1的栈里还能放下n个值（L1是当前线程时，由调用者自己负责）
+func _checkStack(ls, L1 LuaState, n int) {
+	if ls != L1 && !L1.CheckStack(n) {
+		ls.Error2("stack overflow")
+	}
+}
+
+// 把L1栈顶的值（GetInfo()推入的）移动到当前线程，并设置为栈顶下面那个表的fname字段
+func _treatStackOption(ls, L1 LuaState, fname string) {
+	if ls == L1 {
+		ls.Rotate(-2, 1) // 把值换到表的下面
+	} else {
+		L1.XMove(ls, 1) // 把值移动过来
+	}
+	ls.SetField(-2, fname)
+}
+
+// 把字符串推入栈顶，空字符串表示没有值，推入nil
+func _pushOptString(ls LuaState, s string) {
+	if s == "" {
+		ls.PushNil()
+	} else {
+		ls.PushString(s)
+	}
+}
+
+// debug.getregistry ()
+// 返回注册表
+func dbGetRegistry(ls LuaState) int {
+	ls.PushValue(LUA_REGISTRYINDEX)
+	return 1
+}
+
+// debug.getmetatable (value)
+// 返回value的元表，没有元表则返回nil（忽略__metatable字段）
+func dbGetMetatable(ls LuaState) int {
+	ls.CheckAny(1)
+	if !ls.GetMetatable(1) {
+		ls.PushNil()
+	}
+	return 1
+}
+
+// debug.setmetatable (value, table)
+// 把value的元表设置成table（可以是nil），返回value。与setmetatable()不同，value可以是任意类型，并且忽略__metatable字段
+func dbSetMetatable(ls LuaState) int {
+	t := ls.Type(2)
+	ls.ArgCheck(t == LUA_TNIL || t == LUA_TTABLE, 2, "nil or table expected")
+	ls.SetTop(2)
+	ls.SetMetatable(1)
+	return 1
+}
+
+/*
+ *debug.getinfo ([thread,] f [, what])
+ *返回一个描述函数的表，f可以是函数，也可以是调用栈的层数（0是getinfo自己，1是调用getinfo的函数，依此类推），
+ *层数超出调用栈深度时返回nil。what选择要填写哪些字段（默认为全部），字段的含义见ActivationRecord
+ */
+func dbGetInfo(ls LuaState) int {
+	L1, arg := _getThread(ls)
+	options := ls.OptString(arg+2, "flnStu")
+	_checkStack(ls, L1, 3)
+	var ar ActivationRecord
+	if ls.Type(arg+1) == LUA_TFUNCTION { // 描述的是函数？
+		options = ">" + options // GetInfo()会从栈顶弹出函数
+		ls.PushValue(arg + 1)
+		ls.XMove(L1, 1)
+	} else { // 描述的是调用栈的某一层
+		var ok bool
+		if ar, ok = L1.GetStack(int(ls.CheckInteger(arg + 1))); !ok {
+			ls.PushNil() // 层数超出范围
+			return 1
+		}
+	}
+	if !L1.GetInfo(options, &ar) {
+		return ls.ArgError(arg+2, "invalid option")
+	}
+
+	ls.CreateTable(0, 16)
+	if strings.ContainsRune(options, 'S') {
+		ls.PushString(ar.Source)
+		ls.SetField(-2, "source")
+		ls.PushString(ar.ShortSrc)
+		ls.SetField(-2, "short_src")
+		ls.PushInteger(int64(ar.LineDefined))
+		ls.SetField(-2, "linedefined")
+		ls.PushInteger(int64(ar.LastLineDefined))
+		ls.SetField(-2, "lastlinedefined")
+		ls.PushString(ar.What)
+		ls.SetField(-2, "what")
+	}
+	if strings.ContainsRune(options, 'l') {
+		ls.PushInteger(int64(ar.CurrentLine))
+		ls.SetField(-2, "currentline")
+	}
+	if strings.ContainsRune(options, 'u') {
+		ls.PushInteger(int64(ar.NUps))
+		ls.SetField(-2, "nups")
+		ls.PushInteger(int64(ar.NParams))
+		ls.SetField(-2, "nparams")
+		ls.PushBoolean(ar.IsVararg)
+		ls.SetField(-2, "isvararg")
+	}
+	if strings.ContainsRune(options, 'n') {
+		_pushOptString(ls, ar.Name)
+		ls.SetField(-2, "name")
+		_pushOptString(ls, ar.NameWhat)
+		ls.SetField(-2, "namewhat")
+	}
+	if strings.ContainsRune(options, 't') {
+		ls.PushBoolean(ar.IsTailCall)
+		ls.SetField(-2, "istailcall")
+	}
+	//GetInfo()先推入函数，再推入有效行号表
+	if strings.ContainsRune(options, 'L') {
+		_treatStackOption(ls, L1, "activelines")
+	}
+	if strings.ContainsRune(options, 'f') {
+		_treatStackOption(ls, L1, "func")
+	}
+	return 1
+}
+
+/*
+ *debug.getlocal ([thread,] f, local)
+ *返回第f层调用帧的第local个局部变量的名字和值（local为负数时是第-local个变长参数），不存在时返回nil，层数超出范围时抛出错误
+ *f也可以是函数，此时只返回第local个参数的名字
+ */
+func dbGetLocal(ls LuaState) int {
+	L1, arg := _getThread(ls)
+	nvar := int(ls.CheckInteger(arg + 2))
+	if ls.Type(arg+1) == LUA_TFUNCTION { // 非活动函数
+		ls.PushValue(arg + 1)
+		_pushOptString(ls, ls.GetLocal(nil, nvar))
+		return 1
+	}
+
+	ar, ok := L1.GetStack(int(ls.CheckInteger(arg + 1)))
+	if !ok {
+		return ls.ArgError(arg+1, "level out of range")
+	}
+	_checkStack(ls, L1, 1)
+	if name := L1.GetLocal(&ar, nvar); name != "" {
+		L1.XMove(ls, 1) // 把值移动过来
+		ls.PushString(name)
+		ls.Rotate(-2, 1) // 名字在前，值在后
+		return 2
+	}
+	ls.PushNil()
+	return 1
+}
+
+// debug.setlocal ([thread,] level, local, value)
+// 把第level层调用帧的第local个局部变量设置成value，返回变量名，不存在时返回nil
+func dbSetLocal(ls LuaState) int {
+	L1, arg := _getThread(ls)
+	ar, ok := L1.GetStack(int(ls.CheckInteger(arg + 1)))
+	if !ok {
+		return ls.ArgError(arg+1, "level out of range")
+	}
+	nvar := int(ls.CheckInteger(arg + 2))
+	ls.CheckAny(arg + 3)
+	ls.SetTop(arg + 3)
+	_checkStack(ls, L1, 1)
+	ls.XMove(L1, 1)
+	name := L1.SetLocal(&ar, nvar)
+	if name == "" {
+		L1.Pop(1) // 没有赋值，把值弹出
+	}
+	_pushOptString(ls, name)
+	return 1
+}
+
+// getupvalue和setupvalue的公共部分，get为true时返回名字和值，否则只返回名字
+func _auxUpvalue(ls LuaState, get bool) int {
+	n := int(ls.CheckInteger(2))
+	ls.CheckType(1, LUA_TFUNCTION)
+	var name string
+	var ok bool
+	if get {
+		name, ok = ls.GetUpvalue(1, n)
+	} else {
+		name, ok = ls.SetUpvalue(1, n)
+	}
+	if !ok {
+		return 0
+	}
+	ls.PushString(name)
+	if get {
+		ls.Insert(-2) // 名字在前，值在后
+		return 2
+	}
+	return 1
+}
+
+// debug.getupvalue (f, up)
+// 返回函数f的第up个Upvalue的名字和值，不存在时什么都不返回
+func dbGetUpvalue(ls LuaState) int {
+	return _auxUpvalue(ls, true)
+}
+
+// debug.setupvalue (f, up, value)
+// 把函数f的第up个Upvalue设置成value，返回Upvalue的名字，不存在时什么都不返回
+func dbSetUpvalue(ls LuaState) int {
+	ls.CheckAny(3)
+	return _auxUpvalue(ls, false)
+}
+
+// 确保argf处是函数，并且它有第argnup个参数指定的Upvalue，返回Upvalue的索引
+func _checkUpval(ls LuaState, argf, argnup int) int {
+	nup := int(ls.CheckInteger(argnup))
+	ls.CheckType(argf, LUA_TFUNCTION)
+	_, ok := ls.GetUpvalue(argf, nup)
+	ls.ArgCheck(ok, argnup, "invalid upvalue index")
+	ls.Pop(1)
+	return nup
+}
+
+// debug.upvalueid (f, n)
+// 返回函数f的第n个Upvalue的唯一标识（轻量用户数据），可以用来判断两个函数是否共享同一个Upvalue
+func dbUpvalueId(ls LuaState) int {
+	n := _checkUpval(ls, 1, 2)
+	ls.UpvalueId(1, n)
+	return 1
+}
+
+// debug.upvaluejoin (f1, n1, f2, n2)
+// 让Lua函数f1的第n1个Upvalue引用Lua函数f2的第n2个Upvalue
+func dbUpvalueJoin(ls LuaState) int {
+	n1 := _checkUpval(ls, 1, 2)
+	n2 := _checkUpval(ls, 3, 4)
+	ls.ArgCheck(!ls.IsGoFunction(1), 1, "Lua function expected")
+	ls.ArgCheck(!ls.IsGoFunction(3), 3, "Lua function expected")
+	ls.UpvalueJoin(1, n1, 3, n2)
+	return 0
+}
+
+// 调试库设置的钩子：到注册表里找到当前线程的Lua钩子函数，以事件名和行号（只有行事件才有）为参数调用它
+func _hookF(ls LuaState, ar *ActivationRecord) {
+	ls.GetField(LUA_REGISTRYINDEX, _HOOKKEY)
+	ls.PushThread()
+	if ls.RawGet(-2) == LUA_TFUNCTION {
+		ls.PushString(hookNames[ar.Event])
+		if ar.CurrentLine >= 0 {
+			ls.PushInteger(int64(ar.CurrentLine))
+		} else {
+			ls.PushNil()
+		}
+		ls.Call(2, 0)
+	}
+}
+
+// 把字符串形式的钩子掩码（"c"、"r"、"l"的组合）转换成LUA_MASKCALL等的组合，count大于0时加上LUA_MASKCOUNT
+func _makeMask(smask string, count int) int {
+	mask := 0
+	if strings.ContainsRune(smask, 'c') {
+		mask |= LUA_MASKCALL
+	}
+	if strings.ContainsRune(smask, 'r') {
+		mask |= LUA_MASKRET
+	}
+	if strings.ContainsRune(smask, 'l') {
+		mask |= LUA_MASKLINE
+	}
+	if count > 0 {
+		mask |= LUA_MASKCOUNT
+	}
+	return mask
+}
+
+// _makeMask()的逆操作
+func _unmakeMask(mask int) string {
+	var smask strings.Builder
+	if mask&LUA_MASKCALL != 0 {
+		smask.WriteByte('c')
+	}
+	if mask&LUA_MASKRET != 0 {
+		smask.WriteByte('r')
+	}
+	if mask&LUA_MASKLINE != 0 {
+		smask.WriteByte('l')
+	}
+	return smask.String()
+}
+
+/*
+ *debug.sethook ([thread,] hook, mask [, count])
+ *把hook设置为钩子函数，mask是"c"（调用函数）、"r"（函数返回）、"l"（新的一行）的组合，count大于0时每执行count条指令调用一次钩子
+ *钩子函数的第一个参数是事件名，行事件的第二个参数是行号。不带参数调用时关闭钩子
+ */
+func dbSetHook(ls LuaState) int {
+	L1, arg := _getThread(ls)
+	var hook Hook
+	mask, count := 0, 0
+	if ls.IsNoneOrNil(arg + 1) { // 关闭钩子
+		ls.SetTop(arg + 1)
+	} else {
+		smask := ls.CheckString(arg + 2)
+		ls.CheckType(arg+1, LUA_TFUNCTION)
+		count = int(ls.OptInteger(arg+3, 0))
+		hook, mask = _hookF, _makeMask(smask, count)
+	}
+	if !ls.GetSubTable(LUA_REGISTRYINDEX, _HOOKKEY) {
+		//新建的钩子表，键是线程，设置成弱键表
+		ls.PushString("k")
+		ls.SetField(-2, "__mode")
+		ls.PushValue(-1)
+		ls.SetMetatable(-2) // 钩子表的元表就是它自己
+	}
+	_checkStack(ls, L1, 1)
+	L1.PushThread()
+	L1.XMove(ls, 1)       // 键：线程
+	ls.PushValue(arg + 1) // 值：Lua钩子函数
+	ls.RawSet(-3)
+	L1.SetHook(hook, mask, count)
+	return 0
+}
+
+// debug.gethook ([thread])
+// 返回线程当前的钩子函数、钩子掩码和计数，钩子不是由调试库设置的时候，返回"external hook"
+func dbGetHook(ls LuaState) int {
+	L1, _ := _getThread(ls)
+	hook := L1.GetHook()
+	mask := L1.GetHookMask()
+	if hook == nil {
+		ls.PushNil()
+	} else if reflect.ValueOf(hook).Pointer() != reflect.ValueOf(_hookF).Pointer() {
+		ls.PushString("external hook")
+	} else {
+		ls.GetField(LUA_REGISTRYINDEX, _HOOKKEY)
+		_checkStack(ls, L1, 1)
+		L1.PushThread()
+		L1.XMove(ls, 1)
+		ls.RawGet(-2) // 钩子表[线程]
+		ls.Remove(-2)
+	}
+	ls.PushString(_unmakeMask(mask))
+	ls.PushInteger(int64(L1.GetHookCount()))
+	return 3
+}
+
+/*
+ *debug.traceback ([thread,] [message [, level]])
+ *返回调用栈回溯信息，message不是字符串（也不是nil）时原样返回message
+ *level表示从第几层开始回溯，当前线程默认为1（也就是调用traceback的函数），其他线程默认为0
+ */
+func dbTraceback(ls LuaState) int {
+	L1, arg := _getThread(ls)
+	msg, ok := ls.ToStringX(arg + 1)
+	if !ok && !ls.IsNoneOrNil(arg+1) {
+		ls.PushValue(arg + 1) // 原样返回
+		return 1
+	}
+	level := int64(0)
+	if ls == L1 {
+		level = 1
+	}
+	_checkStack(ls, L1, 1)
+	L1.Traceback(msg, int(ls.OptInteger(arg+2, level)))
+	L1.XMove(ls, 1)
+	return 1
+}
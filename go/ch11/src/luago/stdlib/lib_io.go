@@ -0,0 +1,545 @@
+/*
+ *输入输出库：文件句柄是元表为"FILE*"的用户数据，包装了一个luaStream
+ *io.stdin、io.stdout和io.stderr包装的是Lua解释器的标准输入输出（见LuaState.SetStdin()等），
+ *宿主程序可以把它们换成任意的io.Reader/io.Writer，比如在测试里捕获脚本的输出
+ */
+package stdlib
+
+import (
+	"fmt"
+	"io"
+	. "luago/api"
+	"os"
+)
+
+// 文件句柄的元表在注册表里的名字（相当于官方实现里的LUA_FILEHANDLE）
+const LUA_FILEHANDLE = "FILE*"
+
+// 默认输入和输出文件在注册表里的键
+const (
+	IO_INPUT  = "_IO_input"
+	IO_OUTPUT = "_IO_output"
+)
+
+// io.lines()和file:lines()最多可以有多少个读取格式
+const MAXARGLINE = 250
+
+var ioLib = FuncReg{
+	"close":   ioClose,
+	"flush":   ioFlush,
+	"input":   ioInput,
+	"lines":   ioLines,
+	"open":    ioOpen,
+	"output":  ioOutput,
+	"read":    ioRead,
+	"tmpfile": ioTmpFile,
+	"type":    ioType,
+	"write":   ioWrite,
+}
+
+// 文件句柄的方法
+var fileMethods = FuncReg{
+	"close":   fClose,
+	"flush":   fFlush,
+	"lines":   fLines,
+	"read":    fRead,
+	"seek":    fSeek,
+	"setvbuf": fSetvbuf,
+	"write":   fWrite,
+}
+
+/*
+ *文件句柄的元方法（__index是方法表，在创建元表时设置）
+ *这个解释器并不会调用__gc元方法，也不支持to-be-closed变量，所以没有注册__gc和__close：
+ *脚本没有关闭的文件由luaStream上的终结器（runtime.SetFinalizer()，见newFileStream()）在Go回收它时关闭
+ */
+var fileMetamethods = FuncReg{
+	"__tostring": fToString,
+}
+
+// 打开输入输出库，返回io表
+func OpenIO(ls LuaState) int {
+	ls.NewLib(ioLib)
+	_createMeta(ls)
+	//创建标准输入输出的文件句柄
+	_createStdFile(ls, 0, IO_INPUT, "stdin")
+	_createStdFile(ls, 1, IO_OUTPUT, "stdout")
+	_createStdFile(ls, 2, "", "stderr")
+	return 1
+}
+
+// 创建文件句柄的元表
+func _createMeta(ls LuaState) {
+	ls.NewMetatable(LUA_FILEHANDLE)
+	ls.SetFuncs(fileMetamethods, 0)
+	ls.NewLibTable(fileMethods)
+	ls.SetFuncs(fileMethods, 0)
+	ls.SetField(-2, "__index") // mt.__index = 方法表
+	ls.Pop(1)
+}
+
+// 创建标准输入输出的文件句柄，设置到io表（位于栈顶）里，k不为空时同时作为默认输入或者输出文件
+func _createStdFile(ls LuaState, which int, k, fname string) {
+	s := newStdStream(ls, which)
+	s.closeF = _ioNoClose
+	_pushStream(ls, s)
+	if k != "" {
+		ls.PushValue(-1)
+		ls.SetField(LUA_REGISTRYINDEX, k) // 作为默认输入或者输出文件
+	}
+	ls.SetField(-2, fname) // io[fname] = 文件句柄
+}
+
+// 把文件流包装成文件句柄推入栈顶
+func _pushStream(ls LuaState, s *luaStream) {
+	ls.NewUserdata(s)
+	ls.GetField(LUA_REGISTRYINDEX, LUA_FILEHANDLE)
+	ls.SetMetatable(-2)
+}
+
+// 标准输入输出不能关闭
+func _ioNoClose(ls LuaState, s *luaStream) int {
+	s.closeF = _ioNoClose // 保持打开状态
+	ls.PushNil()
+	ls.PushString("cannot close standard file")
+	return 2
+}
+
+// 关闭普通文件
+func _ioFClose(ls LuaState, s *luaStream) int {
+	return ls.FileResult(s.close(), "")
+}
+
+// 确保第1个参数是文件句柄，返回文件流
+func _toStream(ls LuaState) *luaStream {
+	return ls.CheckUdata(1, LUA_FILEHANDLE).(*luaStream)
+}
+
+// 确保第1个参数是没有关闭的文件句柄，返回文件流
+func _toFile(ls LuaState) *luaStream {
+	s := _toStream(ls)
+	if s.isClosed() {
+		ls.Error2("attempt to use a closed file")
+	}
+	return s
+}
+
+// 关闭栈顶的文件句柄
+func _auxClose(ls LuaState) int {
+	s := _toStream(ls)
+	cf := s.closeF
+	s.closeF = nil // 标记为已关闭
+	return cf(ls, s)
+}
+
+/*
+ *打开文件，mode与C语言的fopen()相同："r"、"w"、"a"，后面可以跟"+"，最后可以有任意个"b"
+ *成功时返回文件流，失败时返回错误
+ */
+func _openFile(fname, mode string) (*luaStream, error) {
+	flag := 0
+	readable, writable := false, false
+	switch mode[0] {
+	case 'r':
+		flag, readable = os.O_RDONLY, true
+	case 'w':
+		flag, writable = os.O_WRONLY|os.O_CREATE|os.O_TRUNC, true
+	case 'a':
+		flag, writable = os.O_WRONLY|os.O_CREATE|os.O_APPEND, true
+	}
+	if len(mode) > 1 && mode[1] == '+' { // 可读可写
+		flag = flag&^os.O_WRONLY | os.O_RDWR
+		readable, writable = true, true
+	}
+	f, err := os.OpenFile(fname, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	s := newFileStream(f, readable, writable)
+	s.closeF = _ioFClose
+	return s, nil
+}
+
+// 检查打开模式是否合法
+func _checkMode(mode string) bool {
+	if mode == "" || (mode[0] != 'r' && mode[0] != 'w' && mode[0] != 'a') {
+		return false
+	}
+	mode = mode[1:]
+	if mode != "" && mode[0] == '+' {
+		mode = mode[1:]
+	}
+	for i := 0; i < len(mode); i++ {
+		if mode[i] != 'b' {
+			return false
+		}
+	}
+	return true
+}
+
+// io.open (filename [, mode])
+// 按照指定的模式（默认为"r"）打开文件，成功时返回文件句柄，失败时返回nil、错误信息和错误码
+func ioOpen(ls LuaState) int {
+	filename := ls.CheckString(1)
+	mode := ls.OptString(2, "r")
+	ls.ArgCheck(_checkMode(mode), 2, "invalid mode")
+	s, err := _openFile(filename, mode)
+	if err != nil {
+		return ls.FileResult(err, filename)
+	}
+	_pushStream(ls, s)
+	return 1
+}
+
+// 打开文件并推入栈顶，失败时抛出错误
+func _openCheckFile(ls LuaState, fname, mode string) {
+	s, err := _openFile(fname, mode)
+	if err != nil {
+		ls.FileResult(err, "")
+		ls.Error2("cannot open file '%s' (%s)", fname, ls.ToString(-2))
+	}
+	_pushStream(ls, s)
+}
+
+// io.tmpfile ()
+// 以"w+"模式打开一个临时文件，文件关闭时会被删除
+func ioTmpFile(ls LuaState) int {
+	f, err := os.CreateTemp("", "lua_")
+	if err != nil {
+		return ls.FileResult(err, "")
+	}
+	s := newFileStream(f, true, true)
+	s.closeF = _ioFClose
+	s.tmpName = f.Name()
+	_pushStream(ls, s)
+	return 1
+}
+
+// io.type (obj)
+// obj是打开的文件句柄时返回"file"，是关闭的文件句柄时返回"closed file"，否则返回nil
+func ioType(ls LuaState) int {
+	ls.CheckAny(1)
+	if s, ok := ls.TestUdata(1, LUA_FILEHANDLE).(*luaStream); !ok {
+		ls.PushNil() // 不是文件句柄
+	} else if s.isClosed() {
+		ls.PushString("closed file")
+	} else {
+		ls.PushString("file")
+	}
+	return 1
+}
+
+// io.close ([file])
+// 相当于file:close()，没有参数时关闭默认输出文件
+func ioClose(ls LuaState) int {
+	if ls.IsNone(1) {
+		ls.GetField(LUA_REGISTRYINDEX, IO_OUTPUT) // 使用默认输出文件
+	}
+	return fClose(ls)
+}
+
+// file:close ()
+// 关闭文件，成功时返回true，失败时返回nil、错误信息和错误码。标准输入输出不能关闭
+func fClose(ls LuaState) int {
+	_toFile(ls) // 确保文件没有关闭
+	return _auxClose(ls)
+}
+
+// 文件句柄的__tostring元方法
+func fToString(ls LuaState) int {
+	if s := _toStream(ls); s.isClosed() {
+		ls.PushString("file (closed)")
+	} else {
+		ls.PushString(fmt.Sprintf("file (%p)", s))
+	}
+	return 1
+}
+
+// io.input和io.output的公共部分：设置并返回默认输入或者输出文件
+func _gIOFile(ls LuaState, f, mode string) int {
+	if !ls.IsNoneOrNil(1) {
+		if ls.Type(1) == LUA_TSTRING || ls.Type(1) == LUA_TNUMBER { // 文件名
+			_openCheckFile(ls, ls.ToString(1), mode)
+		} else {
+			_toFile(ls) // 确保是打开的文件句柄
+			ls.PushValue(1)
+		}
+		ls.SetField(LUA_REGISTRYINDEX, f)
+	}
+	ls.GetField(LUA_REGISTRYINDEX, f) // 返回当前的默认文件
+	return 1
+}
+
+// io.input ([file])
+// 以文件名调用时，以文本模式打开该文件并设置为默认输入文件；以文件句柄调用时，直接设置为默认输入文件
+// 返回当前的默认输入文件
+func ioInput(ls LuaState) int {
+	return _gIOFile(ls, IO_INPUT, "r")
+}
+
+// io.output ([file])
+// 与io.input类似，只不过设置的是默认输出文件（以"w"模式打开）
+func ioOutput(ls LuaState) int {
+	return _gIOFile(ls, IO_OUTPUT, "w")
+}
+
+// 把默认输入或者输出文件推入栈顶并返回文件流，文件已经关闭时抛出错误
+func _getIOFile(ls LuaState, findex string) *luaStream {
+	ls.GetField(LUA_REGISTRYINDEX, findex)
+	s := ls.ToUserdata(-1).(*luaStream)
+	if s.isClosed() {
+		ls.Error2("default %s file is closed", findex[len("_IO_"):])
+	}
+	return s
+}
+
+/*
+ *io.lines ([filename, ···])
+ *以读模式打开文件，返回一个迭代器，每次调用都按照给定的格式（默认为"l"）读取数据，到达文件末尾时返回nil并关闭文件
+ *没有文件名时使用默认输入文件，这时结束时不关闭文件
+ *与Lua 5.4一样，一共返回4个值，最后一个是文件句柄（作为泛型for的待关闭变量）
+ */
+func ioLines(ls LuaState) int {
+	if ls.IsNone(1) {
+		ls.PushNil() // 至少要有一个参数
+	}
+	toClose := false
+	if ls.IsNil(1) { // 没有文件名？
+		ls.GetField(LUA_REGISTRYINDEX, IO_INPUT) // 使用默认输入文件
+		ls.Replace(1)
+		_toFile(ls) // 确保文件没有关闭
+	} else { // 打开指定的文件
+		filename := ls.CheckString(1)
+		_openCheckFile(ls, filename, "r")
+		ls.Replace(1)
+		toClose = true // 迭代结束时关闭文件
+	}
+	_auxLines(ls, toClose)
+	if toClose {
+		ls.PushNil()
+		ls.PushNil()
+		ls.PushValue(1) // 文件句柄作为待关闭变量
+		return 4
+	}
+	return 1
+}
+
+// file:lines (···)
+// 返回一个迭代器，每次调用都按照给定的格式（默认为"l"）读取数据，与io.lines不同，迭代结束时不关闭文件
+func fLines(ls LuaState) int {
+	_toFile(ls) // 确保文件没有关闭
+	_auxLines(ls, false)
+	return 1
+}
+
+// 创建迭代器，文件句柄、读取格式的数量、是否关闭文件以及全部读取格式都作为它的Upvalue
+func _auxLines(ls LuaState, toClose bool) {
+	n := ls.GetTop() - 1 // 读取格式的数量
+	ls.ArgCheck(n <= MAXARGLINE, MAXARGLINE+2, "too many arguments")
+	ls.PushValue(1)
+	ls.PushInteger(int64(n))
+	ls.PushBoolean(toClose)
+	ls.Rotate(2, 3) // 把这3个值移动到读取格式的前面
+	ls.PushGoClosure(_ioReadLine, 3+n)
+}
+
+// io.lines和file:lines返回的迭代器
+func _ioReadLine(ls LuaState) int {
+	s := ls.ToUserdata(LuaUpvalueIndex(1)).(*luaStream)
+	n := int(ls.ToInteger(LuaUpvalueIndex(2)))
+	if s.isClosed() {
+		return ls.Error2("file is already closed")
+	}
+	ls.SetTop(1)
+	ls.CheckStack2(n, "too many arguments")
+	for i := 1; i <= n; i++ { // 推入读取格式
+		ls.PushValue(LuaUpvalueIndex(3 + i))
+	}
+	n = _gRead(ls, s, 2)
+	if ls.ToBoolean(-n) { // 至少读到了一个值？
+		return n
+	}
+	//第一个结果是nil：到达文件末尾或者出错
+	if n > 1 { // 有错误信息？
+		return ls.Error2("%s", ls.ToString(-n+1))
+	}
+	if ls.ToBoolean(LuaUpvalueIndex(3)) { // 需要关闭文件？
+		ls.SetTop(0)
+		ls.PushValue(LuaUpvalueIndex(1))
+		_auxClose(ls)
+	}
+	return 0
+}
+
+// io.read (···)
+// 相当于io.input():read(···)
+func ioRead(ls LuaState) int {
+	s := _getIOFile(ls, IO_INPUT)
+	ls.Pop(1)
+	return _gRead(ls, s, 1)
+}
+
+/*
+ *file:read (···)
+ *按照给定的格式读取文件，每种格式返回一个值，读取失败时返回nil（后面的格式不再读取）。格式包括：
+ *"n"：读取一个数字；"a"：读取剩下的全部内容；"l"：读取一行，去掉换行符（默认格式）；"L"：读取一行，保留换行符；
+ *整数：最多读取这么多个字节，为0时测试是否到达文件末尾。格式前面可以有一个"*"（与Lua 5.3以前的版本兼容）
+ */
+func fRead(ls LuaState) int {
+	return _gRead(ls, _toFile(ls), 2)
+}
+
+// io.read和file:read的公共部分，读取格式从first开始，返回结果的数量
+func _gRead(ls LuaState, s *luaStream, first int) int {
+	nargs := ls.GetTop() - first + 1
+	s.err = nil
+	var n int
+	success := s.prepareRead()
+	if !success {
+		ls.PushNil()
+		n = first + 1
+	} else if nargs == 0 { // 没有格式，读取一行
+		success = s.readLine(ls, true)
+		n = first + 1 // 返回一个结果
+	} else {
+		ls.CheckStack2(nargs+LUA_MINSTACK, "too many arguments")
+		for n = first; nargs > 0 && success; n++ {
+			nargs--
+			if ls.Type(n) == LUA_TNUMBER {
+				l := ls.CheckInteger(n)
+				if l == 0 {
+					success = s.testEOF(ls)
+				} else {
+					success = s.readChars(ls, l)
+				}
+			} else {
+				p := ls.CheckString(n)
+				if len(p) > 0 && p[0] == '*' {
+					p = p[1:] // 跳过可选的'*'
+				}
+				if p == "" {
+					return ls.ArgError(n, "invalid format")
+				}
+				switch p[0] {
+				case 'n': // 数字
+					success = s.readNumber(ls)
+				case 'l': // 一行，不要换行符
+					success = s.readLine(ls, true)
+				case 'L': // 一行，保留换行符
+					success = s.readLine(ls, false)
+				case 'a': // 全部内容
+					s.readAll(ls)
+					success = true
+				default:
+					return ls.ArgError(n, "invalid format")
+				}
+			}
+		}
+	}
+	if s.err != nil {
+		return ls.FileResult(s.err, "")
+	}
+	if !success {
+		ls.Pop(1) // 把最后一个结果换成nil
+		ls.PushNil()
+	}
+	return n - first
+}
+
+// io.write (···)
+// 相当于io.output():write(···)
+func ioWrite(ls LuaState) int {
+	return _gWrite(ls, _getIOFile(ls, IO_OUTPUT), 1)
+}
+
+// file:write (···)
+// 把每个参数（必须是字符串或者数字）写到文件里，成功时返回文件句柄，失败时返回nil、错误信息和错误码
+func fWrite(ls LuaState) int {
+	s := _toFile(ls)
+	ls.PushValue(1) // 文件句柄作为返回值
+	return _gWrite(ls, s, 2)
+}
+
+// io.write和file:write的公共部分，要写的值从arg开始，文件句柄位于栈顶
+func _gWrite(ls LuaState, s *luaStream, arg int) int {
+	nargs := ls.GetTop() - arg
+	status := true
+	s.err = nil
+	for ; nargs > 0; nargs, arg = nargs-1, arg+1 {
+		var str string
+		if ls.Type(arg) == LUA_TNUMBER {
+			//与官方实现一样，整数使用"%d"格式，浮点数使用"%.14g"格式
+			if ls.IsInteger(arg) {
+				str = fmt.Sprintf("%d", ls.ToInteger(arg))
+			} else {
+				str = _formatFloat(".14", 'g', ls.ToNumber(arg))
+			}
+		} else {
+			str = ls.CheckString(arg)
+		}
+		status = s.write(str) && status
+	}
+	if status {
+		return 1 // 文件句柄已经在栈顶了
+	}
+	return ls.FileResult(s.err, "")
+}
+
+// io.flush ()
+// 相当于io.output():flush()
+func ioFlush(ls LuaState) int {
+	return ls.FileResult(_getIOFile(ls, IO_OUTPUT).flush(), "")
+}
+
+// file:flush ()
+// 把写缓冲区里的数据写到文件里
+func fFlush(ls LuaState) int {
+	return ls.FileResult(_toFile(ls).flush(), "")
+}
+
+// file:seek ([whence [, offset]])
+// 把文件位置设置为从whence（"set"：文件开头，"cur"：当前位置，"end"：文件末尾，默认为"cur"）开始偏移offset（默认为0）的位置
+// 返回新的位置（从文件开头算起），失败时返回nil、错误信息和错误码
+func fSeek(ls LuaState) int {
+	s := _toFile(ls)
+	var whence int
+	switch ls.OptString(2, "cur") {
+	case "set":
+		whence = io.SeekStart
+	case "cur":
+		whence = io.SeekCurrent
+	case "end":
+		whence = io.SeekEnd
+	default:
+		return ls.ArgError(2, fmt.Sprintf("invalid option '%s'", ls.ToString(2)))
+	}
+	offset := ls.OptInteger(3, 0)
+	pos, err := s.seek(offset, whence)
+	if err != nil {
+		return ls.FileResult(err, "")
+	}
+	ls.PushInteger(pos)
+	return 1
+}
+
+// file:setvbuf (mode [, size])
+// 设置写缓冲模式（"no"：不缓冲，"full"：全缓冲，"line"：行缓冲）和缓冲区大小
+func fSetvbuf(ls LuaState) int {
+	s := _toFile(ls)
+	var mode int
+	switch ls.CheckString(2) {
+	case "no":
+		mode = BUF_NO
+	case "full":
+		mode = BUF_FULL
+	case "line":
+		mode = BUF_LINE
+	default:
+		return ls.ArgError(2, fmt.Sprintf("invalid option '%s'", ls.ToString(2)))
+	}
+	size := ls.OptInteger(3, LUAL_BUFFERSIZE)
+	if size <= 0 {
+		size = LUAL_BUFFERSIZE
+	}
+	return ls.FileResult(s.setvbuf(mode, int(size)), "")
+}
@@ -0,0 +1,354 @@
+/*
+ *数学库：与官方实现一样区分整数和浮点数，比如math.floor(3.7)返回整数3，math.abs(-3)返回整数3，
+ *而math.sqrt总是返回浮点数。随机数生成器使用Lua 5.4的xoshiro256**算法
+ */
+package stdlib
+
+import (
+	. "luago/api"
+	"luago/number"
+	"math"
+	"time"
+)
+
+var mathLib = FuncReg{
+	"abs":       mathAbs,
+	"ceil":      mathCeil,
+	"floor":     mathFloor,
+	"fmod":      mathFmod,
+	"modf":      mathModf,
+	"sqrt":      mathSqrt,
+	"exp":       mathExp,
+	"log":       mathLog,
+	"sin":       mathSin,
+	"cos":       mathCos,
+	"tan":       mathTan,
+	"asin":      mathAsin,
+	"acos":      mathAcos,
+	"atan":      mathAtan,
+	"tointeger": mathToInt,
+	"type":      mathType,
+	"ult":       mathUlt,
+	"max":       mathMax,
+	"min":       mathMin,
+}
+
+// 需要共享随机数生成器的函数，生成器作为它们的Upvalue
+var randFuncs = FuncReg{
+	"random":     mathRandom,
+	"randomseed": mathRandomSeed,
+}
+
+// 打开数学库，返回math表
+func OpenMath(ls LuaState) int {
+	ls.NewLib(mathLib)
+	ls.PushNumber(math.Pi)
+	ls.SetField(-2, "pi")
+	ls.PushNumber(math.Inf(1))
+	ls.SetField(-2, "huge")
+	ls.PushInteger(math.MaxInt64)
+	ls.SetField(-2, "maxinteger")
+	ls.PushInteger(math.MinInt64)
+	ls.SetField(-2, "mininteger")
+
+	//创建随机数生成器，用当前时间设置一个随机的种子
+	g := &xoshiro256{}
+	_randSeed(g)
+	ls.NewUserdata(g)
+	ls.SetFuncs(randFuncs, 1)
+	return 1
+}
+
+// math.abs (x)
+func mathAbs(ls LuaState) int {
+	if ls.IsInteger(1) {
+		n := ls.ToInteger(1)
+		if n < 0 {
+			n = -n // math.mininteger的绝对值还是它本身（溢出回绕）
+		}
+		ls.PushInteger(n)
+	} else {
+		ls.PushNumber(math.Abs(ls.CheckNumber(1)))
+	}
+	return 1
+}
+
+// math.ceil (x)
+// 返回不小于x的最小整数，结果能用整数表示时返回整数，否则返回浮点数
+func mathCeil(ls LuaState) int {
+	if ls.IsInteger(1) {
+		ls.SetTop(1) // 整数的上取整就是它本身
+	} else {
+		_pushNumInt(ls, math.Ceil(ls.CheckNumber(1)))
+	}
+	return 1
+}
+
+// math.floor (x)
+// 返回不大于x的最大整数，结果能用整数表示时返回整数，否则返回浮点数
+func mathFloor(ls LuaState) int {
+	if ls.IsInteger(1) {
+		ls.SetTop(1) // 整数的下取整就是它本身
+	} else {
+		_pushNumInt(ls, math.Floor(ls.CheckNumber(1)))
+	}
+	return 1
+}
+
+// 如果浮点数d能用整数表示，则推入整数，否则推入浮点数
+func _pushNumInt(ls LuaState, d float64) {
+	if i, ok := number.FloatToInteger(d); ok {
+		ls.PushInteger(i)
+	} else {
+		ls.PushNumber(d)
+	}
+}
+
+// math.fmod (x, y)
+// 返回x除以y的余数，商向零取整（与%运算符不同，%的商向负无穷取整）
+func mathFmod(ls LuaState) int {
+	if ls.IsInteger(1) && ls.IsInteger(2) {
+		d := ls.ToInteger(2)
+		if uint64(d)+1 <= 1 { // 特殊情况：d为0或者-1
+			ls.ArgCheck(d != 0, 2, "zero")
+			ls.PushInteger(0) // 避免math.mininteger % -1溢出
+		} else {
+			ls.PushInteger(ls.ToInteger(1) % d) // Go的%与C语言一样，商向零取整
+		}
+	} else {
+		ls.PushNumber(math.Mod(ls.CheckNumber(1), ls.CheckNumber(2)))
+	}
+	return 1
+}
+
+// math.modf (x)
+// 返回x的整数部分和小数部分，两个结果都是浮点数
+func mathModf(ls LuaState) int {
+	if ls.IsInteger(1) {
+		ls.SetTop(1)     // 整数部分就是它本身
+		ls.PushNumber(0) // 没有小数部分
+	} else {
+		n := ls.CheckNumber(1)
+		//整数部分（向零取整）
+		var ip float64
+		if n < 0 {
+			ip = math.Ceil(n)
+		} else {
+			ip = math.Floor(n)
+		}
+		ls.PushNumber(ip)
+		//小数部分（无穷大的小数部分是0）
+		if n == ip {
+			ls.PushNumber(0)
+		} else {
+			ls.PushNumber(n - ip)
+		}
+	}
+	return 2
+}
+
+// math.sqrt (x)
+func mathSqrt(ls LuaState) int {
+	ls.PushNumber(math.Sqrt(ls.CheckNumber(1)))
+	return 1
+}
+
+// math.exp (x)
+func mathExp(ls LuaState) int {
+	ls.PushNumber(math.Exp(ls.CheckNumber(1)))
+	return 1
+}
+
+// math.log (x [, base])
+// 返回以base（默认为e）为底x的对数
+func mathLog(ls LuaState) int {
+	x := ls.CheckNumber(1)
+	var res float64
+	if ls.IsNoneOrNil(2) {
+		res = math.Log(x)
+	} else {
+		switch base := ls.CheckNumber(2); base {
+		case 2:
+			res = math.Log2(x)
+		case 10:
+			res = math.Log10(x)
+		default:
+			res = math.Log(x) / math.Log(base)
+		}
+	}
+	ls.PushNumber(res)
+	return 1
+}
+
+// math.sin (x)
+func mathSin(ls LuaState) int {
+	ls.PushNumber(math.Sin(ls.CheckNumber(1)))
+	return 1
+}
+
+// math.cos (x)
+func mathCos(ls LuaState) int {
+	ls.PushNumber(math.Cos(ls.CheckNumber(1)))
+	return 1
+}
+
+// math.tan (x)
+func mathTan(ls LuaState) int {
+	ls.PushNumber(math.Tan(ls.CheckNumber(1)))
+	return 1
+}
+
+// math.asin (x)
+func mathAsin(ls LuaState) int {
+	ls.PushNumber(math.Asin(ls.CheckNumber(1)))
+	return 1
+}
+
+// math.acos (x)
+func mathAcos(ls LuaState) int {
+	ls.PushNumber(math.Acos(ls.CheckNumber(1)))
+	return 1
+}
+
+// math.atan (y [, x])
+// 返回y/x的反正切（根据两个参数的符号确定象限），x默认为1
+func mathAtan(ls LuaState) int {
+	y := ls.CheckNumber(1)
+	x := ls.OptNumber(2, 1)
+	ls.PushNumber(math.Atan2(y, x))
+	return 1
+}
+
+// math.tointeger (x)
+// 如果x可以转换成整数，返回该整数，否则返回nil
+func mathToInt(ls LuaState) int {
+	if i, ok := ls.ToIntegerX(1); ok {
+		ls.PushInteger(i)
+	} else {
+		ls.CheckAny(1)
+		ls.PushNil() // 不是整数
+	}
+	return 1
+}
+
+// math.type (x)
+// x是整数时返回"integer"，是浮点数时返回"float"，不是数字时返回nil
+func mathType(ls LuaState) int {
+	if ls.Type(1) == LUA_TNUMBER {
+		if ls.IsInteger(1) {
+			ls.PushString("integer")
+		} else {
+			ls.PushString("float")
+		}
+	} else {
+		ls.CheckAny(1)
+		ls.PushNil()
+	}
+	return 1
+}
+
+// math.ult (m, n)
+// 把m和n当作无符号整数比较，m < n时返回true
+func mathUlt(ls LuaState) int {
+	m := ls.CheckInteger(1)
+	n := ls.CheckInteger(2)
+	ls.PushBoolean(uint64(m) < uint64(n))
+	return 1
+}
+
+// math.max (x, ···)
+// 按照<运算符的规则返回最大的参数（保持参数原来的类型）
+func mathMax(ls LuaState) int {
+	n := ls.GetTop() // 参数数量
+	iMax := 1        // 最大值的索引
+	ls.ArgCheck(n >= 1, 1, "value expected")
+	ls.CheckNumber(1) // 参数必须都是数字（或者可以转换成数字的字符串）
+	for i := 2; i <= n; i++ {
+		ls.CheckNumber(i)
+		if ls.Compare(iMax, i, LUA_OPLT) {
+			iMax = i
+		}
+	}
+	ls.PushValue(iMax)
+	return 1
+}
+
+// math.min (x, ···)
+// 按照<运算符的规则返回最小的参数（保持参数原来的类型）
+func mathMin(ls LuaState) int {
+	n := ls.GetTop() // 参数数量
+	iMin := 1        // 最小值的索引
+	ls.ArgCheck(n >= 1, 1, "value expected")
+	ls.CheckNumber(1) // 参数必须都是数字（或者可以转换成数字的字符串）
+	for i := 2; i <= n; i++ {
+		ls.CheckNumber(i)
+		if ls.Compare(i, iMin, LUA_OPLT) {
+			iMin = i
+		}
+	}
+	ls.PushValue(iMin)
+	return 1
+}
+
+/*
+ *math.random ([m [, n]])
+ *没有参数时返回[0,1)之间的浮点数；
+ *只有参数m时返回[1,m]之间的整数，m为0时返回任意整数（全部比特都是随机的）；
+ *有参数m和n时返回[m,n]之间的整数
+ */
+func mathRandom(ls LuaState) int {
+	g := ls.ToUserdata(LuaUpvalueIndex(1)).(*xoshiro256)
+	rv := g.next() // 下一个随机数
+	var low, up int64
+	switch ls.GetTop() { // 检查参数数量
+	case 0:
+		ls.PushNumber(i2d(rv)) // 浮点数
+		return 1
+	case 1:
+		low = 1
+		up = ls.CheckInteger(1)
+		if up == 0 { // 整数
+			ls.PushInteger(int64(rv))
+			return 1
+		}
+	case 2:
+		low = ls.CheckInteger(1)
+		up = ls.CheckInteger(2)
+	default:
+		return ls.Error2("wrong number of arguments")
+	}
+
+	ls.ArgCheck(low <= up, 1, "interval is empty")
+	//把随机数投影到[0, up - low]区间，再加上low
+	ls.PushInteger(int64(g.project(rv, uint64(up)-uint64(low)) + uint64(low)))
+	return 1
+}
+
+/*
+ *math.randomseed ([x [, y]])
+ *用整数x和y（默认为0）设置随机数生成器的种子，相同的种子总是产生相同的随机数序列
+ *没有参数时使用一个随机的种子。返回实际使用的两个种子
+ */
+func mathRandomSeed(ls LuaState) int {
+	g := ls.ToUserdata(LuaUpvalueIndex(1)).(*xoshiro256)
+	var n1, n2 int64
+	if ls.IsNone(1) {
+		n1, n2 = _randSeed(g)
+	} else {
+		n1 = ls.CheckInteger(1)
+		n2 = ls.OptInteger(2, 0)
+		g.seed(uint64(n1), uint64(n2))
+	}
+	ls.PushInteger(n1)
+	ls.PushInteger(n2)
+	return 2
+}
+
+// 用当前时间设置一个随机的种子
+func _randSeed(g *xoshiro256) (n1, n2 int64) {
+	now := time.Now()
+	n1 = now.Unix()
+	n2 = int64(now.Nanosecond())
+	g.seed(uint64(n1), uint64(n2))
+	return
+}
@@ -0,0 +1,223 @@
+/*
+ *操作系统库：时间和日期、环境变量、文件删除和重命名、临时文件名以及退出程序
+ *os.exit()不会直接结束进程，而是交给Lua解释器的宿主钩子处理（见LuaState.SetExitHook()）
+ */
+package stdlib
+
+import (
+	"fmt"
+	. "luago/api"
+	"math"
+	"os"
+	"time"
+)
+
+var sysLib = FuncReg{
+	"clock":    osClock,
+	"date":     osDate,
+	"difftime": osDiffTime,
+	"exit":     osExit,
+	"getenv":   osGetEnv,
+	"remove":   osRemove,
+	"rename":   osRename,
+	"time":     osTime,
+	"tmpname":  osTmpName,
+}
+
+// 程序开始运行的时间，用于os.clock()
+var startTime = time.Now()
+
+// 打开操作系统库，返回os表
+func OpenOS(ls LuaState) int {
+	ls.NewLib(sysLib)
+	return 1
+}
+
+// os.clock ()
+// 返回程序运行以来的时间（以秒为单位的浮点数），通常用于测量代码的执行时间
+// Go没有可移植的获取进程CPU时间的方法，所以这里用的是程序开始运行以来经过的时间
+func osClock(ls LuaState) int {
+	ls.PushNumber(time.Since(startTime).Seconds())
+	return 1
+}
+
+// os.difftime (t2, t1)
+// 返回t2 - t1（以秒为单位的浮点数）
+func osDiffTime(ls LuaState) int {
+	t2 := _checkTime(ls, 1)
+	t1 := _checkTime(ls, 2)
+	ls.PushNumber(float64(t2 - t1))
+	return 1
+}
+
+func _checkTime(ls LuaState, arg int) int64 {
+	return ls.CheckInteger(arg)
+}
+
+/*
+ *os.time ([table])
+ *没有参数时返回当前时间；否则根据表里的字段（year、month、day必须有，hour默认为12，min和sec默认为0）计算时间
+ *字段的值可以超出正常范围（比如month为14，或者sec为-10），会被规范化，表里的字段也会被更新成规范化之后的值
+ */
+func osTime(ls LuaState) int {
+	var t time.Time
+	if ls.IsNoneOrNil(1) { // 没有参数，返回当前时间
+		t = time.Now()
+	} else {
+		ls.CheckType(1, LUA_TTABLE)
+		ls.SetTop(1) // 确保表位于栈顶
+		sec := _getField(ls, "sec", 0, 0)
+		min := _getField(ls, "min", 0, 0)
+		hour := _getField(ls, "hour", 12, 0)
+		day := _getField(ls, "day", -1, 0)
+		month := _getField(ls, "month", -1, 1)
+		year := _getField(ls, "year", -1, 1900)
+		//time.Date()会把超出范围的字段规范化，比如10月32日会变成11月1日
+		t = time.Date(year, time.Month(month), day, hour, min, sec, 0, time.Local)
+		_setAllFields(ls, t) // 用规范化之后的值更新表里的字段
+	}
+	ls.PushInteger(t.Unix())
+	return 1
+}
+
+/*
+ *读取表里的日期字段，d为默认值（小于0表示字段是必需的）
+ *与C语言的struct tm一样，year字段减去1900、month字段减去1之后必须在C语言int的范围内，delta就是要减去的值
+ */
+func _getField(ls LuaState, key string, d, delta int) int {
+	t := ls.GetField(-1, key)
+	res, ok := ls.ToIntegerX(-1)
+	if !ok { // 不是整数
+		if t != LUA_TNIL {
+			ls.Error2("field '%s' is not an integer", key)
+		} else if d < 0 {
+			ls.Error2("field '%s' missing in date table", key)
+		}
+		res = int64(d)
+	} else {
+		if !(res >= 0 && res-int64(delta) <= math.MaxInt32 ||
+			res < 0 && math.MinInt32+int64(delta) <= res) {
+			ls.Error2("field '%s' is out-of-bound", key)
+		}
+	}
+	ls.Pop(1)
+	return int(res)
+}
+
+// 把时间的各个字段设置到栈顶的表里
+func _setAllFields(ls LuaState, t time.Time) {
+	_setField(ls, "sec", t.Second())
+	_setField(ls, "min", t.Minute())
+	_setField(ls, "hour", t.Hour())
+	_setField(ls, "day", t.Day())
+	_setField(ls, "month", int(t.Month()))
+	_setField(ls, "year", t.Year())
+	_setField(ls, "wday", int(t.Weekday())+1) // 星期日是1
+	_setField(ls, "yday", t.YearDay())
+	ls.PushBoolean(t.IsDST())
+	ls.SetField(-2, "isdst")
+}
+
+func _setField(ls LuaState, key string, value int) {
+	ls.PushInteger(int64(value))
+	ls.SetField(-2, key)
+}
+
+/*
+ *os.date ([format [, time]])
+ *按照format（默认为"%c"）格式化时间time（默认为当前时间），格式与C语言的strftime()相同
+ *format以'!'开头时使用UTC时间，否则使用本地时间；format为"*t"时返回包含各个字段的表
+ */
+func osDate(ls LuaState) int {
+	s := ls.OptString(1, "%c")
+	var t time.Time
+	if ls.IsNoneOrNil(2) {
+		t = time.Now()
+	} else {
+		t = time.Unix(_checkTime(ls, 2), 0)
+	}
+
+	if len(s) > 0 && s[0] == '!' { // UTC时间
+		s = s[1:]
+		t = t.UTC()
+	} else {
+		t = t.Local()
+	}
+
+	if s == "*t" {
+		ls.CreateTable(0, 9) // 9个字段
+		_setAllFields(ls, t)
+		return 1
+	}
+
+	b := NewBuffer(ls)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.AddChar(s[i])
+			continue
+		}
+		i++ // 跳过'%'
+		n := checkStrftimeOption(s[i:])
+		if n == 0 {
+			ls.ArgError(1, fmt.Sprintf("invalid conversion specifier '%%%s'", s[i:]))
+		}
+		i += n - 1
+		b.AddString(strftime(s[i], t)) // E和O修饰符在"C"区域设置下没有作用
+	}
+	b.PushResult()
+	return 1
+}
+
+// os.exit ([code [, close]])
+// 请求结束程序，code为true时退出码为0，为false时为1，否则就是code本身（默认为0）
+// 实际的处理交给宿主钩子，钩子返回之后脚本的执行被终止（见LuaState.Exit()），os.exit()永远不会返回
+func osExit(ls LuaState) int {
+	var status int
+	if ls.IsBoolean(1) {
+		if !ls.ToBoolean(1) {
+			status = 1
+		}
+	} else {
+		status = int(ls.OptInteger(1, 0))
+	}
+	ls.Exit(status)
+	return 0 // 不会执行到这里
+}
+
+// os.getenv (varname)
+// 返回环境变量的值，如果没有定义，返回nil
+func osGetEnv(ls LuaState) int {
+	if value, ok := os.LookupEnv(ls.CheckString(1)); ok {
+		ls.PushString(value)
+	} else {
+		ls.PushNil()
+	}
+	return 1
+}
+
+// os.remove (filename)
+// 删除文件（或者空目录），成功时返回true，失败时返回nil、错误信息和错误码
+func osRemove(ls LuaState) int {
+	filename := ls.CheckString(1)
+	return ls.FileResult(os.Remove(filename), filename)
+}
+
+// os.rename (oldname, newname)
+// 重命名文件或者目录，成功时返回true，失败时返回nil、错误信息和错误码
+func osRename(ls LuaState) int {
+	fromName := ls.CheckString(1)
+	toName := ls.CheckString(2)
+	return ls.FileResult(os.Rename(fromName, toName), "")
+}
+
+// os.tmpname ()
+// 返回一个可以用作临时文件的文件名，与官方实现一样，这个文件会被创建出来（以免被别人抢先使用）
+func osTmpName(ls LuaState) int {
+	f, err := os.CreateTemp("", "lua_")
+	if err != nil {
+		return ls.Error2("unable to generate a unique filename")
+	}
+	f.Close()
+	ls.PushString(f.Name())
+	return 1
+}
@@ -0,0 +1,346 @@
+/*
+ *包库：require()以及它使用的搜索器（相当于官方实现里的loadlib.c）
+ *require(name)依次调用package.searchers里的搜索器查找模块的加载函数：
+ *	1.预加载搜索器：在package.preload里查找
+ *	2.Lua搜索器：按照package.path里的模板查找Lua文件（需要是luac编译好的二进制chunk）
+ *	3.Go模块搜索器：查找宿主通过LuaState.RegisterModule()注册的Go模块，代替了官方实现里加载C库的搜索器
+ *我们的虚拟机不能加载动态链接库，所以package.cpath只是为了兼容而保留，package.loadlib()总是失败
+ *与官方实现不同的是，require()能检测出模块之间的循环依赖，而不是无限递归下去
+ */
+package stdlib
+
+import (
+	"fmt"
+	. "luago/api"
+	"os"
+	"strings"
+)
+
+const (
+	LUA_DIRSEP    = string(os.PathSeparator) //目录分隔符
+	LUA_PATH_SEP  = ";"                      //模板之间的分隔符
+	LUA_PATH_MARK = "?"                      //模板里的模块名占位符
+	LUA_EXEC_DIR  = "!"                      //模板里的可执行文件目录占位符（只在Windows下有用）
+	LUA_IGMARK    = "-"                      //构造C函数名时忽略这个标记之前的部分（只在加载C库时有用）
+)
+
+// 路径的环境变量（带版本号的优先）以及默认路径
+const (
+	LUA_PATH_VAR        = "LUA_PATH"
+	LUA_CPATH_VAR       = "LUA_CPATH"
+	LUA_PATHVARVERSION  = "LUA_PATH_5_3"
+	LUA_CPATHVARVERSION = "LUA_CPATH_5_3"
+	LUA_ROOT            = "/usr/local/"
+	LUA_LDIR            = LUA_ROOT + "share/lua/5.3/"
+	LUA_CDIR            = LUA_ROOT + "lib/lua/5.3/"
+	LUA_PATH_DEFAULT    = LUA_LDIR + "?.lua;" + LUA_LDIR + "?/init.lua;" + LUA_CDIR + "?.lua;" + LUA_CDIR + "?/init.lua;" + "./?.lua;" + "./?/init.lua"
+	LUA_CPATH_DEFAULT   = LUA_CDIR + "?.so;" + LUA_CDIR + "loadall.so;" + "./?.so"
+)
+
+// 环境变量里的";;"先被替换成这个标记，再被替换成默认路径
+const _AUXMARK = "\x01"
+
+// 注册表里记录正在加载的模块的表，用来检测循环依赖，键是线程，值是该线程里正在加载的模块列表
+const _LOADING_TABLE = "_LOADING"
+
+var pkgFuncs = FuncReg{
+	"loadlib":    pkgLoadLib,
+	"searchpath": pkgSearchPath,
+}
+
+var llFuncs = FuncReg{
+	"require": llRequire,
+}
+
+// 搜索器，按照调用的顺序排列
+var searchers = []GoFunction{
+	searcherPreload,
+	searcherLua,
+	searcherGo,
+}
+
+// 打开包库，返回package表，同时注册全局函数require
+func OpenPackage(ls LuaState) int {
+	ls.NewLib(pkgFuncs)
+	_createSearchersTable(ls)
+	//设置package.path和package.cpath
+	_setPath(ls, "path", LUA_PATHVARVERSION, LUA_PATH_VAR, LUA_PATH_DEFAULT)
+	_setPath(ls, "cpath", LUA_CPATHVARVERSION, LUA_CPATH_VAR, LUA_CPATH_DEFAULT)
+	//package.config记录了上面这些分隔符和占位符
+	ls.PushString(LUA_DIRSEP + "\n" + LUA_PATH_SEP + "\n" + LUA_PATH_MARK + "\n" +
+		LUA_EXEC_DIR + "\n" + LUA_IGMARK + "\n")
+	ls.SetField(-2, "config")
+	//package.loaded和package.preload就是注册表里的_LOADED表和_PRELOAD表
+	ls.GetSubTable(LUA_REGISTRYINDEX, LUA_LOADED_TABLE)
+	ls.SetField(-2, "loaded")
+	ls.GetSubTable(LUA_REGISTRYINDEX, LUA_PRELOAD_TABLE)
+	ls.SetField(-2, "preload")
+	//把require注册到全局环境里，package表作为它的Upvalue
+	ls.PushGlobalTable()
+	ls.PushValue(-2)
+	ls.SetFuncs(llFuncs, 1)
+	ls.Pop(1) // 把全局环境弹出
+	return 1
+}
+
+// 创建package.searchers，package表作为每个搜索器的Upvalue
+func _createSearchersTable(ls LuaState) {
+	ls.CreateTable(len(searchers), 0)
+	for i, searcher := range searchers {
+		ls.PushValue(-2)
+		ls.PushGoClosure(searcher, 1)
+		ls.RawSetI(-2, int64(i+1))
+	}
+	ls.SetField(-2, "searchers")
+}
+
+/*
+ *设置package表（位于栈顶）里的path或者cpath字段：优先使用环境变量，没有的话使用默认路径
+ *环境变量里的";;"会被替换成默认路径，比如LUA_PATH="./lib/?.lua;;"
+ */
+func _setPath(ls LuaState, fieldName, envName1, envName2, def string) {
+	path, ok := os.LookupEnv(envName1)
+	if !ok {
+		path, ok = os.LookupEnv(envName2)
+	}
+	if !ok { // 没有环境变量
+		path = def
+	} else {
+		path = strings.ReplaceAll(path, LUA_PATH_SEP+LUA_PATH_SEP, LUA_PATH_SEP+_AUXMARK+LUA_PATH_SEP)
+		path = strings.ReplaceAll(path, _AUXMARK, def)
+	}
+	ls.PushString(path)
+	ls.SetField(-2, fieldName)
+}
+
+// package.loadlib (libname, funcname)
+// 我们的虚拟机不能加载动态链接库，与官方实现在不支持动态链接库的平台上的行为一样，返回nil、错误信息和"absent"
+func pkgLoadLib(ls LuaState) int {
+	ls.CheckString(1)
+	ls.CheckString(2)
+	ls.PushNil()
+	ls.PushString("dynamic libraries not enabled; check your Lua installation")
+	ls.PushString("absent")
+	return 3
+}
+
+// 文件是否存在并且可读
+func _readable(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+/*
+ *按照path里的模板查找模块name对应的文件，找到时返回文件名，
+ *否则返回空字符串和由每个尝试过的文件名组成的错误信息（"\n\tno file 'xxx'"）
+ *查找之前，模块名里的sep（通常是"."）会被替换成dirsep（通常是目录分隔符），比如a.b.c会变成a/b/c
+ */
+func _searchPath(name, path, sep, dirsep string) (string, string) {
+	var msg strings.Builder
+	if sep != "" {
+		name = strings.ReplaceAll(name, sep, dirsep)
+	}
+	for _, template := range strings.Split(path, LUA_PATH_SEP) {
+		if template == "" {
+			continue // 跳过空的模板
+		}
+		filename := strings.ReplaceAll(template, LUA_PATH_MARK, name)
+		if _readable(filename) {
+			return filename, ""
+		}
+		msg.WriteString(fmt.Sprintf("\n\tno file '%s'", filename))
+	}
+	return "", msg.String()
+}
+
+// package.searchpath (name, path [, sep [, rep]])
+// 按照path里的模板查找模块name对应的文件，找到时返回文件名，否则返回nil和错误信息（列出所有尝试过的文件名）
+func pkgSearchPath(ls LuaState) int {
+	filename, msg := _searchPath(ls.CheckString(1), ls.CheckString(2),
+		ls.OptString(3, "."), ls.OptString(4, LUA_DIRSEP))
+	if filename != "" {
+		ls.PushString(filename)
+		return 1
+	}
+	ls.PushNil()
+	ls.PushString(msg)
+	return 2
+}
+
+// 按照package[pname]（pname是"path"或者"cpath"）里的模板查找模块对应的文件，没找到时把错误信息推入栈顶
+func _findFile(ls LuaState, name, pname, dirsep string) string {
+	ls.GetField(LuaUpvalueIndex(1), pname)
+	path, ok := ls.ToStringX(-1)
+	ls.Pop(1)
+	if !ok {
+		ls.Error2("'package.%s' must be a string", pname)
+	}
+	filename, msg := _searchPath(name, path, ".", dirsep)
+	if filename == "" {
+		ls.PushString(msg)
+	}
+	return filename
+}
+
+// 文件加载成功时返回加载函数（已经在栈顶）和文件名，否则抛出错误
+func _checkLoad(ls LuaState, ok bool, filename string) int {
+	if ok {
+		ls.PushString(filename) // 文件名会作为加载函数的第2个参数
+		return 2
+	}
+	return ls.Error2("error loading module '%s' from file '%s':\n\t%s",
+		ls.ToString(1), filename, ls.ToString(-1))
+}
+
+// 预加载搜索器：在package.preload里查找模块的加载函数
+func searcherPreload(ls LuaState) int {
+	name := ls.CheckString(1)
+	ls.GetField(LUA_REGISTRYINDEX, LUA_PRELOAD_TABLE)
+	if ls.GetField(-1, name) == LUA_TNIL { // 没找到
+		ls.PushString(fmt.Sprintf("\n\tno field package.preload['%s']", name))
+	}
+	return 1
+}
+
+// Lua搜索器：按照package.path查找Lua文件，找到时返回加载好的主函数
+func searcherLua(ls LuaState) int {
+	name := ls.CheckString(1)
+	filename := _findFile(ls, name, "path", LUA_DIRSEP)
+	if filename == "" {
+		return 1 // 没找到，错误信息在栈顶
+	}
+	return _checkLoad(ls, ls.LoadFile(filename) == LUA_OK, filename)
+}
+
+// Go模块搜索器：查找宿主通过RegisterModule()注册的Go模块，找到时返回它的open函数
+func searcherGo(ls LuaState) int {
+	name := ls.CheckString(1)
+	ls.GetField(LUA_REGISTRYINDEX, LUA_GOMODULES_TABLE)
+	if ls.Type(-1) != LUA_TTABLE || ls.GetField(-1, name) == LUA_TNIL { // 没找到
+		ls.PushString(fmt.Sprintf("\n\tno Go module '%s'", name))
+	}
+	return 1
+}
+
+// 依次调用package.searchers里的搜索器，直到找到模块的加载函数，把加载函数和搜索器返回的额外数据推入栈顶
+func _findLoader(ls LuaState, name string) {
+	var msg strings.Builder // 所有搜索器的错误信息
+	if ls.GetField(LuaUpvalueIndex(1), "searchers") != LUA_TTABLE {
+		ls.Error2("'package.searchers' must be a table")
+	}
+	searchersIdx := ls.GetTop()
+	for i := int64(1); ; i++ {
+		if ls.RawGetI(searchersIdx, i) == LUA_TNIL { // 没有更多的搜索器了
+			ls.Error2("module '%s' not found:%s", name, msg.String())
+		}
+		ls.PushString(name)
+		ls.Call(1, 2)
+		if ls.Type(-2) == LUA_TFUNCTION { // 找到了加载函数
+			ls.Remove(searchersIdx)
+			return
+		} else if ls.IsString(-2) { // 搜索器返回了错误信息
+			msg.WriteString(ls.ToString(-2))
+		}
+		ls.Pop(2)
+	}
+}
+
+/*
+ *require (modname)
+ *加载模块modname：如果package.loaded[modname]已经有值了，直接返回它；
+ *否则依次调用package.searchers里的搜索器查找加载函数，以模块名和搜索器返回的额外数据为参数调用它，
+ *把返回值（如果是nil则为true）记录在package.loaded[modname]里并返回
+ *如果模块在加载的过程中（直接或者间接地）又require了自己，则抛出错误
+ */
+func llRequire(ls LuaState) int {
+	name := ls.CheckString(1)
+	ls.SetTop(1)
+	ls.GetField(LUA_REGISTRYINDEX, LUA_LOADED_TABLE) // LOADED表位于索引2
+	ls.GetField(2, name)                             // LOADED[name]
+	if ls.ToBoolean(-1) {                            // 模块已经加载了？
+		return 1
+	}
+	ls.Pop(1)
+
+	//正在加载的模块按照require的顺序记录在本线程的列表里（位于索引3），用来检测循环依赖。
+	//加载函数里可以挂起协程，所以每个线程有自己的列表，否则一个挂起之后不再恢复的协程会让别的线程误报循环依赖
+	_loadingList(ls)
+	_checkCycle(ls, 3, name)
+
+	_findLoader(ls, name)
+	ls.PushString(name) // 模块名作为加载函数的第1个参数
+	ls.Insert(-2)       // 搜索器返回的额外数据作为第2个参数
+	n := int64(ls.RawLen(3)) + 1
+	ls.PushString(name)
+	ls.RawSetI(3, n) // 记录正在加载的模块
+	if n == 1 { // 新的列表，记录到_LOADING表里
+		ls.GetField(LUA_REGISTRYINDEX, _LOADING_TABLE)
+		ls.PushThread()
+		ls.PushValue(3)
+		ls.RawSet(-3) // _LOADING[线程] = 列表
+		ls.Pop(1)
+	}
+	//不管成功与否（包括中断这样捕获不了的错误），模块都不再是正在加载的了。加载函数出错时错误原样传播出去，
+	//这时当前调用帧不一定还是本函数的，所以通过注册表重新找到列表。同一个线程里的require是嵌套的，所以删除的总是列表的最后一项
+	defer func() {
+		ls.CheckStack(4)
+		ls.GetField(LUA_REGISTRYINDEX, _LOADING_TABLE)
+		ls.PushThread()
+		ls.RawGet(-2)
+		ls.PushNil()
+		ls.RawSetI(-2, n)
+		if n == 1 { // 列表空了，把它从_LOADING表里删除，免得一直引用着线程
+			ls.PushThread()
+			ls.PushNil()
+			ls.RawSet(-4)
+		}
+		ls.Pop(2)
+	}()
+	ls.Call(2, 1)
+
+	if !ls.IsNil(-1) { // 加载函数返回了非nil的值？
+		ls.SetField(2, name) // LOADED[name] = 返回值
+	}
+	if ls.GetField(2, name) == LUA_TNIL { // 模块没有设置任何值？
+		ls.PushBoolean(true) // 用true作为结果
+		ls.PushValue(-1)
+		ls.SetField(2, name) // LOADED[name] = true
+	}
+	return 1
+}
+
+// 把当前线程正在加载的模块列表推入栈顶，没有的话推入一个新的空列表（记录了模块之后才放进_LOADING表里）
+func _loadingList(ls LuaState) {
+	ls.GetSubTable(LUA_REGISTRYINDEX, _LOADING_TABLE)
+	ls.PushThread()
+	if ls.RawGet(-2) == LUA_TNIL {
+		ls.Pop(1)
+		ls.NewTable()
+	}
+	ls.Remove(-2)
+}
+
+// 如果模块name正在加载（位于idx处的_LOADING表里），说明出现了循环依赖，抛出带有依赖链的错误，比如"a -> b -> a"
+func _checkCycle(ls LuaState, idx int, name string) {
+	n := int64(ls.RawLen(idx))
+	for i := int64(1); i <= n; i++ {
+		ls.RawGetI(idx, i)
+		loading := ls.ToString(-1)
+		ls.Pop(1)
+		if loading != name {
+			continue
+		}
+		chain := make([]string, 0, n-i+2)
+		for j := i; j <= n; j++ {
+			ls.RawGetI(idx, j)
+			chain = append(chain, ls.ToString(-1))
+			ls.Pop(1)
+		}
+		chain = append(chain, name)
+		ls.Error2("loop detected while loading module '%s' (%s)", name, strings.Join(chain, " -> "))
+	}
+}
@@ -0,0 +1,56 @@
+/*
+ *沙箱：运行不可信的脚本（比如玩家编写的脚本）时，全局环境里只能有安全的库和函数（见NewSandboxEnv()和state.NewSandbox()）
+ *危险的函数要么直接去掉（dofile、loadfile、require、io库、debug库、os.exit、os.remove等），
+ *要么换成受限的版本（collectgarbage只能查询内存占用）
+ *load和协程库不在默认配置里：受限的load只是不能加载二进制chunk，并不能阻止脚本在运行时编译并执行任意代码；
+ *而挂起之后不再恢复的协程会一直占着goroutine，直到宿主调用Close()。宿主在自己的配置里加上它们的话，load会换成受限版本（见sbLoad()）
+ *注意：我们的字符串库没有string.dump，os库也没有os.execute，所以不需要特别处理
+ */
+package stdlib
+
+import (
+	. "luago/api"
+)
+
+// 沙箱里替换基础库同名函数的受限版本，每个函数都以所在的沙箱环境为第1个Upvalue
+var SandboxFuncs = FuncReg{
+	"collectgarbage": sbCollectGarbage,
+	"load":           sbLoad,
+}
+
+// 默认的沙箱配置：只有纯计算的库和函数，不能访问文件、进程、调试信息以及Lua解释器的内部状态
+var SandboxSafe = SandboxProfile{
+	"_G": {
+		"assert", "collectgarbage", "error", "getmetatable", "ipairs", "next", "pairs",
+		"pcall", "print", "rawequal", "rawget", "rawlen", "rawset", "select", "setmetatable",
+		"tonumber", "tostring", "type", "xpcall", "_VERSION",
+	},
+	"math":   nil,
+	"os":     {"clock", "date", "difftime", "time"},
+	"string": nil,
+	"table":  nil,
+	"utf8":   nil,
+}
+
+// load (chunk [, chunkname [, mode [, env]]])
+// 沙箱版本：只能加载文本chunk（二进制chunk可以绕过虚拟机的各种检查），没有提供env（或者为nil）时使用所在的沙箱环境，
+// 而不是注册表里的全局环境（在NewSandboxEnv()创建的环境里，那是宿主的完整环境）
+func sbLoad(ls LuaState) int {
+	ls.SetTop(4)
+	ls.PushString("t")
+	ls.Replace(3)
+	if ls.IsNil(4) {
+		ls.PushValue(LuaUpvalueIndex(1))
+		ls.Replace(4)
+	}
+	return baseLoad(ls)
+}
+
+// collectgarbage ([opt [, arg]])
+// 沙箱版本：只能查询内存占用（"count"），其他操作会影响整个Lua解释器
+func sbCollectGarbage(ls LuaState) int {
+	if opt := ls.OptString(1, "collect"); opt != "count" {
+		return ls.ArgError(1, "option '"+opt+"' is not allowed in the sandbox")
+	}
+	return baseCollectGarbage(ls)
+}
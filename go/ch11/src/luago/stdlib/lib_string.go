@@ -0,0 +1,827 @@
+/*
+ *字符串库：所有函数都放在全局表string里，同时字符串类型的元表的__index字段也指向string表，
+ *所以既可以写string.upper(s)，也可以写成方法调用的形式s:upper()
+ *Lua字符串是字节序列，这里的所有位置和长度都是按字节计算的
+ */
+package stdlib
+
+import (
+	"fmt"
+	. "luago/api"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 结果字符串的最大长度，超过这个长度就报错，避免string.rep()之类的函数一下子耗尽内存
+const MAX_STRING_SIZE = math.MaxInt32
+
+var strLib = FuncReg{
+	"len":      strLen,
+	"sub":      strSub,
+	"upper":    strUpper,
+	"lower":    strLower,
+	"rep":      strRep,
+	"reverse":  strReverse,
+	"byte":     strByte,
+	"char":     strChar,
+	"find":     strFind,
+	"match":    strMatch,
+	"gmatch":   strGMatch,
+	"gsub":     strGSub,
+	"format":   strFormat,
+	"pack":     strPack,
+	"packsize": strPackSize,
+	"unpack":   strUnpack,
+}
+
+// 打开字符串库：创建string表，并为字符串类型设置元表，返回string表
+func OpenString(ls LuaState) int {
+	ls.NewLib(strLib)
+	createMetatable(ls)
+	return 1
+}
+
+/*
+ *创建字符串类型共享的元表{__index = string}
+ *所有字符串共享同一个元表（放在注册表里），所以随便拿一个字符串来设置就可以了
+ */
+func createMetatable(ls LuaState) {
+	ls.CreateTable(0, 1)       // 元表
+	ls.PushString("")          // 随便一个字符串
+	ls.PushValue(-2)           // 元表
+	ls.SetMetatable(-2)        // 设置字符串类型的元表
+	ls.Pop(1)                  // 弹出字符串
+	ls.PushValue(-2)           // string表
+	ls.SetField(-2, "__index") // 元表.__index = string
+	ls.Pop(1)                  // 弹出元表
+}
+
+// string.len (s)
+// 返回字符串的长度（字节数）
+func strLen(ls LuaState) int {
+	s := ls.CheckString(1)
+	ls.PushInteger(int64(len(s)))
+	return 1
+}
+
+// string.sub (s [, i [, j]])
+// 返回s从i到j（都包括）的子串，i和j可以是负数（从末尾开始数），j默认为-1（即到末尾）
+func strSub(ls LuaState) int {
+	s := ls.CheckString(1)
+	sLen := int64(len(s))
+	i := posRelat(ls.CheckInteger(2), sLen)
+	j := posRelat(ls.OptInteger(3, -1), sLen)
+
+	if i < 1 {
+		i = 1
+	}
+	if j > sLen {
+		j = sLen
+	}
+
+	if i <= j {
+		ls.PushString(s[i-1 : j])
+	} else {
+		ls.PushString("")
+	}
+	return 1
+}
+
+// string.upper (s)
+// 把所有小写字母转换成大写，其他字符保持不变（只处理ASCII字母）
+func strUpper(ls LuaState) int {
+	s := ls.CheckString(1)
+	b := []byte(s)
+	for i, c := range b {
+		if 'a' <= c && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.lower (s)
+// 把所有大写字母转换成小写，其他字符保持不变（只处理ASCII字母）
+func strLower(ls LuaState) int {
+	s := ls.CheckString(1)
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c - 'A' + 'a'
+		}
+	}
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.rep (s, n [, sep])
+// 返回n个s以sep（默认为空字符串）分隔拼接起来的字符串，n小于等于0时返回空字符串
+func strRep(ls LuaState) int {
+	s := ls.CheckString(1)
+	n := ls.CheckInteger(2)
+	sep := ls.OptString(3, "")
+
+	if n <= 0 {
+		ls.PushString("")
+		return 1
+	}
+
+	l := int64(len(s) + len(sep))
+	if l > 0 && n > (MAX_STRING_SIZE+int64(len(sep)))/l {
+		return ls.Error2("resulting string too large")
+	}
+	ls.CheckMemory(int(n*l) - len(sep)) // 先确认内存够用，再构造结果
+
+	if sep == "" {
+		ls.PushString(strings.Repeat(s, int(n)))
+	} else {
+		var sb strings.Builder
+		sb.Grow(int(n*l) - len(sep))
+		for i := int64(1); i <= n; i++ {
+			if i > 1 {
+				sb.WriteString(sep)
+			}
+			sb.WriteString(s)
+		}
+		ls.PushString(sb.String())
+	}
+	return 1
+}
+
+// string.reverse (s)
+// 返回按字节反转后的字符串
+func strReverse(ls LuaState) int {
+	s := ls.CheckString(1)
+	n := len(s)
+	b := make([]byte, n)
+	for i := 0; i < n; i++ {
+		b[i] = s[n-1-i]
+	}
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.byte (s [, i [, j]])
+// 返回s[i]、s[i+1]...s[j]这些字节的数值，i默认为1，j默认为i
+func strByte(ls LuaState) int {
+	s := ls.CheckString(1)
+	sLen := int64(len(s))
+	i := posRelat(ls.OptInteger(2, 1), sLen)
+	j := posRelat(ls.OptInteger(3, i), sLen)
+
+	if i < 1 {
+		i = 1
+	}
+	if j > sLen {
+		j = sLen
+	}
+
+	if i > j {
+		return 0 // 空区间
+	}
+	if j-i >= math.MaxInt32 {
+		return ls.Error2("string slice too long")
+	}
+
+	n := int(j - i + 1)
+	ls.CheckStack2(n, "string slice too long")
+	for k := 0; k < n; k++ {
+		ls.PushInteger(int64(s[int(i)+k-1]))
+	}
+	return n
+}
+
+// string.char (···)
+// 把每个参数（0~255之间的整数）当作一个字节，拼接成字符串返回
+func strChar(ls LuaState) int {
+	nArgs := ls.GetTop()
+	b := make([]byte, nArgs)
+	for i := 1; i <= nArgs; i++ {
+		c := ls.CheckInteger(i)
+		ls.ArgCheck(0 <= c && c <= 255, i, "value out of range")
+		b[i-1] = byte(c)
+	}
+	ls.PushString(string(b))
+	return 1
+}
+
+// string.find (s, pattern [, init [, plain]])
+// 在s里查找pattern的第一个匹配，返回匹配的起止位置和全部捕获，找不到返回nil
+// plain为true时关闭模式匹配，当作普通子串查找
+func strFind(ls LuaState) int {
+	return strFindAux(ls, true)
+}
+
+// string.match (s, pattern [, init])
+// 在s里查找pattern的第一个匹配，返回全部捕获（没有捕获时返回整个匹配），找不到返回nil
+func strMatch(ls LuaState) int {
+	return strFindAux(ls, false)
+}
+
+func strFindAux(ls LuaState, find bool) int {
+	s := ls.CheckString(1)
+	p := ls.CheckString(2)
+	init := posRelat(ls.OptInteger(3, 1), int64(len(s)))
+	if init < 1 {
+		init = 1
+	}
+	if init > int64(len(s))+1 { // 起始位置超出了字符串的范围
+		ls.PushNil()
+		return 1
+	}
+
+	if find && (ls.ToBoolean(4) || !strings.ContainsAny(p, SPECIALS)) {
+		//普通的子串查找
+		if idx := strings.Index(s[init-1:], p); idx >= 0 {
+			start := init + int64(idx)
+			ls.PushInteger(start)
+			ls.PushInteger(start + int64(len(p)) - 1)
+			return 2
+		}
+	} else {
+		anchor := len(p) > 0 && p[0] == '^'
+		if anchor {
+			p = p[1:] // 跳过'^'
+		}
+		ms := newMatchState(ls, s, p)
+		for s1 := int(init - 1); ; s1++ {
+			ms.reprepstate()
+			if e := ms.match(s1, 0); e != -1 {
+				if find {
+					ls.PushInteger(int64(s1 + 1)) // 起始位置
+					ls.PushInteger(int64(e))      // 结束位置
+					return ms.pushCaptures(-1, 0) + 2
+				}
+				return ms.pushCaptures(s1, e)
+			}
+			if s1 >= len(s) || anchor {
+				break
+			}
+		}
+	}
+	ls.PushNil() // 找不到
+	return 1
+}
+
+// string.gmatch (s, pattern)
+// 返回一个迭代器，每次调用返回pattern在s里的下一个匹配的全部捕获（没有捕获时返回整个匹配）
+// 迭代器是一个Go闭包，s、pattern、下次开始匹配的位置和上一次匹配的结束位置都保存在它的Upvalue里
+func strGMatch(ls LuaState) int {
+	ls.CheckString(1)
+	ls.CheckString(2)
+	ls.SetTop(2)
+	ls.PushInteger(0)  // 下次开始匹配的位置
+	ls.PushInteger(-1) // 上一次匹配的结束位置，用来避免在同一个位置重复匹配空串
+	ls.PushGoClosure(_gmatchAux, 4)
+	return 1
+}
+
+func _gmatchAux(ls LuaState) int {
+	s := ls.ToString(LuaUpvalueIndex(1))
+	p := ls.ToString(LuaUpvalueIndex(2))
+	src, _ := ls.ToIntegerX(LuaUpvalueIndex(3))
+	lastMatch, _ := ls.ToIntegerX(LuaUpvalueIndex(4))
+
+	ms := newMatchState(ls, s, p)
+	for ; int(src) <= len(s); src++ {
+		ms.reprepstate()
+		if e := ms.match(int(src), 0); e != -1 && int64(e) != lastMatch {
+			//下次从匹配结束的位置开始
+			ls.PushInteger(int64(e))
+			ls.Copy(-1, LuaUpvalueIndex(3))
+			ls.Replace(LuaUpvalueIndex(4))
+			return ms.pushCaptures(int(src), e)
+		}
+	}
+	ls.PushInteger(src)
+	ls.Replace(LuaUpvalueIndex(3))
+	return 0 // 没有更多匹配了
+}
+
+// string.gsub (s, pattern, repl [, n])
+// 把s里pattern的（前n个）匹配全部替换成repl，返回替换后的字符串和匹配的次数
+// repl可以是字符串（%0~%9表示捕获，%%表示%）、表（以第一个捕获为键查表）或者函数（以全部捕获为参数调用）
+// 表或者函数的结果为false或者nil时，保留原来的匹配
+func strGSub(ls LuaState) int {
+	src := ls.CheckString(1)
+	p := ls.CheckString(2)
+	tr := ls.Type(3)
+	maxS := ls.OptInteger(4, int64(len(src))+1)
+	anchor := len(p) > 0 && p[0] == '^'
+	ls.ArgCheck(tr == LUA_TNUMBER || tr == LUA_TSTRING ||
+		tr == LUA_TFUNCTION || tr == LUA_TTABLE, 3,
+		"string/function/table expected")
+	if anchor {
+		p = p[1:] // 跳过'^'
+	}
+
+	b := NewBuffer(ls)
+	ms := newMatchState(ls, src, p)
+	s, lastMatch := 0, -1
+	n := int64(0)
+	for n < maxS {
+		ms.reprepstate()
+		if e := ms.match(s, 0); e != -1 && e != lastMatch { // 匹配成功
+			n++
+			_addValue(ms, b, s, e, tr) // 添加替换的值
+			s, lastMatch = e, e
+		} else if s < len(src) { // 否则跳过一个字符
+			b.AddChar(src[s])
+			s++
+		} else {
+			break // 字符串结束了
+		}
+		if anchor {
+			break
+		}
+	}
+	b.AddString(src[s:])
+	b.PushResult()
+	ls.PushInteger(n) // 匹配次数
+	return 2
+}
+
+// 把从s到e的匹配对应的替换值添加到缓冲区里
+func _addValue(ms *matchState, b *Buffer, s, e int, tr LuaType) {
+	ls := ms.ls
+	switch tr {
+	case LUA_TFUNCTION:
+		ls.PushValue(3)
+		n := ms.pushCaptures(s, e)
+		ls.Call(n, 1)
+	case LUA_TTABLE:
+		ms.pushOneCapture(0, s, e)
+		ls.GetTable(3)
+	default: // LUA_TNUMBER或者LUA_TSTRING
+		_addString(ms, b, s, e)
+		return
+	}
+
+	if !ls.ToBoolean(-1) { // nil或者false
+		ls.Pop(1)
+		ls.PushString(ms.src[s:e]) // 保留原来的匹配
+	} else if !ls.IsString(-1) {
+		ls.Error2("invalid replacement value (a %s)", ls.TypeName2(-1))
+	}
+	b.AddValue()
+}
+
+// 把替换字符串添加到缓冲区里，其中的%0~%9替换成对应的捕获
+func _addString(ms *matchState, b *Buffer, s, e int) {
+	ls := ms.ls
+	news := ls.ToString(3)
+	for i := 0; i < len(news); i++ {
+		if news[i] != L_ESC {
+			b.AddChar(news[i])
+			continue
+		}
+		i++ // 跳过'%'
+		var c byte
+		if i < len(news) {
+			c = news[i]
+		}
+		if !isDigit(c) {
+			if c != L_ESC {
+				ls.Error2("invalid use of '%c' in replacement string", L_ESC)
+			}
+			b.AddChar(c) // %%
+		} else if c == '0' {
+			b.AddString(ms.src[s:e]) // 整个匹配
+		} else {
+			ms.pushOneCapture(int(c-'1'), s, e)
+			ls.ToStringMeta(-1) // 位置捕获是整数，转换成字符串
+			ls.Remove(-2)
+			b.AddValue()
+		}
+	}
+}
+
+// 格式说明符里合法的标志
+const FMT_FLAGS = "-+ #0"
+
+// string.format (formatstring, ···)
+// 按照C语言printf的规则格式化参数，支持%d %i %u %c %x %X %o %e %E %f %F %g %G %a %A %q %s %%
+// 整数转换要求参数有整数表示，%s会调用__tostring元方法，%q把参数转换成可以被Lua重新加载的字面量
+func strFormat(ls LuaState) int {
+	top := ls.GetTop()
+	arg := 1
+	strfrmt := ls.CheckString(arg)
+	b := NewBuffer(ls)
+
+	for i := 0; i < len(strfrmt); i++ {
+		if strfrmt[i] != '%' {
+			b.AddChar(strfrmt[i])
+			continue
+		}
+		i++ // 跳过'%'
+		if i < len(strfrmt) && strfrmt[i] == '%' {
+			b.AddChar('%') // %%
+			continue
+		}
+
+		arg++
+		if arg > top {
+			ls.ArgError(arg, "no value")
+		}
+		spec, conv := _scanFormat(ls, strfrmt[i:])
+		i += len(spec)
+		switch conv {
+		case 'c':
+			c := byte(ls.CheckInteger(arg))
+			b.AddString(_pad(spec, string([]byte{c})))
+		case 'd', 'i':
+			n := ls.CheckInteger(arg)
+			b.AddString(fmt.Sprintf("%"+spec+"d", n))
+		case 'u':
+			n := ls.CheckInteger(arg)
+			b.AddString(fmt.Sprintf("%"+spec+"d", uint64(n)))
+		case 'o', 'x', 'X':
+			n := ls.CheckInteger(arg)
+			b.AddString(fmt.Sprintf("%"+spec+string(conv), uint64(n)))
+		case 'a', 'A':
+			n := ls.CheckNumber(arg)
+			b.AddString(_formatFloat(spec, conv, n))
+		case 'e', 'E', 'f', 'F', 'g', 'G':
+			n := ls.CheckNumber(arg)
+			b.AddString(_formatFloat(spec, conv, n))
+		case 'q':
+			_addLiteral(ls, b, arg)
+		case 's':
+			s := ls.ToStringMeta(arg)
+			ls.Pop(1)
+			if spec == "" {
+				b.AddString(s) // 没有修饰符，原样添加
+			} else {
+				ls.ArgCheck(strings.IndexByte(s, 0) < 0, arg, "string contains zeros")
+				if !strings.Contains(spec, ".") && len(s) >= 100 {
+					b.AddString(s) // 没有精度，并且字符串太长了，也原样添加
+				} else {
+					b.AddString(_pad(spec, s))
+				}
+			}
+		default:
+			return ls.Error2("invalid option '%%%c' to 'format'", conv)
+		}
+	}
+
+	b.PushResult()
+	return 1
+}
+
+/*
+ *解析'%'之后的格式说明符：标志、宽度（最多2位数字）和精度（最多2位数字）
+ *返回说明符（不包括'%'和转换字符）以及转换字符
+ */
+func _scanFormat(ls LuaState, strfrmt string) (spec string, conv byte) {
+	p := 0
+	for p < len(strfrmt) && strings.IndexByte(FMT_FLAGS, strfrmt[p]) >= 0 {
+		p++ // 跳过标志
+	}
+	if p > len(FMT_FLAGS) {
+		ls.Error2("invalid format (repeated flags)")
+	}
+	p = _skipDigits(strfrmt, p) // 跳过宽度
+	if p < len(strfrmt) && strfrmt[p] == '.' {
+		p = _skipDigits(strfrmt, p+1) // 跳过精度
+	}
+	if p < len(strfrmt) && isDigit(strfrmt[p]) {
+		ls.Error2("invalid format (width or precision too long)")
+	}
+	if p < len(strfrmt) {
+		conv = strfrmt[p]
+	}
+	return strfrmt[:p], conv
+}
+
+// 最多跳过2位数字
+func _skipDigits(s string, p int) int {
+	for n := 0; n < 2 && p < len(s) && isDigit(s[p]); n++ {
+		p++
+	}
+	return p
+}
+
+// 解析说明符里的标志、宽度和精度，精度为-1表示没有指定
+func _parseSpec(spec string) (flags string, width, prec int) {
+	p := 0
+	for p < len(spec) && strings.IndexByte(FMT_FLAGS, spec[p]) >= 0 {
+		p++
+	}
+	flags = spec[:p]
+	q := p
+	for q < len(spec) && isDigit(spec[q]) {
+		q++
+	}
+	width, _ = strconv.Atoi(spec[p:q])
+	prec = -1
+	if q < len(spec) && spec[q] == '.' {
+		prec, _ = strconv.Atoi(spec[q+1:])
+	}
+	return
+}
+
+// 按照C语言的规则处理%s和%c的宽度和精度（都是按字节计算的，Go的fmt按字符计算，所以不能直接用）
+func _pad(spec, s string) string {
+	flags, width, prec := _parseSpec(spec)
+	if prec >= 0 && prec < len(s) {
+		s = s[:prec]
+	}
+	if n := width - len(s); n > 0 {
+		if strings.IndexByte(flags, '-') >= 0 {
+			return s + strings.Repeat(" ", n)
+		}
+		return strings.Repeat(" ", n) + s
+	}
+	return s
+}
+
+/*
+ *格式化浮点数，在以下几个方面Go的fmt和C语言的printf不一样，需要特殊处理：
+ *Go的%g默认精度是“能精确表示的最少位数”，C语言是6；
+ *Go的十六进制浮点数（%x）的指数部分至少有两位数字，C语言的%a没有这个限制；
+ *无穷大和NaN，Go输出+Inf和NaN，C语言输出inf和nan
+ */
+func _formatFloat(spec string, conv byte, n float64) string {
+	if math.IsInf(n, 0) || math.IsNaN(n) {
+		flags, _, _ := _parseSpec(spec)
+		var s string
+		switch {
+		case math.IsNaN(n):
+			s = "nan"
+		case n < 0:
+			s = "-inf"
+		case strings.IndexByte(flags, '+') >= 0:
+			s = "+inf"
+		case strings.IndexByte(flags, ' ') >= 0:
+			s = " inf"
+		default:
+			s = "inf"
+		}
+		if 'A' <= conv && conv <= 'Z' {
+			s = strings.ToUpper(s)
+		}
+		//不能用0填充，去掉精度
+		spec = strings.Replace(spec, "0", "", 1)
+		if i := strings.IndexByte(spec, '.'); i >= 0 {
+			spec = spec[:i]
+		}
+		return _pad(spec, s)
+	}
+
+	switch conv {
+	case 'a', 'A':
+		return _formatHexFloat(spec, conv, n)
+	case 'g', 'G':
+		if !strings.Contains(spec, ".") {
+			spec += ".6"
+		}
+	}
+	return fmt.Sprintf("%"+spec+string(conv), n)
+}
+
+// %a和%A：先不带宽度格式化，去掉指数部分前面多余的0（比如0x1p+00 -> 0x1p+0）之后，再按照宽度填充
+func _formatHexFloat(spec string, conv byte, n float64) string {
+	flags, width, prec := _parseSpec(spec)
+	verb := "x"
+	if conv == 'A' {
+		verb = "X"
+	}
+	form := "%" + strings.Replace(flags, "0", "", -1)
+	if prec >= 0 {
+		form += "." + strconv.Itoa(prec)
+	}
+	s := _trimExponent(fmt.Sprintf(form+verb, n))
+
+	pad := width - len(s)
+	switch {
+	case pad <= 0:
+		return s
+	case strings.IndexByte(flags, '-') >= 0:
+		return s + strings.Repeat(" ", pad)
+	case strings.IndexByte(flags, '0') >= 0:
+		//0填充在符号和"0x"前缀之后
+		i := strings.IndexAny(s, "xX") + 1
+		return s[:i] + strings.Repeat("0", pad) + s[i:]
+	default:
+		return strings.Repeat(" ", pad) + s
+	}
+}
+
+// 去掉十六进制浮点数的指数部分前面多余的0
+func _trimExponent(s string) string {
+	i := strings.IndexAny(s, "pP")
+	if i < 0 || i+2 >= len(s) {
+		return s
+	}
+	j := i + 2 // 跳过'p'和符号
+	k := j
+	for k < len(s)-1 && s[k] == '0' {
+		k++
+	}
+	return s[:j] + s[k:]
+}
+
+// %q：把参数转换成可以被Lua重新加载的字面量添加到缓冲区里
+func _addLiteral(ls LuaState, b *Buffer, arg int) {
+	switch ls.Type(arg) {
+	case LUA_TSTRING:
+		_addQuoted(b, ls.ToString(arg))
+	case LUA_TNUMBER:
+		if !ls.IsInteger(arg) { // 浮点数
+			n := ls.ToNumber(arg)
+			switch {
+			case math.IsInf(n, 1):
+				b.AddString("1e9999")
+			case math.IsInf(n, -1):
+				b.AddString("-1e9999")
+			case math.IsNaN(n):
+				b.AddString("(0/0)")
+			default:
+				//用十六进制表示，保证精确
+				b.AddString(_trimExponent(fmt.Sprintf("%x", n)))
+			}
+		} else { // 整数
+			n := ls.ToInteger(arg)
+			if n == math.MinInt64 {
+				//最小整数的十进制形式会被解析成浮点数（负号是运算符），所以用十六进制表示
+				b.AddString(fmt.Sprintf("0x%x", uint64(n)))
+			} else {
+				b.AddString(strconv.FormatInt(n, 10))
+			}
+		}
+	case LUA_TNIL, LUA_TBOOLEAN:
+		ls.ToStringMeta(arg)
+		b.AddValue()
+	default:
+		ls.ArgError(arg, "value has no literal form")
+	}
+}
+
+// 把字符串转换成带双引号的Lua字符串字面量，对引号、反斜杠、换行和控制字符进行转义
+func _addQuoted(b *Buffer, s string) {
+	b.AddChar('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c == '\n' {
+			b.AddChar('\\')
+			b.AddChar(c)
+		} else if c < 32 || c == 127 { // 控制字符
+			if i+1 < len(s) && isDigit(s[i+1]) {
+				//后面紧跟着数字，必须用3位数字，否则会和后面的数字连在一起
+				b.AddString(fmt.Sprintf("\\%03d", c))
+			} else {
+				b.AddString(fmt.Sprintf("\\%d", c))
+			}
+		} else {
+			b.AddChar(c)
+		}
+	}
+	b.AddChar('"')
+}
+
+// string.pack (fmt, v1, v2, ···)
+// 按照格式fmt把参数打包成二进制字符串
+func strPack(ls LuaState) int {
+	h := newPackHeader(ls, ls.CheckString(1))
+	b := NewBuffer(ls)
+	arg := 1
+	totalSize := 0
+	for len(h.fmt) > 0 {
+		opt, size, nToAlign := h.getDetails(totalSize)
+		totalSize += nToAlign + size
+		for ; nToAlign > 0; nToAlign-- {
+			b.AddChar(LUAL_PACKPADBYTE) // 对齐
+		}
+		arg++
+		switch opt {
+		case Kint: // 有符号整数
+			n := ls.CheckInteger(arg)
+			if size < SZINT { // 需要检查溢出
+				lim := int64(1) << (size*NB - 1)
+				ls.ArgCheck(-lim <= n && n < lim, arg, "integer overflow")
+			}
+			h.packInt(b, uint64(n), size, n < 0)
+		case Kuint: // 无符号整数
+			n := ls.CheckInteger(arg)
+			if size < SZINT {
+				ls.ArgCheck(uint64(n) < uint64(1)<<(size*NB), arg, "unsigned overflow")
+			}
+			h.packInt(b, uint64(n), size, false)
+		case Kfloat:
+			buff := make([]byte, 4)
+			h.byteOrder().PutUint32(buff, math.Float32bits(float32(ls.CheckNumber(arg))))
+			b.AddString(string(buff))
+		case Knumber, Kdouble:
+			buff := make([]byte, 8)
+			h.byteOrder().PutUint64(buff, math.Float64bits(ls.CheckNumber(arg)))
+			b.AddString(string(buff))
+		case Kchar: // 定长字符串
+			s := ls.CheckString(arg)
+			ls.ArgCheck(len(s) <= size, arg, "string longer than given size")
+			b.AddString(s)
+			for i := len(s); i < size; i++ {
+				b.AddChar(LUAL_PACKPADBYTE) // 补齐
+			}
+		case Kstring: // 长度前缀的字符串
+			s := ls.CheckString(arg)
+			ls.ArgCheck(size >= 8 || uint64(len(s)) < uint64(1)<<(size*NB),
+				arg, "string length does not fit in given size")
+			h.packInt(b, uint64(len(s)), size, false)
+			b.AddString(s)
+			totalSize += len(s)
+		case Kzstr: // 以'\0'结尾的字符串
+			s := ls.CheckString(arg)
+			ls.ArgCheck(strings.IndexByte(s, 0) < 0, arg, "string contains zeros")
+			b.AddString(s)
+			b.AddChar(0)
+			totalSize += len(s) + 1
+		case Kpadding:
+			b.AddChar(LUAL_PACKPADBYTE)
+			arg--
+		case Kpaddalign, Knop:
+			arg-- // 这些选项不消耗参数
+		}
+	}
+	b.PushResult()
+	return 1
+}
+
+// string.packsize (fmt)
+// 返回按照格式fmt打包得到的字符串的长度，格式里不能有变长的选项（s和z）
+func strPackSize(ls LuaState) int {
+	h := newPackHeader(ls, ls.CheckString(1))
+	totalSize := 0
+	for len(h.fmt) > 0 {
+		opt, size, nToAlign := h.getDetails(totalSize)
+		size += nToAlign
+		ls.ArgCheck(totalSize <= MAX_STRING_SIZE-size, 1, "format result too large")
+		totalSize += size
+		if opt == Kstring || opt == Kzstr {
+			ls.ArgError(1, "variable-length format")
+		}
+	}
+	ls.PushInteger(int64(totalSize))
+	return 1
+}
+
+// string.unpack (fmt, s [, pos])
+// 按照格式fmt从s的pos（默认为1）处开始解包，返回全部的值以及下一个未读字节的位置
+func strUnpack(ls LuaState) int {
+	h := newPackHeader(ls, ls.CheckString(1))
+	data := ls.CheckString(2)
+	ld := len(data)
+	pos := int(posRelat(ls.OptInteger(3, 1), int64(ld))) - 1
+	ls.ArgCheck(0 <= pos && pos <= ld, 3, "initial position out of string")
+	n := 0 // 返回值的数量
+	for len(h.fmt) > 0 {
+		opt, size, nToAlign := h.getDetails(pos)
+		if nToAlign+size > ld-pos {
+			ls.ArgError(2, "data string too short")
+		}
+		pos += nToAlign
+		ls.CheckStack2(2, "too many results")
+		n++
+		switch opt {
+		case Kint, Kuint:
+			ls.PushInteger(h.unpackInt(data[pos:], size, opt == Kint))
+		case Kfloat:
+			f := math.Float32frombits(h.byteOrder().Uint32([]byte(data[pos : pos+4])))
+			ls.PushNumber(float64(f))
+		case Knumber, Kdouble:
+			f := math.Float64frombits(h.byteOrder().Uint64([]byte(data[pos : pos+8])))
+			ls.PushNumber(f)
+		case Kchar:
+			ls.PushString(data[pos : pos+size])
+		case Kstring:
+			l := uint64(h.unpackInt(data[pos:], size, false))
+			ls.ArgCheck(l <= uint64(ld-pos-size), 2, "data string too short")
+			ls.PushString(data[pos+size : pos+size+int(l)])
+			pos += int(l)
+		case Kzstr:
+			l := strings.IndexByte(data[pos:], 0)
+			ls.ArgCheck(l >= 0, 2, "unfinished string for format 'z'")
+			ls.PushString(data[pos : pos+l])
+			pos += l + 1 // 跳过'\0'
+		case Kpaddalign, Kpadding, Knop:
+			n-- // 这些选项不产生值
+		}
+		pos += size
+	}
+	ls.PushInteger(int64(pos + 1)) // 下一个位置
+	return n + 1
+}
+
+/*
+ *把相对位置转换成绝对位置：负数表示从末尾开始数，-1就是最后一个字节
+ *转换结果可能小于1（比如-100），由调用者负责修正
+ */
+func posRelat(pos, sLen int64) int64 {
+	if pos >= 0 {
+		return pos
+	} else if -pos > sLen {
+		return 0
+	}
+	return sLen + pos + 1
+}
@@ -0,0 +1,355 @@
+/*
+ *表库：insert、remove、concat、pack、unpack、move、sort
+ *与官方实现一样，所有对表的访问都通过GetI()/SetI()/Len2()进行，所以会触发__index、__newindex和__len元方法，
+ *只要提供了相应的元方法，这些函数也可以作用于不是表的值（比如代理对象）
+ */
+package stdlib
+
+import (
+	. "luago/api"
+	"math"
+	"time"
+)
+
+// checkTab()的what参数，表示需要对表进行的操作
+const (
+	TAB_R  = 1             // 读
+	TAB_W  = 2             // 写
+	TAB_L  = 4             // 取长度
+	TAB_RW = TAB_R | TAB_W // 读写
+)
+
+var tabFuncs = FuncReg{
+	"concat": tabConcat,
+	"insert": tabInsert,
+	"pack":   tabPack,
+	"unpack": tabUnpack,
+	"remove": tabRemove,
+	"move":   tabMove,
+	"sort":   tabSort,
+}
+
+// 打开表库，返回table表
+func OpenTable(ls LuaState) int {
+	ls.NewLib(tabFuncs)
+	return 1
+}
+
+/*
+ *确保第arg个参数是表，或者是元表里提供了what所要求的元方法的值
+ *（读需要__index，写需要__newindex，取长度需要__len），否则抛出参数类型错误
+ */
+func checkTab(ls LuaState, arg, what int) {
+	if ls.Type(arg) == LUA_TTABLE {
+		return
+	}
+	n := 1 // 压入栈的值的数量
+	if ls.GetMetatable(arg) &&
+		(what&TAB_R == 0 || _checkField(ls, "__index", &n)) &&
+		(what&TAB_W == 0 || _checkField(ls, "__newindex", &n)) &&
+		(what&TAB_L == 0 || _checkField(ls, "__len", &n)) {
+		ls.Pop(n) // 弹出元表和元方法
+	} else {
+		ls.CheckType(arg, LUA_TTABLE) // 抛出错误
+	}
+}
+
+// 检查栈顶的元表里是否有某个字段，字段会留在栈里
+func _checkField(ls LuaState, key string, n *int) bool {
+	ls.PushString(key)
+	*n++
+	return ls.RawGet(-*n) != LUA_TNIL
+}
+
+// 检查第n个参数，并返回它的长度
+func auxGetN(ls LuaState, n, what int) int64 {
+	checkTab(ls, n, what|TAB_L)
+	return ls.Len2(n)
+}
+
+// table.insert (list, [pos,] value)
+// 在list的pos位置（默认为#list+1）插入value，后面的元素依次后移
+func tabInsert(ls LuaState) int {
+	e := auxGetN(ls, 1, TAB_RW) + 1 // 第一个空位
+	var pos int64
+	switch ls.GetTop() {
+	case 2: // 只有2个参数，插入到末尾
+		pos = e
+	case 3:
+		pos = ls.CheckInteger(2)
+		//检查1 <= pos <= e
+		ls.ArgCheck(uint64(pos)-1 < uint64(e), 2, "position out of bounds")
+		for i := e; i > pos; i-- { // 后移元素
+			ls.GetI(1, i-1)
+			ls.SetI(1, i) // t[i] = t[i - 1]
+		}
+	default:
+		return ls.Error2("wrong number of arguments to 'insert'")
+	}
+	ls.SetI(1, pos) // t[pos] = v
+	return 0
+}
+
+// table.remove (list [, pos])
+// 删除并返回list的pos位置（默认为#list）的元素，后面的元素依次前移
+func tabRemove(ls LuaState) int {
+	size := auxGetN(ls, 1, TAB_RW)
+	pos := ls.OptInteger(2, size)
+	if pos != size { // 检查1 <= pos <= size + 1
+		ls.ArgCheck(uint64(pos)-1 <= uint64(size), 1, "position out of bounds")
+	}
+	ls.GetI(1, pos) // 结果t[pos]
+	for ; pos < size; pos++ {
+		ls.GetI(1, pos+1)
+		ls.SetI(1, pos) // t[pos] = t[pos + 1]
+	}
+	ls.PushNil()
+	ls.SetI(1, pos) // t[pos] = nil
+	return 1
+}
+
+// table.move (a1, f, e, t [,a2])
+// 把a1[f]到a1[e]的元素复制到a2（默认为a1）的t处，源和目标可以重叠，返回a2
+func tabMove(ls LuaState) int {
+	f := ls.CheckInteger(2)
+	e := ls.CheckInteger(3)
+	t := ls.CheckInteger(4)
+	tt := 1 // 目标表
+	if !ls.IsNoneOrNil(5) {
+		tt = 5
+	}
+	checkTab(ls, 1, TAB_R)
+	checkTab(ls, tt, TAB_W)
+	if e >= f { // 否则没有需要移动的元素
+		ls.ArgCheck(f > 0 || e < math.MaxInt64+f, 3, "too many elements to move")
+		n := e - f + 1 // 需要移动的元素数量
+		ls.ArgCheck(t <= math.MaxInt64-n+1, 4, "destination wrap around")
+		if t > e || t <= f || (tt != 1 && !ls.Compare(1, tt, LUA_OPEQ)) {
+			for i := int64(0); i < n; i++ { // 从前往后复制
+				ls.GetI(1, f+i)
+				ls.SetI(tt, t+i)
+			}
+		} else {
+			for i := n - 1; i >= 0; i-- { // 目标与源重叠，从后往前复制
+				ls.GetI(1, f+i)
+				ls.SetI(tt, t+i)
+			}
+		}
+	}
+	ls.PushValue(tt) // 返回目标表
+	return 1
+}
+
+// table.concat (list [, sep [, i [, j]]])
+// 返回list[i]..sep..list[i+1]..sep..list[j]，元素必须是字符串或者数字，i默认为1，j默认为#list
+func tabConcat(ls LuaState) int {
+	last := auxGetN(ls, 1, TAB_R)
+	sep := ls.OptString(2, "")
+	i := ls.OptInteger(3, 1)
+	last = ls.OptInteger(4, last)
+
+	b := NewBuffer(ls)
+	for ; i < last; i++ {
+		_addField(ls, b, i)
+		b.AddString(sep)
+	}
+	if i == last { // 最后一个元素后面没有分隔符
+		_addField(ls, b, i)
+	}
+	b.PushResult()
+	return 1
+}
+
+func _addField(ls LuaState, b *Buffer, i int64) {
+	ls.GetI(1, i)
+	if !ls.IsString(-1) {
+		ls.Error2("invalid value (at index %d) in table for 'concat'", i)
+	}
+	b.AddValue()
+}
+
+// table.pack (···)
+// 返回一个新表，全部参数依次保存在键1、2...里，参数总数保存在字段n里
+func tabPack(ls LuaState) int {
+	n := ls.GetTop() // 参数数量
+	ls.CreateTable(n, 1)
+	ls.Insert(1) // 把新表放到参数的下面
+	for i := n; i >= 1; i-- {
+		ls.SetI(1, int64(i))
+	}
+	ls.PushInteger(int64(n))
+	ls.SetField(1, "n") // t.n = 参数数量
+	return 1            // 返回新表
+}
+
+// table.unpack (list [, i [, j]])
+// 返回list[i]、list[i+1]...list[j]，i默认为1，j默认为#list
+func tabUnpack(ls LuaState) int {
+	i := ls.OptInteger(2, 1)
+	var e int64
+	if ls.IsNoneOrNil(3) {
+		e = ls.Len2(1)
+	} else {
+		e = ls.CheckInteger(3)
+	}
+	if i > e { // 空区间
+		return 0
+	}
+	n := uint64(e) - uint64(i) // 返回值的数量减1
+	if n >= math.MaxInt32 || !ls.CheckStack(int(n+1)) {
+		return ls.Error2("too many results to unpack")
+	}
+	for ; i < e; i++ { // 这样写可以避免e为math.maxinteger时溢出
+		ls.GetI(1, i)
+	}
+	ls.GetI(1, e) // 最后一个元素
+	return int(n + 1)
+}
+
+/*
+ *table.sort (list [, comp])
+ *原地排序list[1]到list[#list]，comp(a, b)在a必须排在b前面时返回true，默认使用<运算符
+ *排序算法与官方实现一样是快速排序，不是稳定排序。比较函数不满足严格弱序时，可能会抛出"invalid order function for sorting"错误
+ */
+func tabSort(ls LuaState) int {
+	n := auxGetN(ls, 1, TAB_RW)
+	if n > 1 { // 不止一个元素才需要排序
+		ls.ArgCheck(n < math.MaxInt32, 1, "array too big")
+		if !ls.IsNoneOrNil(2) { // 有比较函数
+			ls.CheckType(2, LUA_TFUNCTION)
+		}
+		ls.SetTop(2) // 确保栈里正好有两个值
+		_auxSort(ls, 1, uint(n), 0)
+	}
+	return 0
+}
+
+// 子数组长度超过这个数时，随机选择主元，避免被构造的输入拖慢到平方复杂度
+const RANLIMIT = 100
+
+// 对list[lo]到list[up]进行快速排序，rnd不为0时用来随机选择主元
+func _auxSort(ls LuaState, lo, up, rnd uint) {
+	for lo < up { // 对较大的那一半循环处理，较小的那一半递归处理
+		//对lo、p和up这三个元素排序，p作为主元
+		ls.GetI(1, int64(lo))
+		ls.GetI(1, int64(up))
+		if _sortComp(ls, -1, -2) { // a[up] < a[lo]?
+			_set2(ls, lo, up) // 交换a[lo]和a[up]
+		} else {
+			ls.Pop(2)
+		}
+		if up-lo == 1 { // 只有2个元素
+			break
+		}
+
+		var p uint // 主元的位置
+		if up-lo < RANLIMIT || rnd == 0 {
+			p = (lo + up) / 2
+		} else {
+			p = _choosePivot(lo, up, rnd)
+		}
+		ls.GetI(1, int64(p))
+		ls.GetI(1, int64(lo))
+		if _sortComp(ls, -2, -1) { // a[p] < a[lo]?
+			_set2(ls, p, lo)
+		} else {
+			ls.Pop(1) // 弹出a[lo]
+			ls.GetI(1, int64(up))
+			if _sortComp(ls, -1, -2) { // a[up] < a[p]?
+				_set2(ls, p, up)
+			} else {
+				ls.Pop(2)
+			}
+		}
+		if up-lo == 2 { // 只有3个元素，已经排好了
+			break
+		}
+
+		ls.GetI(1, int64(p)) // 主元
+		ls.PushValue(-1)     // 留一份在栈里，分区时使用
+		ls.GetI(1, int64(up-1))
+		_set2(ls, p, up-1) // a[p] = a[up - 1]; a[up - 1] = 主元
+		p = _partition(ls, lo, up)
+
+		var n uint // 较小那一半的大小
+		if p-lo < up-p {
+			_auxSort(ls, lo, p-1, rnd) // 递归处理较小的一半
+			n = p - lo
+			lo = p + 1 // 循环处理较大的一半
+		} else {
+			_auxSort(ls, p+1, up, rnd)
+			n = up - p
+			up = p - 1
+		}
+		if (up-lo)/128 > n { // 分区太不平衡了，改为随机选择主元
+			rnd = uint(time.Now().UnixNano())
+		}
+	}
+}
+
+/*
+ *分区：主元P位于栈顶，也在a[up - 1]处，a[lo] <= P <= a[up]已经成立
+ *分区之后，a[lo .. i - 1] <= a[i] == P <= a[i + 1 .. up]，返回i
+ */
+func _partition(ls LuaState, lo, up uint) uint {
+	i := lo     // 会先加1
+	j := up - 1 // 会先减1
+	for {
+		//从左往右找到一个不小于P的元素
+		for {
+			i++
+			ls.GetI(1, int64(i))
+			if !_sortComp(ls, -1, -2) { // a[i] >= P
+				break
+			}
+			if i == up-1 { // a[i] < P，但是a[up - 1] == P
+				ls.Error2("invalid order function for sorting")
+			}
+			ls.Pop(1)
+		}
+		//从右往左找到一个不大于P的元素
+		for {
+			j--
+			ls.GetI(1, int64(j))
+			if !_sortComp(ls, -3, -1) { // P >= a[j]
+				break
+			}
+			if j < i { // j < i，但是a[j] > P
+				ls.Error2("invalid order function for sorting")
+			}
+			ls.Pop(1)
+		}
+		if j < i { // 没有需要交换的元素了
+			ls.Pop(1)          // 弹出a[j]
+			_set2(ls, up-1, i) // 交换主元a[up - 1]和a[i]
+			return i
+		}
+		_set2(ls, i, j) // 交换a[i]和a[j]
+	}
+}
+
+// 在区间中间的一半里随机选择主元
+func _choosePivot(lo, up, rnd uint) uint {
+	r4 := (up - lo) / 4 // 区间长度的1/4
+	return rnd%(r4*2) + (lo + r4)
+}
+
+// 把栈顶的两个值分别设置到a[i]和a[j]里（栈顶的值给a[i]）
+func _set2(ls LuaState, i, j uint) {
+	ls.SetI(1, int64(i))
+	ls.SetI(1, int64(j))
+}
+
+// 比较a和b两个索引处的值，a必须排在b的前面时返回true
+func _sortComp(ls LuaState, a, b int) bool {
+	if ls.IsNil(2) { // 没有比较函数
+		return ls.Compare(a, b, LUA_OPLT) // a < b
+	}
+	ls.PushValue(2)     // 比较函数
+	ls.PushValue(a - 1) // 压入了1个值，a的相对索引要减1
+	ls.PushValue(b - 2) // 压入了2个值
+	ls.Call(2, 1)
+	res := ls.ToBoolean(-1)
+	ls.Pop(1)
+	return res
+}
@@ -0,0 +1,243 @@
+/*
+ *UTF-8库：与官方实现（Lua 5.3的lutf8lib.c）一样，只处理UTF-8编码本身，不涉及Unicode字符的属性
+ *字符串的位置都是字节位置（从1开始，负数表示从末尾开始数），遇到不合法的字节序列时的行为也与官方实现一致
+ *注意不能直接使用Go的unicode/utf8包：它会把代理对（U+D800~U+DFFF）当作不合法的编码，而Lua 5.3允许
+ */
+package stdlib
+
+import (
+	. "luago/api"
+)
+
+// Unicode的最大码点
+const MAXUNICODE = 0x10FFFF
+
+// 精确匹配一个UTF-8字节序列的模式（假设字符串是合法的UTF-8）
+const UTF8PATT = "[\x00-\x7F\xC2-\xF4][\x80-\xBF]*"
+
+var utf8Lib = FuncReg{
+	"offset":    utf8ByteOffset,
+	"codepoint": utf8CodePoint,
+	"char":      utf8Char,
+	"len":       utf8Len,
+	"codes":     utf8IterCodes,
+}
+
+// 打开UTF-8库，返回utf8表
+func OpenUTF8(ls LuaState) int {
+	ls.NewLib(utf8Lib)
+	ls.PushString(UTF8PATT)
+	ls.SetField(-2, "charpattern")
+	return 1
+}
+
+// 判断s[i]是不是UTF-8的后续字节（10xxxxxx），与C语言字符串末尾的'\0'一样，超出字符串的位置不是后续字节
+func isCont(s string, i int64) bool {
+	return i < int64(len(s)) && s[i]&0xC0 == 0x80
+}
+
+/*
+ *解码从s[i]开始的一个UTF-8字节序列，返回码点和下一个字节序列的位置，不合法时返回-1
+ *与官方实现一样，拒绝超过4个字节的序列、超过MAXUNICODE的码点以及过长的编码（比如用两个字节表示ASCII字符）
+ */
+func utf8Decode(s string, i int64) (code rune, next int64) {
+	limits := [...]uint32{0xFF, 0x7F, 0x7FF, 0xFFFF}
+	c := uint32(s[i])
+	var res uint32
+	if c < 0x80 { // ASCII字符
+		res = c
+	} else {
+		count := 0                   // 后续字节的数量
+		for ; c&0x40 != 0; c <<= 1 { // 首字节里还有后续字节的标记位？
+			count++
+			if !isCont(s, i+int64(count)) {
+				return 0, -1 // 不是后续字节
+			}
+			res = res<<6 | uint32(s[i+int64(count)])&0x3F // 加上后续字节的有效位
+		}
+		res |= (c & 0x7F) << (count * 5) // 加上首字节的有效位
+		if count > 3 || res > MAXUNICODE || res <= limits[count] {
+			return 0, -1
+		}
+		i += int64(count)
+	}
+	return rune(res), i + 1
+}
+
+// 把码点编码成UTF-8字节序列（相当于官方实现里的luaO_utf8esc），代理对也会被正常编码
+func utf8Encode(x uint32) string {
+	if x < 0x80 { // ASCII字符
+		return string([]byte{byte(x)})
+	}
+	var buff [8]byte
+	n := len(buff)      // 从后往前填
+	mfb := uint32(0x3F) // 首字节里能放下的最大值
+	for {
+		n--
+		buff[n] = byte(0x80 | x&0x3F) // 后续字节
+		x >>= 6
+		mfb >>= 1 // 首字节里能放下的位数少了一位
+		if x <= mfb {
+			break
+		}
+	}
+	n--
+	buff[n] = byte(^mfb<<1 | x) // 首字节
+	return string(buff[n:])
+}
+
+// utf8.len (s [, i [, j]])
+// 返回s里从位置i（默认为1）到j（默认为-1）之间开始的UTF-8字符的数量，如果遇到不合法的字节序列，返回nil和它的位置
+func utf8Len(ls LuaState) int {
+	s := ls.CheckString(1)
+	sLen := int64(len(s))
+	posi := posRelat(ls.OptInteger(2, 1), sLen)
+	posj := posRelat(ls.OptInteger(3, -1), sLen)
+	ls.ArgCheck(1 <= posi && posi-1 <= sLen, 2, "initial position out of string")
+	posi--
+	posj--
+	ls.ArgCheck(posj < sLen, 3, "final position out of string")
+	n := int64(0)
+	for posi <= posj {
+		_, next := utf8Decode(s, posi)
+		if next < 0 { // 不合法的字节序列
+			ls.PushNil()
+			ls.PushInteger(posi + 1)
+			return 2
+		}
+		posi = next
+		n++
+	}
+	ls.PushInteger(n)
+	return 1
+}
+
+// utf8.codepoint (s [, i [, j]])
+// 返回s里从位置i（默认为1）到j（默认为i）之间开始的全部字符的码点，遇到不合法的字节序列时抛出错误
+func utf8CodePoint(ls LuaState) int {
+	s := ls.CheckString(1)
+	sLen := int64(len(s))
+	posi := posRelat(ls.OptInteger(2, 1), sLen)
+	pose := posRelat(ls.OptInteger(3, posi), sLen)
+	ls.ArgCheck(posi >= 1, 2, "out of range")
+	ls.ArgCheck(pose <= sLen, 3, "out of range")
+	if posi > pose {
+		return 0 // 空区间
+	}
+	if pose-posi >= MAX_STRING_SIZE {
+		return ls.Error2("string slice too long")
+	}
+	ls.CheckStack2(int(pose-posi)+1, "string slice too long")
+	n := 0
+	for i := posi - 1; i < pose; {
+		code, next := utf8Decode(s, i)
+		if next < 0 {
+			return ls.Error2("invalid UTF-8 code")
+		}
+		ls.PushInteger(int64(code))
+		n++
+		i = next
+	}
+	return n
+}
+
+// utf8.char (···)
+// 把每个参数（码点）转换成UTF-8字节序列，返回把它们连接起来的字符串
+func utf8Char(ls LuaState) int {
+	n := ls.GetTop() // 参数数量
+	b := NewBuffer(ls)
+	for i := 1; i <= n; i++ {
+		code := ls.CheckInteger(i)
+		ls.ArgCheck(0 <= code && code <= MAXUNICODE, i, "value out of range")
+		b.AddString(utf8Encode(uint32(code)))
+	}
+	b.PushResult()
+	return 1
+}
+
+/*
+ *utf8.offset (s, n [, i])
+ *返回s里第n个字符（从位置i开始数）的起始位置，n为负数时往前数，n为0时返回包含位置i的字符的起始位置
+ *n为正数时i默认为1，否则默认为#s + 1；如果没有第n个字符，返回nil
+ */
+func utf8ByteOffset(ls LuaState) int {
+	s := ls.CheckString(1)
+	sLen := int64(len(s))
+	n := ls.CheckInteger(2)
+	posi := int64(1)
+	if n < 0 {
+		posi = sLen + 1
+	}
+	posi = posRelat(ls.OptInteger(3, posi), sLen)
+	ls.ArgCheck(1 <= posi && posi-1 <= sLen, 3, "position out of range")
+	posi--
+	if n == 0 {
+		//找到包含posi的字符的起始位置
+		for posi > 0 && isCont(s, posi) {
+			posi--
+		}
+	} else {
+		if isCont(s, posi) {
+			return ls.Error2("initial position is a continuation byte")
+		}
+		if n < 0 {
+			for n < 0 && posi > 0 { // 往前移动
+				posi--
+				for posi > 0 && isCont(s, posi) { // 移动到前一个字符的起始位置
+					posi--
+				}
+				n++
+			}
+		} else {
+			n--                        // 不需要移动就到第一个字符了
+			for n > 0 && posi < sLen { // 往后移动
+				posi++
+				for isCont(s, posi) { // 移动到下一个字符的起始位置（不会超过字符串末尾）
+					posi++
+				}
+				n--
+			}
+		}
+	}
+	if n == 0 { // 找到了
+		ls.PushInteger(posi + 1)
+	} else { // 没有第n个字符
+		ls.PushNil()
+	}
+	return 1
+}
+
+// utf8.codes (s)
+// 返回泛型for使用的迭代器，依次返回s里每个字符的位置和码点，遇到不合法的字节序列时抛出错误
+func utf8IterCodes(ls LuaState) int {
+	ls.CheckString(1)
+	ls.PushGoFunction(_iterAux)
+	ls.PushValue(1)
+	ls.PushInteger(0)
+	return 3
+}
+
+// utf8.codes返回的迭代器，控制变量是上一个字符的位置
+func _iterAux(ls LuaState) int {
+	s := ls.CheckString(1)
+	sLen := int64(len(s))
+	n := ls.ToInteger(2) - 1
+	if n < 0 { // 第一次迭代
+		n = 0
+	} else if n < sLen {
+		n++ // 跳过上一个字符的首字节
+		for isCont(s, n) {
+			n++ // 跳过后续字节
+		}
+	}
+	if n >= sLen {
+		return 0 // 没有更多字符了
+	}
+	code, next := utf8Decode(s, n)
+	if next < 0 || isCont(s, next) {
+		return ls.Error2("invalid UTF-8 code")
+	}
+	ls.PushInteger(n + 1)
+	ls.PushInteger(int64(code))
+	return 2
+}
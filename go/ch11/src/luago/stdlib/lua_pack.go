@@ -0,0 +1,235 @@
+/*
+ *string.pack、string.unpack和string.packsize使用的二进制打包格式，对照官方实现（lstrlib.c）移植
+ *格式字符串由一系列选项组成：
+ *	< > = !	设置小端、大端、本机字节序和最大对齐
+ *	b B h H l L j J T	各种大小的有符号/无符号整数
+ *	i[n] I[n]	n字节的有符号/无符号整数
+ *	f d n	float、double和Lua浮点数
+ *	s[n] z c[n]	长度前缀的字符串、以'\0'结尾的字符串和定长字符串
+ *	x X[op]	一个字节的填充和按照选项op对齐
+ */
+package stdlib
+
+import (
+	"encoding/binary"
+	. "luago/api"
+	"unsafe"
+)
+
+const (
+	MAXINTSIZE       = 16   // 整数选项（i[n]、s[n]等）的最大字节数
+	NB               = 8    // 一个字节的比特数
+	MC               = 0xff // 一个字节的掩码
+	SZINT            = 8    // lua_Integer的字节数
+	MAXALIGN         = 8    // 默认的最大对齐
+	LUAL_PACKPADBYTE = 0x00 // 填充字节
+)
+
+// 选项的种类
+const (
+	Kint       = iota // 有符号整数
+	Kuint             // 无符号整数
+	Kfloat            // float
+	Knumber           // Lua浮点数
+	Kdouble           // double
+	Kchar             // 定长字符串
+	Kstring           // 长度前缀的字符串
+	Kzstr             // 以'\0'结尾的字符串
+	Kpadding          // 填充
+	Kpaddalign        // 对齐
+	Knop              // 不产生数据的选项（比如设置字节序）
+)
+
+// 本机是否是小端字节序
+var nativeIsLittle = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// 打包/解包过程中的状态
+type packHeader struct {
+	ls       LuaState
+	fmt      string // 剩余的格式字符串
+	isLittle bool
+	maxAlign int
+}
+
+func newPackHeader(ls LuaState, fmt string) *packHeader {
+	return &packHeader{ls: ls, fmt: fmt, isLittle: nativeIsLittle, maxAlign: 1}
+}
+
+func (self *packHeader) byteOrder() binary.ByteOrder {
+	if self.isLittle {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// 读取格式字符串里的数字，没有数字则返回默认值df
+func (self *packHeader) getNum(df int) int {
+	if len(self.fmt) == 0 || !isDigit(self.fmt[0]) {
+		return df
+	}
+	a := 0
+	for len(self.fmt) > 0 && isDigit(self.fmt[0]) && a <= (MAX_STRING_SIZE-9)/10 {
+		a = a*10 + int(self.fmt[0]-'0')
+		self.fmt = self.fmt[1:]
+	}
+	return a
+}
+
+// 读取整数的大小，必须在1到MAXINTSIZE之间
+func (self *packHeader) getNumLimit(df int) int {
+	sz := self.getNum(df)
+	if sz > MAXINTSIZE || sz <= 0 {
+		self.ls.Error2("integral size (%d) out of limits [1,%d]", sz, MAXINTSIZE)
+	}
+	return sz
+}
+
+// 读取下一个选项，返回选项的种类和大小
+func (self *packHeader) getOption() (opt, size int) {
+	c := self.fmt[0]
+	self.fmt = self.fmt[1:]
+	switch c {
+	case 'b':
+		return Kint, 1
+	case 'B':
+		return Kuint, 1
+	case 'h':
+		return Kint, 2
+	case 'H':
+		return Kuint, 2
+	case 'l', 'j':
+		return Kint, 8
+	case 'L', 'J', 'T':
+		return Kuint, 8
+	case 'f':
+		return Kfloat, 4
+	case 'd':
+		return Kdouble, 8
+	case 'n':
+		return Knumber, 8
+	case 'i':
+		return Kint, self.getNumLimit(4)
+	case 'I':
+		return Kuint, self.getNumLimit(4)
+	case 's':
+		return Kstring, self.getNumLimit(8)
+	case 'c':
+		size = self.getNum(-1)
+		if size == -1 {
+			self.ls.Error2("missing size for format option 'c'")
+		}
+		return Kchar, size
+	case 'z':
+		return Kzstr, 0
+	case 'x':
+		return Kpadding, 1
+	case 'X':
+		return Kpaddalign, 0
+	case ' ':
+	case '<':
+		self.isLittle = true
+	case '>':
+		self.isLittle = false
+	case '=':
+		self.isLittle = nativeIsLittle
+	case '!':
+		self.maxAlign = self.getNumLimit(MAXALIGN)
+	default:
+		self.ls.Error2("invalid format option '%c'", c)
+	}
+	return Knop, 0
+}
+
+/*
+ *读取下一个选项，除了种类和大小之外，还计算出为了对齐需要填充的字节数
+ *totalSize是到目前为止已经打包（或者解包）的字节数
+ */
+func (self *packHeader) getDetails(totalSize int) (opt, size, nToAlign int) {
+	opt, size = self.getOption()
+	align := size          // 一般按照选项本身的大小对齐
+	if opt == Kpaddalign { // X按照下一个选项的大小对齐
+		if len(self.fmt) == 0 {
+			self.ls.ArgError(1, "invalid next option for option 'X'")
+		} else {
+			var nextOpt int
+			nextOpt, align = self.getOption()
+			if nextOpt == Kchar || align == 0 {
+				self.ls.ArgError(1, "invalid next option for option 'X'")
+			}
+		}
+	}
+	if align <= 1 || opt == Kchar { // 不需要对齐
+		return opt, size, 0
+	}
+	if align > self.maxAlign {
+		align = self.maxAlign
+	}
+	if align&(align-1) != 0 {
+		self.ls.ArgError(1, "format asks for alignment not power of 2")
+	}
+	nToAlign = (align - totalSize&(align-1)) & (align - 1)
+	return opt, size, nToAlign
+}
+
+// 把整数n按照指定的字节序打包成size个字节，如果size大于8，neg为true时高位字节用0xff填充
+func (self *packHeader) packInt(b *Buffer, n uint64, size int, neg bool) {
+	buff := make([]byte, size)
+	for i := 0; i < size; i++ {
+		var c byte
+		if i < SZINT {
+			c = byte(n & MC)
+			n >>= NB
+		} else if neg {
+			c = MC
+		}
+		if self.isLittle {
+			buff[i] = c
+		} else {
+			buff[size-1-i] = c
+		}
+	}
+	b.AddString(string(buff))
+}
+
+// 把size个字节按照指定的字节序解包成整数，如果size大于8，多出来的高位字节只能是符号扩展
+func (self *packHeader) unpackInt(str string, size int, isSigned bool) int64 {
+	var res uint64
+	limit := size
+	if limit > SZINT {
+		limit = SZINT
+	}
+	for i := limit - 1; i >= 0; i-- {
+		res <<= NB
+		if self.isLittle {
+			res |= uint64(str[i])
+		} else {
+			res |= uint64(str[size-1-i])
+		}
+	}
+	if size < SZINT { // 需要符号扩展
+		if isSigned {
+			mask := uint64(1) << (size*NB - 1)
+			res = (res ^ mask) - mask
+		}
+	} else if size > SZINT { // 检查多出来的字节
+		var mask byte
+		if isSigned && int64(res) < 0 {
+			mask = MC
+		}
+		for i := limit; i < size; i++ {
+			var c byte
+			if self.isLittle {
+				c = str[i]
+			} else {
+				c = str[size-1-i]
+			}
+			if c != mask {
+				self.ls.Error2("%d-byte integer does not fit into Lua Integer", size)
+			}
+		}
+	}
+	return int64(res)
+}
@@ -0,0 +1,427 @@
+/*
+ *Lua模式匹配引擎，逐行对照官方实现（lstrlib.c）移植，供string.find、match、gmatch、gsub使用
+ *模式不是正则表达式：没有“或”运算，量词只能作用于单个字符类，但是支持%b()、%f[set]和后向引用%1等
+ *为了与C版本保持一致，源字符串和模式都用下标表示位置，-1相当于C版本里的NULL（匹配失败）
+ */
+package stdlib
+
+import (
+	. "luago/api"
+)
+
+const (
+	LUA_MAXCAPTURES = 32  // 一个模式最多可以有多少个捕获
+	MAXCCALLS       = 200 // match()的最大递归深度
+	L_ESC           = '%' // 模式里的转义字符
+	SPECIALS        = "^$*+?.([%-"
+)
+
+// 捕获的长度字段的两个特殊值
+const (
+	CAP_UNFINISHED = -1 // 捕获还没有结束（还没有遇到右括号）
+	CAP_POSITION   = -2 // 位置捕获()
+)
+
+type capture struct {
+	init int // 捕获在源字符串里的起始位置
+	len  int // 捕获的长度，或者CAP_UNFINISHED、CAP_POSITION
+}
+
+// 匹配状态
+type matchState struct {
+	ls         LuaState
+	src        string // 源字符串
+	pat        string // 模式（已经去掉了开头的'^'）
+	matchdepth int    // 剩余的递归深度，用完了说明模式太复杂
+	level      int    // 当前捕获的数量（包括没有结束的）
+	capture    [LUA_MAXCAPTURES]capture
+}
+
+func newMatchState(ls LuaState, src, pat string) *matchState {
+	return &matchState{ls: ls, src: src, pat: pat, matchdepth: MAXCCALLS}
+}
+
+// 每次尝试匹配之前都要重置状态
+func (self *matchState) reprepstate() {
+	self.level = 0
+	self.matchdepth = MAXCCALLS
+}
+
+// 后向引用%1~%9：检查捕获索引是否有效并返回从0开始的索引
+func (self *matchState) checkCapture(l byte) int {
+	i := int(l) - '1'
+	if i < 0 || i >= self.level || self.capture[i].len == CAP_UNFINISHED {
+		self.ls.Error2("invalid capture index %%%d", i+1)
+	}
+	return i
+}
+
+// 遇到右括号时，找到最近一个还没有结束的捕获
+func (self *matchState) captureToClose() int {
+	level := self.level - 1
+	for ; level >= 0; level-- {
+		if self.capture[level].len == CAP_UNFINISHED {
+			return level
+		}
+	}
+	self.ls.Error2("invalid pattern capture")
+	return 0
+}
+
+// 返回从p开始的单个字符类（比如"a"、"%d"、"[a-z]"）之后的位置
+func (self *matchState) classEnd(p int) int {
+	pat := self.pat
+	c := pat[p]
+	p++
+	if c == L_ESC {
+		if p >= len(pat) {
+			self.ls.Error2("malformed pattern (ends with '%%')")
+		}
+		return p + 1
+	}
+	if c == '[' {
+		if p < len(pat) && pat[p] == '^' {
+			p++
+		}
+		for { // 查找']'，第一个字符即使是']'也当作普通字符
+			if p >= len(pat) {
+				self.ls.Error2("malformed pattern (missing ']')")
+			}
+			c := pat[p]
+			p++
+			if c == L_ESC && p < len(pat) {
+				p++ // 跳过转义的字符（比如'%]'）
+			}
+			if p < len(pat) && pat[p] == ']' {
+				break
+			}
+		}
+		return p + 1
+	}
+	return p
+}
+
+// 判断字符c是否属于字符类%cl，大写的类表示取反
+func matchClass(c, cl byte) bool {
+	var res bool
+	switch toLower(cl) {
+	case 'a':
+		res = isAlpha(c)
+	case 'c':
+		res = c < 32 || c == 127
+	case 'd':
+		res = isDigit(c)
+	case 'g':
+		res = 33 <= c && c <= 126
+	case 'l':
+		res = 'a' <= c && c <= 'z'
+	case 'p':
+		res = isPunct(c)
+	case 's':
+		res = c == ' ' || ('\t' <= c && c <= '\r')
+	case 'u':
+		res = 'A' <= c && c <= 'Z'
+	case 'w':
+		res = isAlpha(c) || isDigit(c)
+	case 'x':
+		res = isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+	default:
+		return cl == c // 不是字符类，比如"%."，只匹配字符本身
+	}
+	if 'A' <= cl && cl <= 'Z' {
+		return !res
+	}
+	return res
+}
+
+// 判断字符c是否属于集合[...]，p指向'['，ec指向']'
+func (self *matchState) matchBracketClass(c byte, p, ec int) bool {
+	pat := self.pat
+	sig := true
+	if pat[p+1] == '^' {
+		sig = false
+		p++ // 跳过'^'
+	}
+	for p++; p < ec; p++ {
+		if pat[p] == L_ESC {
+			p++
+			if matchClass(c, pat[p]) {
+				return sig
+			}
+		} else if pat[p+1] == '-' && p+2 < ec {
+			p += 2
+			if pat[p-2] <= c && c <= pat[p] {
+				return sig
+			}
+		} else if pat[p] == c {
+			return sig
+		}
+	}
+	return !sig
+}
+
+// 判断源字符串s处的字符是否匹配从p到ep的单个字符类
+func (self *matchState) singleMatch(s, p, ep int) bool {
+	if s >= len(self.src) {
+		return false
+	}
+	c := self.src[s]
+	switch self.pat[p] {
+	case '.':
+		return true // 匹配任意字符
+	case L_ESC:
+		return matchClass(c, self.pat[p+1])
+	case '[':
+		return self.matchBracketClass(c, p, ep-1)
+	default:
+		return self.pat[p] == c
+	}
+}
+
+// %bxy：匹配以x开始、以y结束并且x和y成对出现的子串
+func (self *matchState) matchBalance(s, p int) int {
+	if p+1 >= len(self.pat) {
+		self.ls.Error2("malformed pattern (missing arguments to '%%b')")
+	}
+	if s >= len(self.src) || self.src[s] != self.pat[p] {
+		return -1
+	}
+	b, e := self.pat[p], self.pat[p+1]
+	cont := 1
+	for s++; s < len(self.src); s++ {
+		if self.src[s] == e {
+			if cont--; cont == 0 {
+				return s + 1
+			}
+		} else if self.src[s] == b {
+			cont++
+		}
+	}
+	return -1 // 字符串结束了，还没有配对
+}
+
+// 贪婪匹配（*和+）：先尽可能多地匹配，再逐个回退，直到模式的剩余部分匹配成功
+func (self *matchState) maxExpand(s, p, ep int) int {
+	i := 0
+	for self.singleMatch(s+i, p, ep) {
+		i++
+	}
+	for ; i >= 0; i-- {
+		if res := self.match(s+i, ep+1); res != -1 {
+			return res
+		}
+	}
+	return -1
+}
+
+// 非贪婪匹配（-）：先尝试匹配模式的剩余部分，失败了再多匹配一个字符
+func (self *matchState) minExpand(s, p, ep int) int {
+	for {
+		if res := self.match(s, ep+1); res != -1 {
+			return res
+		} else if self.singleMatch(s, p, ep) {
+			s++
+		} else {
+			return -1
+		}
+	}
+}
+
+func (self *matchState) startCapture(s, p, what int) int {
+	if self.level >= LUA_MAXCAPTURES {
+		self.ls.Error2("too many captures")
+	}
+	self.capture[self.level].init = s
+	self.capture[self.level].len = what
+	self.level++
+	res := self.match(s, p)
+	if res == -1 {
+		self.level-- // 匹配失败，撤销捕获
+	}
+	return res
+}
+
+func (self *matchState) endCapture(s, p int) int {
+	l := self.captureToClose()
+	self.capture[l].len = s - self.capture[l].init // 结束捕获
+	res := self.match(s, p)
+	if res == -1 {
+		self.capture[l].len = CAP_UNFINISHED // 匹配失败，撤销
+	}
+	return res
+}
+
+// 后向引用：源字符串s处必须与第l个捕获的内容相同
+func (self *matchState) matchCapture(s int, l byte) int {
+	i := self.checkCapture(l)
+	init, n := self.capture[i].init, self.capture[i].len
+	//位置捕获的长度是CAP_POSITION（负数），什么都匹配不上（官方实现里转成size_t之后是一个很大的数，效果相同）
+	if n >= 0 && len(self.src)-s >= n && self.src[init:init+n] == self.src[s:s+n] {
+		return s + n
+	}
+	return -1
+}
+
+/*
+ *从源字符串的s处开始匹配从p开始的模式，匹配成功返回匹配结束的位置，失败返回-1
+ *为了减少递归，模式里的普通字符类用循环（相当于C版本里的goto init）处理，只有需要回溯时才递归
+ */
+func (self *matchState) match(s, p int) int {
+	if self.matchdepth == 0 {
+		self.ls.Error2("pattern too complex")
+	}
+	self.matchdepth--
+	pat := self.pat
+
+	for p < len(pat) { // 模式还没有结束
+		switch pat[p] {
+		case '(': // 开始捕获
+			if p+1 < len(pat) && pat[p+1] == ')' { // 位置捕获
+				s = self.startCapture(s, p+2, CAP_POSITION)
+			} else {
+				s = self.startCapture(s, p+1, CAP_UNFINISHED)
+			}
+			goto end
+		case ')': // 结束捕获
+			s = self.endCapture(s, p+1)
+			goto end
+		case '$':
+			if p+1 == len(pat) { // 模式最后的'$'表示锚定字符串结尾
+				if s != len(self.src) {
+					s = -1
+				}
+				goto end
+			}
+		case L_ESC:
+			if p+1 < len(pat) {
+				switch pat[p+1] {
+				case 'b': // 平衡匹配%bxy
+					if s = self.matchBalance(s, p+2); s != -1 {
+						p += 4
+						continue
+					}
+					goto end
+				case 'f': // 边界模式%f[set]
+					p += 2
+					if p >= len(pat) || pat[p] != '[' {
+						self.ls.Error2("missing '[' after '%%f' in pattern")
+					}
+					ep := self.classEnd(p)
+					var prev, cur byte // 字符串开头之前和结尾之后都当作'\0'
+					if s > 0 {
+						prev = self.src[s-1]
+					}
+					if s < len(self.src) {
+						cur = self.src[s]
+					}
+					if !self.matchBracketClass(prev, p, ep-1) &&
+						self.matchBracketClass(cur, p, ep-1) {
+						p = ep
+						continue
+					}
+					s = -1
+					goto end
+				case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9': // 后向引用%0~%9
+					if s = self.matchCapture(s, pat[p+1]); s != -1 {
+						p += 2
+						continue
+					}
+					goto end
+				}
+			}
+		}
+
+		// 默认情况：单个字符类，后面可能跟着量词
+		ep := self.classEnd(p)
+		var q byte // 量词
+		if ep < len(pat) {
+			q = pat[ep]
+		}
+		if !self.singleMatch(s, p, ep) {
+			if q == '*' || q == '?' || q == '-' { // 允许匹配0次
+				p = ep + 1
+				continue
+			}
+			s = -1 // 匹配失败
+		} else { // 匹配了一个字符
+			switch q {
+			case '?':
+				if res := self.match(s+1, ep+1); res != -1 {
+					s = res
+				} else {
+					p = ep + 1
+					continue
+				}
+			case '+': // 至少匹配1次
+				s = self.maxExpand(s+1, p, ep)
+			case '*':
+				s = self.maxExpand(s, p, ep)
+			case '-':
+				s = self.minExpand(s, p, ep)
+			default: // 没有量词，继续匹配下一个字符类
+				s++
+				p = ep
+				continue
+			}
+		}
+		goto end
+	}
+
+end:
+	self.matchdepth++
+	return s
+}
+
+// 把第i个捕获推入栈顶，如果模式里没有捕获，第0个捕获就是整个匹配（从s到e）
+func (self *matchState) pushOneCapture(i, s, e int) {
+	if i >= self.level {
+		if i != 0 {
+			self.ls.Error2("invalid capture index %%%d", i+1)
+		}
+		self.ls.PushString(self.src[s:e]) // 整个匹配
+		return
+	}
+	init, l := self.capture[i].init, self.capture[i].len
+	if l == CAP_UNFINISHED {
+		self.ls.Error2("unfinished capture")
+	}
+	if l == CAP_POSITION {
+		self.ls.PushInteger(int64(init + 1))
+	} else {
+		self.ls.PushString(self.src[init : init+l])
+	}
+}
+
+// 把全部捕获推入栈顶并返回数量，s为-1时表示没有整个匹配可用（模式里没有捕获时什么也不推入）
+func (self *matchState) pushCaptures(s, e int) int {
+	nLevels := self.level
+	if nLevels == 0 && s != -1 {
+		nLevels = 1
+	}
+	self.ls.CheckStack2(nLevels, "too many captures")
+	for i := 0; i < nLevels; i++ {
+		self.pushOneCapture(i, s, e)
+	}
+	return nLevels
+}
+
+/* C语言里ctype.h的字符分类函数（按照C语言区域设置） */
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isPunct(c byte) bool {
+	return 33 <= c && c <= 126 && !isAlpha(c) && !isDigit(c)
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c - 'A' + 'a'
+	}
+	return c
+}
@@ -0,0 +1,64 @@
+/*
+ *math.random使用的伪随机数生成器：xoshiro256**，与Lua 5.4的官方实现（lmathlib.c）一致
+ *算法只用到了64位整数的移位、旋转、异或和乘法，所以相同的种子在任何平台上都会产生相同的随机数序列
+ *每次打开数学库都会创建一个新的生成器，作为random和randomseed的Upvalue，所以每个Lua解释器都有自己独立的状态
+ */
+package stdlib
+
+import (
+	"math/bits"
+)
+
+// 浮点数尾数的有效位数，用于把随机整数转换成[0,1)之间的浮点数
+const FIGS = 53
+
+type xoshiro256 struct {
+	s [4]uint64
+}
+
+// 生成下一个64位随机整数
+func (self *xoshiro256) next() uint64 {
+	s := &self.s
+	state0, state1, state2, state3 := s[0], s[1], s[2]^s[0], s[3]^s[1]
+	res := bits.RotateLeft64(state1*5, 7) * 9
+	s[0] = state0 ^ state3
+	s[1] = state1 ^ state2
+	s[2] = state2 ^ (state1 << 17)
+	s[3] = bits.RotateLeft64(state3, 45)
+	return res
+}
+
+// 用两个整数设置种子，然后丢弃前16个随机数，让种子的差异充分扩散
+func (self *xoshiro256) seed(n1, n2 uint64) {
+	self.s = [4]uint64{n1, 0xff, n2, 0}
+	for i := 0; i < 16; i++ {
+		self.next()
+	}
+}
+
+// 把随机整数转换成[0,1)之间的浮点数（取高53位）
+func i2d(x uint64) float64 {
+	return float64(x>>(64-FIGS)) * (0.5 / float64(uint64(1)<<(FIGS-1)))
+}
+
+/*
+ *把随机整数ran投影到[0,n]区间内，保证每个整数的概率相同
+ *先计算不小于n的最小的2^b-1作为掩码，如果掩码之后的结果大于n，就换一个随机数重新计算
+ */
+func (self *xoshiro256) project(ran, n uint64) uint64 {
+	if n&(n+1) == 0 { // n + 1是2的幂？
+		return ran & n
+	}
+	lim := n
+	//计算不小于n的最小的2^b-1
+	lim |= lim >> 1
+	lim |= lim >> 2
+	lim |= lim >> 4
+	lim |= lim >> 8
+	lim |= lim >> 16
+	lim |= lim >> 32
+	for ran &= lim; ran > n; ran &= lim {
+		ran = self.next()
+	}
+	return ran
+}
@@ -0,0 +1,345 @@
+/*
+ *io库使用的文件流（相当于官方实现里的LStream和C语言的FILE），包装了os.File或者Lua解释器的标准输入输出
+ *与C语言的FILE一样，同一个流既可以读也可以写，读写之间切换时需要处理缓冲区：
+ *写之前要把读缓冲区里预读的数据“退回”到文件里（把文件位置往回移动），读之前要把写缓冲区里的数据写到文件里
+ */
+package stdlib
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	. "luago/api"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// 缓冲区的默认大小（相当于官方实现里的LUAL_BUFFERSIZE）
+const LUAL_BUFFERSIZE = 4096
+
+// 读取数字时最多读取的字符数（相当于官方实现里的L_MAXLENNUM）
+const L_MAXLENNUM = 200
+
+// 缓冲模式（file:setvbuf()）
+const (
+	BUF_NO   = iota //不缓冲，每次写完立即输出
+	BUF_FULL        //全缓冲，缓冲区满了或者调用flush()时才输出
+	BUF_LINE        //行缓冲，写入换行符时输出
+)
+
+// 关闭流的函数，返回推入栈里的结果数量（相当于官方实现里的closef）
+type closeFunc func(ls LuaState, s *luaStream) int
+
+type luaStream struct {
+	file     *os.File      //打开的文件，标准输入输出为nil
+	out      io.Writer     //写缓冲区底层的输出
+	reader   *bufio.Reader //读缓冲区
+	writer   *bufio.Writer //写缓冲区
+	bufMode  int           //写缓冲区的缓冲模式
+	readable bool          //是否可读
+	writable bool          //是否可写
+	closeF   closeFunc     //关闭流的函数，为nil表示流已经关闭
+	tmpName  string        //io.tmpfile()创建的临时文件名，关闭时删除
+	err      error         //最近一次读写操作产生的错误（相当于C语言的ferror()）
+}
+
+// 包装打开的文件，使用全缓冲
+func newFileStream(f *os.File, readable, writable bool) *luaStream {
+	s := &luaStream{
+		file:     f,
+		out:      f,
+		reader:   bufio.NewReaderSize(f, LUAL_BUFFERSIZE),
+		writer:   bufio.NewWriterSize(f, LUAL_BUFFERSIZE),
+		bufMode:  BUF_FULL,
+		readable: readable,
+		writable: writable,
+	}
+	//如果脚本没有关闭文件，文件流被Go回收时至少要保证缓冲区里的数据被写到文件里，文件描述符也被释放
+	runtime.SetFinalizer(s, func(s *luaStream) {
+		if s.closeF != nil {
+			s.close()
+		}
+	})
+	return s
+}
+
+/*
+ *包装Lua解释器的标准输入、输出或者错误（which为0、1、2），不缓冲写入的数据
+ *每次读写的时候才去获取Lua解释器当前的标准流，所以宿主程序在打开io库之后替换标准流也能生效
+ */
+func newStdStream(ls LuaState, which int) *luaStream {
+	out := stdWriter{ls, which}
+	return &luaStream{
+		out:      out,
+		reader:   bufio.NewReaderSize(stdReader{ls}, LUAL_BUFFERSIZE),
+		writer:   bufio.NewWriterSize(out, LUAL_BUFFERSIZE),
+		bufMode:  BUF_NO,
+		readable: which == 0,
+		writable: which != 0,
+	}
+}
+
+type stdReader struct {
+	ls LuaState
+}
+
+func (self stdReader) Read(p []byte) (int, error) {
+	return self.ls.Stdin().Read(p)
+}
+
+type stdWriter struct {
+	ls    LuaState
+	which int
+}
+
+func (self stdWriter) Write(p []byte) (int, error) {
+	if self.which == 2 {
+		return self.ls.Stderr().Write(p)
+	}
+	return self.ls.Stdout().Write(p)
+}
+
+func (self *luaStream) isClosed() bool {
+	return self.closeF == nil
+}
+
+// 写之前把读缓冲区里预读但还没有被使用的数据退回到文件里
+func (self *luaStream) prepareWrite() {
+	if n := self.reader.Buffered(); n > 0 && self.file != nil {
+		_, err := self.file.Seek(int64(-n), io.SeekCurrent)
+		self.setError(err)
+		self.reader.Reset(self.file)
+	}
+}
+
+// 记录读写错误，EOF不算错误
+func (self *luaStream) setError(err error) {
+	if err != nil && err != io.EOF {
+		self.err = err
+	}
+}
+
+func (self *luaStream) write(s string) bool {
+	if !self.writable { // 与C语言一样，写只读的流会失败
+		self.err = syscall.EBADF
+		return false
+	}
+	self.prepareWrite()
+	_, err := self.writer.WriteString(s)
+	if err == nil {
+		switch self.bufMode {
+		case BUF_NO:
+			err = self.writer.Flush()
+		case BUF_LINE:
+			if strings.IndexByte(s, '\n') >= 0 {
+				err = self.writer.Flush()
+			}
+		}
+	}
+	self.setError(err)
+	return err == nil
+}
+
+func (self *luaStream) flush() error {
+	err := self.writer.Flush()
+	self.setError(err)
+	return err
+}
+
+// 移动文件位置，返回新的位置（从文件开头算起）
+func (self *luaStream) seek(offset int64, whence int) (int64, error) {
+	if self.file == nil {
+		return 0, syscall.ESPIPE // 标准输入输出不能移动位置
+	}
+	if err := self.writer.Flush(); err != nil {
+		return 0, err
+	}
+	if whence == io.SeekCurrent {
+		offset -= int64(self.reader.Buffered()) // 文件的实际位置在预读的数据之后
+	}
+	pos, err := self.file.Seek(offset, whence)
+	self.reader.Reset(self.file)
+	return pos, err
+}
+
+// 修改缓冲模式和缓冲区大小
+func (self *luaStream) setvbuf(mode, size int) error {
+	err := self.writer.Flush()
+	self.bufMode = mode
+	if size != self.writer.Size() {
+		self.writer = bufio.NewWriterSize(self.out, size)
+	}
+	return err
+}
+
+// 关闭文件：把缓冲区里的数据写到文件里，关闭文件，如果是临时文件则删除
+func (self *luaStream) close() error {
+	err := self.writer.Flush()
+	if self.file != nil {
+		if e := self.file.Close(); err == nil {
+			err = e
+		}
+	}
+	if self.tmpName != "" {
+		os.Remove(self.tmpName)
+	}
+	self.closeF = nil
+	return err
+}
+
+/*
+ *读操作：成功返回true，并把读到的值推入栈顶
+ *与C语言一样，读只写的流会失败（相当于到达了文件末尾，同时记录EBADF错误）
+ */
+
+func (self *luaStream) prepareRead() bool {
+	if !self.readable {
+		self.err = syscall.EBADF
+		return false
+	}
+	if self.writer.Buffered() > 0 {
+		self.setError(self.writer.Flush())
+	}
+	return true
+}
+
+// 测试是否到达文件末尾，不是则推入空字符串
+func (self *luaStream) testEOF(ls LuaState) bool {
+	_, err := self.reader.Peek(1)
+	self.setError(err)
+	ls.PushString("")
+	return err == nil
+}
+
+// 最多读取n个字节，至少读到一个字节才算成功
+func (self *luaStream) readChars(ls LuaState, n int64) bool {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, self.reader, n)
+	self.setError(err)
+	ls.PushString(buf.String())
+	return buf.Len() > 0
+}
+
+// 读取一行，chop为true时去掉行尾的换行符
+func (self *luaStream) readLine(ls LuaState, chop bool) bool {
+	line, err := self.reader.ReadString('\n')
+	self.setError(err)
+	n := len(line)
+	hasNL := n > 0 && line[n-1] == '\n'
+	if chop && hasNL {
+		line = line[:n-1]
+	}
+	ls.PushString(line)
+	return hasNL || n > 0 // 读到了换行符或者其他字符
+}
+
+// 读取文件剩下的全部内容，总是成功（到达文件末尾时推入空字符串）
+func (self *luaStream) readAll(ls LuaState) {
+	var buf bytes.Buffer
+	_, err := buf.ReadFrom(self.reader)
+	self.setError(err)
+	ls.PushString(buf.String())
+}
+
+/*
+ *读取一个数字（相当于官方实现里的read_number）：跳过空白字符之后，最多读取L_MAXLENNUM个“看起来像数字”的字符，
+ *再按照Lua的规则转换成整数或者浮点数，转换失败时推入nil并返回false。与官方实现一样，最后多读的一个字符会被退回
+ */
+func (self *luaStream) readNumber(ls LuaState) bool {
+	rn := &readNum{r: self.reader}
+	rn.c = rn.getc()
+	for rn.c == ' ' || '\t' <= rn.c && rn.c <= '\r' { // 跳过空白字符
+		rn.c = rn.getc()
+	}
+	count, hex := 0, false
+	rn.test2("-+") // 可选的符号
+	if rn.test2("00") {
+		if rn.test2("xX") {
+			hex = true // 十六进制数
+		} else {
+			count = 1 // 开头的0也算一个有效数字
+		}
+	}
+	count += rn.readDigits(hex) // 整数部分
+	if rn.test2("..") {         // 小数点
+		count += rn.readDigits(hex) // 小数部分
+	}
+	if count > 0 {
+		exp := "eE"
+		if hex {
+			exp = "pP"
+		}
+		if rn.test2(exp) { // 指数
+			rn.test2("-+")       // 指数的符号
+			rn.readDigits(false) // 指数部分
+		}
+	}
+	if rn.c >= 0 {
+		self.reader.UnreadByte() // 退回多读的字符
+	}
+	if rn.err != nil {
+		self.setError(rn.err)
+	}
+	if ls.StringToNumber(string(rn.buff)) {
+		return true
+	}
+	ls.PushNil() // 格式不对
+	return false
+}
+
+type readNum struct {
+	r        *bufio.Reader
+	c        int    //当前（预读的）字符，-1表示EOF
+	buff     []byte //已经读取的字符
+	overflow bool   //读取的字符是不是太多了
+	err      error
+}
+
+func (self *readNum) getc() int {
+	c, err := self.r.ReadByte()
+	if err != nil {
+		if err != io.EOF {
+			self.err = err
+		}
+		return -1
+	}
+	return int(c)
+}
+
+// 把当前字符加入缓冲区，然后读取下一个字符，读取的字符太多时清空缓冲区（让转换失败）并返回false
+func (self *readNum) nextc() bool {
+	if self.overflow || len(self.buff) >= L_MAXLENNUM {
+		self.buff, self.overflow = nil, true
+		return false
+	}
+	self.buff = append(self.buff, byte(self.c))
+	self.c = self.getc()
+	return true
+}
+
+// 如果当前字符是set里的两个字符之一，则接受它
+func (self *readNum) test2(set string) bool {
+	if self.c == int(set[0]) || self.c == int(set[1]) {
+		return self.nextc()
+	}
+	return false
+}
+
+// 读取一串（十进制或者十六进制）数字，返回数字的个数
+func (self *readNum) readDigits(hex bool) int {
+	count := 0
+	for self.isDigit(hex) && self.nextc() {
+		count++
+	}
+	return count
+}
+
+func (self *readNum) isDigit(hex bool) bool {
+	c := self.c
+	if c >= 0 && isDigit(byte(c)) {
+		return true
+	}
+	return hex && ('a' <= c && c <= 'f' || 'A' <= c && c <= 'F')
+}
@@ -0,0 +1,146 @@
+/*
+ *os.date使用的日期格式化，实现了C99 strftime()的全部转换说明符（按照"C"区域设置），
+ *以及E和O修饰符（在"C"区域设置下与不带修饰符的说明符含义相同）
+ */
+package stdlib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 合法的转换说明符：不带修饰符的单个字符，以及带E或O修饰符的两个字符（与官方实现的LUA_STRFTIMEOPTIONS一致）
+const (
+	STRFTIME_OPTIONS1 = "aAbBcCdDeFgGhHIjmMnprRStTuUVwWxXyYzZ%"
+	STRFTIME_OPTIONS2 = "EcECExEXEyEYOdOeOHOIOmOMOSOuOUOVOwOWOy"
+)
+
+var shortDayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+var longDayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+var shortMonthNames = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+var longMonthNames = []string{"January", "February", "March", "April", "May", "June", "July",
+	"August", "September", "October", "November", "December"}
+
+/*
+ *检查s开头的转换说明符（'%'之后的部分）是否合法，返回说明符的长度（1或者2），不合法返回0
+ */
+func checkStrftimeOption(s string) int {
+	if len(s) >= 1 && strings.IndexByte(STRFTIME_OPTIONS1, s[0]) >= 0 {
+		return 1
+	}
+	if len(s) >= 2 {
+		for i := 0; i < len(STRFTIME_OPTIONS2); i += 2 {
+			if STRFTIME_OPTIONS2[i:i+2] == s[:2] {
+				return 2
+			}
+		}
+	}
+	return 0
+}
+
+// 按照转换说明符conv（去掉了E和O修饰符）格式化时间t
+func strftime(conv byte, t time.Time) string {
+	switch conv {
+	case 'a': // 星期几的缩写
+		return shortDayNames[t.Weekday()]
+	case 'A': // 星期几的全称
+		return longDayNames[t.Weekday()]
+	case 'b', 'h': // 月份的缩写
+		return shortMonthNames[t.Month()-1]
+	case 'B': // 月份的全称
+		return longMonthNames[t.Month()-1]
+	case 'c': // 日期和时间
+		return strftimeAll("%a %b %e %H:%M:%S %Y", t)
+	case 'C': // 世纪（年份除以100）
+		return fmt.Sprintf("%02d", t.Year()/100)
+	case 'd': // 日（01~31）
+		return fmt.Sprintf("%02d", t.Day())
+	case 'D': // 相当于%m/%d/%y
+		return strftimeAll("%m/%d/%y", t)
+	case 'e': // 日（1~31），前面用空格补齐
+		return fmt.Sprintf("%2d", t.Day())
+	case 'F': // 相当于%Y-%m-%d
+		return strftimeAll("%Y-%m-%d", t)
+	case 'g': // ISO 8601周数所在的年份的后两位
+		year, _ := t.ISOWeek()
+		return fmt.Sprintf("%02d", year%100)
+	case 'G': // ISO 8601周数所在的年份
+		year, _ := t.ISOWeek()
+		return fmt.Sprintf("%d", year)
+	case 'H': // 小时（00~23）
+		return fmt.Sprintf("%02d", t.Hour())
+	case 'I': // 小时（01~12）
+		return fmt.Sprintf("%02d", (t.Hour()+11)%12+1)
+	case 'j': // 一年中的第几天（001~366）
+		return fmt.Sprintf("%03d", t.YearDay())
+	case 'm': // 月（01~12）
+		return fmt.Sprintf("%02d", int(t.Month()))
+	case 'M': // 分（00~59）
+		return fmt.Sprintf("%02d", t.Minute())
+	case 'n': // 换行符
+		return "\n"
+	case 'p': // 上午或下午
+		if t.Hour() < 12 {
+			return "AM"
+		}
+		return "PM"
+	case 'r': // 12小时制的时间
+		return strftimeAll("%I:%M:%S %p", t)
+	case 'R': // 相当于%H:%M
+		return strftimeAll("%H:%M", t)
+	case 'S': // 秒（00~60）
+		return fmt.Sprintf("%02d", t.Second())
+	case 't': // 制表符
+		return "\t"
+	case 'T': // 相当于%H:%M:%S
+		return strftimeAll("%H:%M:%S", t)
+	case 'u': // 星期几（1~7），星期一是1
+		return fmt.Sprintf("%d", (int(t.Weekday())+6)%7+1)
+	case 'U': // 一年中的第几周（00~53），第一个星期日是第1周的第一天
+		return fmt.Sprintf("%02d", (t.YearDay()-1+7-int(t.Weekday()))/7)
+	case 'V': // ISO 8601周数（01~53）
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	case 'w': // 星期几（0~6），星期日是0
+		return fmt.Sprintf("%d", int(t.Weekday()))
+	case 'W': // 一年中的第几周（00~53），第一个星期一是第1周的第一天
+		return fmt.Sprintf("%02d", (t.YearDay()-1+7-(int(t.Weekday())+6)%7)/7)
+	case 'x': // 日期
+		return strftimeAll("%m/%d/%y", t)
+	case 'X': // 时间
+		return strftimeAll("%H:%M:%S", t)
+	case 'y': // 年份的后两位
+		return fmt.Sprintf("%02d", t.Year()%100)
+	case 'Y': // 年份
+		return fmt.Sprintf("%d", t.Year())
+	case 'z': // 与UTC的时差，比如+0800
+		_, offset := t.Zone()
+		sign := '+'
+		if offset < 0 {
+			sign = '-'
+			offset = -offset
+		}
+		return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset/60%60)
+	case 'Z': // 时区名称
+		name, _ := t.Zone()
+		return name
+	case '%':
+		return "%"
+	}
+	return ""
+}
+
+// 格式化不会出错的内部格式（用于组合说明符，比如%c和%D）
+func strftimeAll(format string, t time.Time) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] == '%' && i+1 < len(format) {
+			i++
+			sb.WriteString(strftime(format[i], t))
+		} else {
+			sb.WriteByte(format[i])
+		}
+	}
+	return sb.String()
+}
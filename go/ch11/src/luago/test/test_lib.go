@@ -0,0 +1,646 @@
+// 测试标准库函数：在Go里直接调用库函数，打印参数和返回值（出错时打印错误信息）
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	. "luago/api"
+	"luago/binchunk"
+	"luago/state"
+	"luago/stdlib"
+	"luago/vm"
+	"runtime"
+	"strings"
+	"time"
+)
+
+func TestLib() {
+	ls := state.New()
+	ls.OpenLibs()
+	testPattern(ls)
+	testPack(ls)
+	testSort(ls)
+	testMath(ls)
+	testOS(ls)
+	testExit()
+	testMemoryLimit()
+	testInterrupt()
+	testCoroutine(ls)
+	testCoroutineClose()
+	testSandbox()
+}
+
+// 模式匹配：find、match、gsub，包括位置捕获、后向引用、平衡匹配和边界模式
+func testPattern(ls LuaState) {
+	_callLib(ls, "string", "find", "hello world", "o w")
+	_callLib(ls, "string", "find", "hello world", "l+")
+	_callLib(ls, "string", "find", "a.b", ".", int64(1), true)
+	_callLib(ls, "string", "find", "abc", "()%1")
+	_callLib(ls, "string", "find", "abc", "()b()")
+	_callLib(ls, "string", "match", "key = value", "(%w+)%s*=%s*(%w+)")
+	_callLib(ls, "string", "match", "hello hello", "(h%a+) %1")
+	_callLib(ls, "string", "match", "f(a(b)c)d", "%b()")
+	_callLib(ls, "string", "match", "THE (quick) fox", "%f[%a]%a+")
+	_callLib(ls, "string", "match", "  trim  ", "^%s*(.-)%s*$")
+	_callLib(ls, "string", "match", "2024-01-02", "(%d+)-(%d+)-(%d+)")
+	_callLib(ls, "string", "gsub", "hello world", "o", "0")
+	_callLib(ls, "string", "gsub", "hello world", "(%w+)", "<%1>")
+	_callLib(ls, "string", "gsub", "abc", "", "-")
+	_callLib(ls, "string", "gsub", "abc", "%w", "%2")
+	_callLib(ls, "string", "find", "abc", "[a")
+	_callLib(ls, "string", "find", "abc", "%")
+}
+
+// 二进制打包：pack、unpack、packsize，包括字节序、对齐、定长和带长度前缀的字符串
+func testPack(ls LuaState) {
+	_callLib(ls, "string", "pack", "<i4", int64(1))
+	_callLib(ls, "string", "pack", ">i4", int64(-2))
+	_callLib(ls, "string", "pack", "<i2 B", int64(0x1234), int64(255))
+	_callLib(ls, "string", "pack", "z s1", "ab", "cde")
+	_callLib(ls, "string", "pack", "!4 b i4", int64(1), int64(2))
+	_callLib(ls, "string", "packsize", "!8 b d")
+	_callLib(ls, "string", "packsize", "i3 c5")
+	_callLib(ls, "string", "unpack", "<i4", "\x01\x00\x00\x00")
+	_callLib(ls, "string", "unpack", ">I2 c3", "\x12\x34xyz")
+	_callLib(ls, "string", "unpack", "<d", "\x00\x00\x00\x00\x00\x00\xf8\x3f")
+	_callLib(ls, "string", "unpack", "z B", "hi\x00\x07")
+	_callLib(ls, "string", "unpack", "s1", "\x05abc")
+	_callLib(ls, "string", "pack", "i1", int64(200))
+	_callLib(ls, "string", "packsize", "s")
+}
+
+// 排序：默认比较、自定义比较函数、__lt元方法以及非法的比较函数
+func testSort(ls LuaState) {
+	_sortList(ls, "numbers", []interface{}{int64(5), 2.5, int64(-1), int64(9), int64(0), int64(3)}, nil)
+	_sortList(ls, "strings", []interface{}{"pear", "apple", "fig", "banana"}, nil)
+	_sortList(ls, "descending", []interface{}{int64(1), int64(4), int64(2), int64(3)}, func(ls LuaState) int {
+		ls.PushBoolean(ls.Compare(2, 1, LUA_OPLT))
+		return 1
+	})
+	_sortList(ls, "invalid order", []interface{}{int64(3), int64(1), int64(2), int64(5), int64(4)}, func(ls LuaState) int {
+		ls.PushBoolean(true)
+		return 1
+	})
+
+	//元素是带__lt元方法的表，按照字段v排序
+	ls.CreateTable(0, 1)
+	ls.PushGoFunction(func(ls LuaState) int {
+		ls.GetField(1, "v")
+		ls.GetField(2, "v")
+		ls.PushBoolean(ls.Compare(-2, -1, LUA_OPLT))
+		return 1
+	})
+	ls.SetField(-2, "__lt")
+	mt := ls.GetTop()
+	ls.GetGlobal("table")
+	ls.GetField(-1, "sort")
+	ls.CreateTable(4, 0)
+	for i, v := range []int64{30, 10, 40, 20} {
+		ls.CreateTable(0, 1)
+		ls.PushInteger(v)
+		ls.SetField(-2, "v")
+		ls.PushValue(mt)
+		ls.SetMetatable(-2)
+		ls.SetI(-2, int64(i+1))
+	}
+	ls.PushValue(-1)
+	ls.Insert(-3) // 排序之后还要用到这个表
+	ls.Call(1, 0)
+	values := make([]string, 0, 4)
+	for i := int64(1); i <= 4; i++ {
+		ls.GetI(-1, i)
+		ls.GetField(-1, "v")
+		values = append(values, _valueString(ls, -1))
+		ls.Pop(2)
+	}
+	fmt.Printf("table.sort(__lt) => %s\n", strings.Join(values, ", "))
+	ls.SetTop(mt - 1)
+}
+
+// 数学库：max、min的参数检查，以及设置种子之后可重现的随机数序列
+func testMath(ls LuaState) {
+	_callLib(ls, "math", "max", int64(1), 2.5, int64(-3))
+	_callLib(ls, "math", "min", int64(1), 2.5, int64(-3))
+	_callLib(ls, "math", "max", "a", "b")
+	_callLib(ls, "math", "min", int64(1), "x")
+	_callLib(ls, "math", "max")
+	_callLib(ls, "math", "randomseed", int64(42))
+	for i := 0; i < 3; i++ {
+		_callLib(ls, "math", "random", int64(1), int64(100))
+	}
+	_callLib(ls, "math", "random", int64(0))
+	_callLib(ls, "math", "random")
+	_callLib(ls, "math", "randomseed", int64(42))
+	_callLib(ls, "math", "random", int64(1), int64(100)) // 同样的种子，同样的序列
+	_callLib(ls, "math", "random", int64(3), int64(1))
+}
+
+// 操作系统库：os.time规范化超出范围的字段（并更新表里的字段），os.date的格式化以及"*t"
+func testOS(ls LuaState) {
+	_printGoCall(ls, "os.time{year=2023, month=14, day=0, hour=25, min=-10, sec=70}", func(ls LuaState) int {
+		ls.CreateTable(0, 6)
+		for _, f := range []struct {
+			key   string
+			value int64
+		}{{"year", 2023}, {"month", 14}, {"day", 0}, {"hour", 25}, {"min", -10}, {"sec", 70}} {
+			ls.PushInteger(f.value)
+			ls.SetField(-2, f.key)
+		}
+		ls.GetGlobal("os")
+		ls.GetField(-1, "time")
+		ls.PushValue(-3)
+		ls.Call(1, 1) // t = os.time(表)
+		ls.GetField(-2, "date")
+		ls.PushString("%Y-%m-%d %H:%M:%S")
+		ls.PushValue(-3)
+		ls.Call(2, 1) // os.date(格式, t)
+		for _, key := range []string{"year", "month", "day", "hour", "min", "sec", "yday", "wday"} {
+			ls.GetField(1, key) // 规范化之后的字段
+		}
+		return 9
+	})
+	_printGoCall(ls, "os.time{year=2024}", func(ls LuaState) int {
+		ls.GetGlobal("os")
+		ls.GetField(-1, "time")
+		ls.CreateTable(0, 1)
+		ls.PushInteger(2024)
+		ls.SetField(-2, "year")
+		ls.Call(1, 1)
+		return 1
+	})
+	_callLib(ls, "os", "date", "!%Y-%m-%d %H:%M:%S", int64(0))
+	_callLib(ls, "os", "date", "!%c|%x|%X|%p|%j|%a %b|%%", int64(86400*45+3600*15))
+	_printGoCall(ls, "os.date(\"!*t\", 86400*59)", func(ls LuaState) int {
+		ls.GetGlobal("os")
+		ls.GetField(-1, "date")
+		ls.PushString("!*t")
+		ls.PushInteger(86400 * 59)
+		ls.Call(2, 1)
+		for _, key := range []string{"year", "month", "day", "hour", "min", "sec", "yday", "wday", "isdst"} {
+			ls.GetField(2, key)
+		}
+		return 9
+	})
+	_callLib(ls, "os", "date", "%Ez", int64(0))
+}
+
+// 退出：设置了宿主钩子时，os.exit()调用钩子之后以LUA_ERREXIT错误结束脚本，pcall()和coroutine.resume()都捕获不了它
+func testExit() {
+	ls := state.New()
+	ls.OpenLibs()
+	ls.SetExitHook(func(code int) {
+		fmt.Printf("(exit hook: %d) ", code)
+	})
+	_callLib(ls, "os", "exit", int64(3))
+	_callLib(ls, "os", "exit", false)
+	_callLib(ls, "os", "exit")
+	ls.GetGlobal("pcall")
+	_pushLibFunc(ls, "os", "exit")
+	ls.PushInteger(5)
+	_printCall(ls, "pcall(os.exit, 5)", 2)
+	_pushCoFunc(ls, "resume")
+	_pushCoFunc(ls, "create")
+	_pushLibFunc(ls, "os", "exit")
+	ls.Call(1, 1)
+	ls.PushInteger(7)
+	_printCall(ls, "coroutine.resume(coroutine.create(os.exit), 7)", 2)
+}
+
+// 内存上限：超过上限的字符串、表的增长以及加载chunk都会得到LUA_ERRMEM错误，被拒绝的写入不会留在表里
+func testMemoryLimit() {
+	ls := state.New()
+	ls.OpenLibs()
+	ls.NewTable()
+	t := ls.GetTop()
+	used := ls.GC(LUA_GCCOUNT, 0)*1024 + ls.GC(LUA_GCCOUNTB, 0)
+	ls.SetMemoryLimit(used + 16*1024)
+	fmt.Printf("memory limit => %t\n", ls.MemoryLimit() == used+16*1024)
+
+	_callLib(ls, "string", "rep", "x", int64(3))
+	_callLib(ls, "string", "rep", "x", int64(1<<20))
+	var last int64 // 最后一次（被拒绝的）写入的索引
+	ls.PushGoFunction(func(ls LuaState) int {
+		for last = 1; ; last++ {
+			ls.PushInteger(last)
+			ls.SetI(1, last)
+		}
+	})
+	ls.PushValue(t)
+	_printCall(ls, "grow table", 1)
+	ls.RawGetI(t, last-1)
+	ls.RawGetI(t, last)
+	fmt.Printf("rejected write not stored => %t, %t\n", ls.ToInteger(-2) == last-1, ls.IsNil(-1))
+	ls.Pop(2)
+	_printGoCall(ls, "load", func(ls LuaState) int {
+		top := ls.GetTop()
+		ls.SetMemoryLimit(ls.GC(LUA_GCCOUNT, 0)*1024 + ls.GC(LUA_GCCOUNTB, 0) + 1)
+		defer func() {
+			fmt.Printf("(stack unchanged: %t) ", ls.GetTop() == top)
+		}()
+		ls.Load(_loopChunk(), "loop", "b")
+		return 1
+	})
+
+	ls.SetMemoryLimit(0)
+	_printGoCall(ls, "#string.rep(\"x\", 1048576) without limit", func(ls LuaState) int {
+		ls.GetGlobal("string")
+		ls.GetField(-1, "rep")
+		ls.PushString("x")
+		ls.PushInteger(1 << 20)
+		ls.Call(2, 1)
+		ls.Len(-1)
+		return 1
+	})
+}
+
+// 中断：指令预算用完或者Context被取消（超时）时，死循环会被LUA_ERRINTERRUPT错误中断；
+// 中断不可捕获时，它会穿过Lua代码里的pcall()和coroutine.resume()，一直传播到宿主的PCall()
+func testInterrupt() {
+	ls := state.New()
+	ls.OpenLibs()
+	loop := _loopChunk()
+
+	ls.SetInstructionLimit(1000)
+	ls.Load(loop, "loop", "b")
+	_printCall(ls, "loop with instruction limit", 0)
+	fmt.Printf("instruction count => %d\n", ls.InstructionCount())
+	ls.SetInstructionLimit(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ls.SetContext(ctx)
+	ls.Load(loop, "loop", "b")
+	_printCall(ls, "loop with cancelled context", 0)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ls.SetContext(ctx)
+	ls.Load(loop, "loop", "b")
+	_printCall(ls, "loop with timeout", 0)
+	ls.SetContext(nil)
+
+	for _, catchable := range []bool{true, false} {
+		ls.SetInterruptCatchable(catchable)
+		ls.SetInstructionLimit(1000)
+		ls.GetGlobal("pcall")
+		ls.Load(loop, "loop", "b")
+		_printCall(ls, fmt.Sprintf("pcall(loop), catchable=%t", catchable), 1)
+
+		ls.SetInstructionLimit(1000)
+		ls.GetGlobal("coroutine")
+		ls.GetField(-1, "resume")
+		ls.GetField(-2, "create")
+		ls.Load(loop, "loop", "b")
+		ls.Call(1, 1)
+		ls.Remove(-3) // 栈里只剩下resume和协程
+		_printCall(ls, fmt.Sprintf("coroutine.resume(loop), catchable=%t", catchable), 1)
+	}
+	ls.SetInstructionLimit(0)
+}
+
+// 协程：resume、yield、status、wrap以及各种出错的情况，wrap传播的错误带上调用者的位置
+func testCoroutine(ls LuaState) {
+	//第一次恢复时挂起并返回参数+1，第二次恢复时结束并返回"done"加上恢复的参数
+	_pushCoFunc(ls, "create")
+	ls.PushGoFunction(func(ls LuaState) int {
+		ls.PushInteger(ls.ToInteger(1) + 1)
+		ls.Yield(1)
+		ls.PushString("done ")
+		ls.Insert(-2)
+		ls.Concat(2)
+		return 1
+	})
+	ls.Call(1, 1)
+	co := ls.GetTop()
+	_coCall(ls, "status", co)
+	_coCall(ls, "resume", co, int64(1))
+	_coCall(ls, "status", co)
+	_coCall(ls, "resume", co, "x")
+	_coCall(ls, "status", co)
+	_coCall(ls, "resume", co)
+	_coCall(ls, "resume", int64(42))
+	_coCall(ls, "status", nil)
+	_callLib(ls, "coroutine", "yield", int64(1))
+	_callLib(ls, "coroutine", "isyieldable")
+
+	//在协程里查看自己的状态（running）、恢复者的状态（normal），以及恢复自己
+	_pushCoFunc(ls, "wrap")
+	ls.PushGoFunction(func(ls LuaState) int {
+		ls.PushThread()
+		outer := ls.GetTop()
+		_pushCoFunc(ls, "status")
+		ls.PushValue(outer)
+		ls.Call(1, 1)
+		_pushCoFunc(ls, "wrap")
+		ls.PushGoFunction(func(ls LuaState) int {
+			_pushCoFunc(ls, "status")
+			ls.PushValue(1)
+			ls.Call(1, 1)
+			return 1
+		})
+		ls.Call(1, 1)
+		ls.PushValue(outer)
+		ls.Call(1, 1)
+		_pushCoFunc(ls, "resume")
+		ls.PushValue(outer)
+		ls.Call(1, 2)
+		return 4
+	})
+	ls.Call(1, 1)
+	_printCall(ls, "status inside a coroutine", 0)
+
+	//wrap：错误传播给调用者，字符串错误带上调用wrap函数的位置（call:2:）
+	for _, body := range []GoFunction{
+		func(ls LuaState) int { return ls.Error2("boom") },
+		func(ls LuaState) int { ls.PushInteger(1); return 1 },
+	} {
+		_pushCoFunc(ls, "wrap")
+		ls.PushGoFunction(body)
+		ls.Call(1, 1)
+		f := ls.GetTop()
+		for i := 0; i < 2; i++ {
+			ls.Load(_callChunk(), "call", "b")
+			ls.PushValue(f)
+			_printCall(ls, "call(wrap(f))", 1)
+		}
+		ls.SetTop(f - 1)
+	}
+	ls.SetTop(co - 1)
+}
+
+// Close()：杀死挂起的协程，释放它们的goroutine，之后它们就是死协程了
+func testCoroutineClose() {
+	ls := state.New()
+	ls.OpenLibs()
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 3; i++ {
+		_pushCoFunc(ls, "create")
+		ls.PushGoFunction(func(ls LuaState) int {
+			ls.Yield(0)
+			return 0
+		})
+		ls.Call(1, 1)
+		_pushCoFunc(ls, "resume")
+		ls.PushValue(-2)
+		ls.Call(1, 0)
+	}
+	fmt.Printf("suspended goroutines => %d\n", runtime.NumGoroutine()-goroutines)
+	ls.Close()
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(time.Millisecond) // goroutine通知了Close()之后才真正退出，稍等一下
+	}
+	fmt.Printf("goroutines after Close => %d\n", runtime.NumGoroutine()-goroutines)
+	_coCall(ls, "status", 1)
+	_coCall(ls, "resume", 1)
+}
+
+// 沙箱：危险的库和函数不可见，不同的沙箱环境之间看不到彼此的全局变量，也不会受到对方修改库的影响
+func testSandbox() {
+	ls := state.New()
+	ls.OpenLibs()
+	ls.NewSandboxEnv(stdlib.SandboxSafe)
+	env1 := ls.GetTop()
+	ls.NewSandboxEnv(stdlib.SandboxSafe)
+	env2 := ls.GetTop()
+	for _, name := range []string{"io", "debug", "require", "dofile", "loadfile", "load", "coroutine", "package", "print", "string"} {
+		fmt.Printf("env1.%s => %s\n", name, ls.TypeName(ls.GetField(env1, name)))
+		ls.Pop(1)
+	}
+	_printSandboxField(ls, "env1", env1, "os", "exit")
+	_printSandboxField(ls, "env1", env1, "os", "time")
+
+	//在env1里定义全局变量、修改string库
+	ls.PushInteger(1)
+	ls.SetField(env1, "x")
+	ls.GetField(env1, "string")
+	ls.PushNil()
+	ls.SetField(-2, "upper")
+	ls.Pop(1)
+	fmt.Printf("env2.x => %s\n", ls.TypeName(ls.GetField(env2, "x")))
+	ls.Pop(1)
+	_printSandboxField(ls, "env1", env1, "string", "upper")
+	_printSandboxField(ls, "env2", env2, "string", "upper")
+	ls.PushGlobalTable()
+	_printSandboxField(ls, "_G", ls.GetTop(), "string", "upper")
+	ls.Pop(1)
+
+	//沙箱版本的collectgarbage只能查询内存占用
+	ls.GetField(env1, "collectgarbage")
+	ls.PushString("collect")
+	_printCall(ls, "env1.collectgarbage(\"collect\")", 1)
+
+	//基础库的名字列表里列出的库表不会被复制
+	ls.NewSandboxEnv(SandboxProfile{"_G": {"print", "string", "package"}})
+	for _, name := range []string{"print", "string", "package"} {
+		fmt.Printf("{_G: {print, string, package}}.%s => %s\n", name, ls.TypeName(ls.GetField(-1, name)))
+		ls.Pop(1)
+	}
+	ls.SetTop(0)
+
+	//NewSandboxEnv()不会动字符串共享的元表，NewSandbox()则会把它保护起来
+	_callLib(ls, "_G", "getmetatable", "")
+	sb := state.NewSandbox(stdlib.SandboxSafe)
+	fmt.Printf("NewSandbox: io => %s\n", sb.TypeName(sb.GetGlobal("io")))
+	sb.Pop(1)
+	_callLib(sb, "_G", "getmetatable", "")
+}
+
+// 打印沙箱环境（或者全局环境）env里lib.name的类型，envName是打印时用的环境名
+func _printSandboxField(ls LuaState, envName string, env int, lib, name string) {
+	ls.GetField(env, lib)
+	fmt.Printf("%s.%s.%s => %s\n", envName, lib, name, ls.TypeName(ls.GetField(-1, name)))
+	ls.Pop(2)
+}
+
+// 把coroutine.fn推入栈顶
+func _pushCoFunc(ls LuaState, fn string) {
+	_pushLibFunc(ls, "coroutine", fn)
+}
+
+// 把lib.fn推入栈顶
+func _pushLibFunc(ls LuaState, lib, fn string) {
+	ls.GetGlobal(lib)
+	ls.GetField(-1, fn)
+	ls.Remove(-2)
+}
+
+// 调用coroutine.fn(arg...)并打印结果，int类型的参数表示栈索引（比如协程所在的位置），其他参数同_callLib()
+func _coCall(ls LuaState, fn string, args ...interface{}) {
+	_pushCoFunc(ls, fn)
+	strArgs := make([]string, len(args))
+	for i, arg := range args {
+		switch x := arg.(type) {
+		case int:
+			ls.PushValue(x)
+			strArgs[i] = "co"
+		case int64:
+			ls.PushInteger(x)
+			strArgs[i] = fmt.Sprint(x)
+		case string:
+			ls.PushString(x)
+			strArgs[i] = fmt.Sprintf("%q", x)
+		default:
+			ls.PushNil()
+			strArgs[i] = "nil"
+		}
+	}
+	_printCall(ls, fmt.Sprintf("coroutine.%s(%s)", fn, strings.Join(strArgs, ", ")), len(args))
+}
+
+// 把list放进一个新表里，调用table.sort(t, comp)，然后打印排好序的表（出错时打印错误信息）
+func _sortList(ls LuaState, name string, list []interface{}, comp GoFunction) {
+	top := ls.GetTop()
+	ls.CreateTable(len(list), 0)
+	for i, v := range list {
+		switch x := v.(type) {
+		case int64:
+			ls.PushInteger(x)
+		case float64:
+			ls.PushNumber(x)
+		case string:
+			ls.PushString(x)
+		}
+		ls.SetI(-2, int64(i+1))
+	}
+	ls.GetGlobal("table")
+	ls.GetField(-1, "sort")
+	ls.PushValue(top + 1)
+	nArgs := 1
+	if comp != nil {
+		ls.PushGoFunction(comp)
+		nArgs++
+	}
+	fmt.Printf("table.sort(%s) => ", name)
+	if ls.PCall(nArgs, 0, 0) != LUA_OK {
+		fmt.Printf("error: %s\n", ls.ToString(-1))
+	} else {
+		values := make([]string, 0, len(list))
+		for i := range list {
+			ls.GetI(top+1, int64(i+1))
+			values = append(values, _valueString(ls, -1))
+			ls.Pop(1)
+		}
+		fmt.Println(strings.Join(values, ", "))
+	}
+	ls.SetTop(top)
+}
+
+// 调用lib.fn(args...)并打印结果，args里的nil、bool、int64、float64、string会转换成对应的Lua值
+func _callLib(ls LuaState, lib, fn string, args ...interface{}) {
+	_pushLibFunc(ls, lib, fn)
+	for _, arg := range args {
+		switch x := arg.(type) {
+		case nil:
+			ls.PushNil()
+		case bool:
+			ls.PushBoolean(x)
+		case int64:
+			ls.PushInteger(x)
+		case float64:
+			ls.PushNumber(x)
+		case string:
+			ls.PushString(x)
+		}
+	}
+
+	strArgs := make([]string, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			strArgs[i] = fmt.Sprintf("%q", s)
+		} else {
+			strArgs[i] = fmt.Sprint(arg)
+		}
+	}
+	_printCall(ls, fmt.Sprintf("%s.%s(%s)", lib, fn, strings.Join(strArgs, ", ")), len(args))
+}
+
+// 调用栈里的函数（其上是nArgs个参数），打印desc和全部结果，出错时打印错误信息（不是LUA_ERRRUN的话还打印错误码）
+func _printCall(ls LuaState, desc string, nArgs int) {
+	fmt.Printf("%s => ", desc)
+	top := ls.GetTop() - nArgs - 1
+	if status := ls.PCall(nArgs, LUA_MULTRET, 0); status == LUA_ERRRUN {
+		fmt.Printf("error: %s\n", ls.ToString(-1))
+	} else if status != LUA_OK {
+		fmt.Printf("error %d: %s\n", status, ls.ToString(-1))
+	} else {
+		results := make([]string, 0, ls.GetTop()-top)
+		for i := top + 1; i <= ls.GetTop(); i++ {
+			results = append(results, _valueString(ls, i))
+		}
+		fmt.Println(strings.Join(results, ", "))
+	}
+	ls.SetTop(top)
+}
+
+// 以Go函数f为主函数调用_printCall()，用来在保护模式下测试API
+func _printGoCall(ls LuaState, desc string, f GoFunction) {
+	ls.PushGoFunction(f)
+	_printCall(ls, desc, 0)
+}
+
+// 主函数只有一条跳回自己的JMP指令的chunk，相当于"while true do end"
+func _loopChunk() []byte {
+	return _chunk("=loop", uint32(vm.OP_JMP|(vm.MAXARG_sBx-1)<<14)) // JMP 0 -1
+}
+
+// 以第一个参数为函数、不带参数调用它的chunk，相当于"local f = ...; f()"，调用发生在第2行
+func _callChunk() []byte {
+	return _chunk("=call",
+		uint32(vm.OP_VARARG|0<<6|2<<23),     // VARARG 0 2
+		uint32(vm.OP_CALL|0<<6|1<<23|1<<14), // CALL 0 1 1
+		uint32(vm.OP_RETURN|0<<6|1<<23))     // RETURN 0 1
+}
+
+/*
+ *手工拼出一个二进制chunk（我们没有编译器，没法加载文本chunk），主函数是有两个寄存器的Vararg函数，
+ *指令表由code给出，第i条指令在第i行
+ */
+func _chunk(source string, code ...uint32) []byte {
+	buf := &bytes.Buffer{}
+	write := func(data ...interface{}) {
+		for _, x := range data {
+			binary.Write(buf, binary.LittleEndian, x)
+		}
+	}
+	//头部
+	buf.WriteString(binchunk.LUA_SIGNATURE)
+	write(byte(binchunk.LUAC_VERSION), byte(binchunk.LUAC_FORMAT))
+	buf.WriteString(binchunk.LUAC_DATA)
+	write(byte(binchunk.CINT_SIZE), byte(binchunk.CSIZET_SIZE), byte(binchunk.INSTRUCTION_SIZE),
+		byte(binchunk.LUA_INTEGER_SIZE), byte(binchunk.LUA_NUMBER_SIZE))
+	write(int64(binchunk.LUAC_INT), float64(binchunk.LUAC_NUM))
+	write(byte(1)) // 主函数的Upvalue数量
+	//主函数原型
+	write(byte(len(source) + 1))
+	buf.WriteString(source)
+	write(uint32(0), uint32(0))        // 起止行号
+	write(byte(0), byte(1), byte(2))   // 固定参数个数、是否Vararg、寄存器数量
+	write(uint32(len(code)), code)     // 指令表
+	write(uint32(0))                   // 常量表
+	write(uint32(1), byte(1), byte(0)) // Upvalue表：_ENV
+	write(uint32(0))                   // 子函数原型表
+	write(uint32(len(code)))           // 行号表
+	for i := range code {
+		write(uint32(i + 1))
+	}
+	write(uint32(0), uint32(0)) // 局部变量表、Upvalue名列表
+	return buf.Bytes()
+}
+
+// 把指定索引处的值转换成便于阅读的字符串，字符串加上引号，浮点数总是带小数点
+func _valueString(ls LuaState, idx int) string {
+	switch ls.Type(idx) {
+	case LUA_TSTRING:
+		return fmt.Sprintf("%q", ls.ToString(idx))
+	case LUA_TNUMBER:
+		ls.PushValue(idx) // ToString()会把数字转换成字符串，所以转换副本
+		s := ls.ToString(-1)
+		ls.Pop(1)
+		return s
+	case LUA_TBOOLEAN:
+		return fmt.Sprint(ls.ToBoolean(idx))
+	default:
+		return ls.TypeName(ls.Type(idx))
+	}
+}
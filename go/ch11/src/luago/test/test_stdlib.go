@@ -0,0 +1,14 @@
+package test
+
+import (
+	"luago/state"
+)
+
+func TestStdlib(data []byte, chunkName string) {
+	ls := state.New()
+	//打开标准库，脚本里就可以直接使用print、pairs、pcall等函数了
+	ls.OpenLibs()
+	ls.Load(data, chunkName, "b")
+	//执行主函数
+	ls.Call(0, 0)
+}
@@ -3,10 +3,14 @@ package test
 
 import (
 	"luago/state"
+	"luago/utils"
+	"os"
 )
 
 func TestVM(data []byte, chunkName string) {
 	ls := state.New()
+	//把执行过的每条指令以及执行后的栈打印出来
+	ls.SetTracer(utils.NewTextTracer(os.Stdout))
 	ls.Load(data, chunkName, "b")
 	//执行主函数
 	ls.Call(0, 0)
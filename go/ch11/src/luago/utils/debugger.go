@@ -2,14 +2,17 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	. "luago/api"
 	"luago/binchunk"
 	. "luago/vm"
+	"os"
 	"reflect"
 	"runtime"
 	"strings"
 )
 
+// 是否输出PrintHeader()、PrintStack()等函数的调试信息；虚拟机执行过程的追踪是每个Lua解释器自己的，见tracer.go
 var OpenDebug = true
 
 func PrintHeader(f *binchunk.Prototype) {
@@ -49,7 +52,7 @@ func PrintCode(f *binchunk.Prototype) {
 		}
 		i := Instruction(c)
 		fmt.Printf("\t%d\t[%s]\t%s \t", pc+1, line, i.OpName())
-		printOperands(i)
+		printOperands(os.Stdout, i)
 		fmt.Printf("\t\tCODE:%d", i.Opcode())
 		fmt.Printf("\n")
 	}
@@ -110,50 +113,50 @@ func upvalName(f *binchunk.Prototype, idx int) string {
 	return "-"
 }
 
-func printOperands(i Instruction) {
+func printOperands(w io.Writer, i Instruction) {
 	switch i.OpMode() {
 	case IABC:
 		//IABC允许的操作数类型有：OpArgU、OpArgR、OpArgK
 		a, b, c := i.ABC()
 
-		fmt.Printf("%d", a)
+		fmt.Fprintf(w, "%d", a)
 		if i.BMode() != OpArgN {
 			//如果操作数B或C的最高位是1就认为它表示常量表索引，按负数输出，否则表示寄存器索引
 			if b > 0xFF {
 				//OpArgK的常量索引模式
-				fmt.Printf(" %d", -1-b&0xFF)
+				fmt.Fprintf(w, " %d", -1-b&0xFF)
 			} else {
 				//OpArgU或者OpArgR或者OpArgK的寄存器索引模式
-				fmt.Printf(" %d", b)
+				fmt.Fprintf(w, " %d", b)
 			}
 		}
 		if i.CMode() != OpArgN {
 			if c > 0xFF {
-				fmt.Printf(" %d", -1-c&0xFF)
+				fmt.Fprintf(w, " %d", -1-c&0xFF)
 			} else {
-				fmt.Printf(" %d", c)
+				fmt.Fprintf(w, " %d", c)
 			}
 		}
 	case IABx:
 		//IABx允许的操作数类型有：OpArgU、OpArgK
 		a, bx := i.ABx()
 
-		fmt.Printf("%d", a)
+		fmt.Fprintf(w, "%d", a)
 		if i.BMode() == OpArgK {
 			//OpArgK的常量索引模式
-			fmt.Printf(" %d", -1-bx)
+			fmt.Fprintf(w, " %d", -1-bx)
 		} else if i.BMode() == OpArgU {
 			//OpArgU
-			fmt.Printf(" %d", bx)
+			fmt.Fprintf(w, " %d", bx)
 		}
 	case IAsBx:
 		//IAsBx允许的操作数类型有：OpArgR
 		a, sbx := i.AsBx()
 		//OpArgR的跳转偏移模式
-		fmt.Printf("%d %d", a, sbx)
+		fmt.Fprintf(w, "%d %d", a, sbx)
 	case IAx:
 		ax := i.Ax()
-		fmt.Printf("%d", -1-ax)
+		fmt.Fprintf(w, "%d", -1-ax)
 	}
 }
 
@@ -162,22 +165,27 @@ func PrintStack(ls LuaState) {
 		return
 	}
 
+	printStack(os.Stdout, ls)
+	fmt.Println()
+}
+
+// 把栈里的值依次输出到w（不换行）
+func printStack(w io.Writer, ls LuaState) {
 	top := ls.GetTop()
 
 	for i := 1; i <= top; i++ {
 		t := ls.Type(i)
 		switch t {
 		case LUA_TBOOLEAN:
-			fmt.Printf("[%t]", ls.ToBoolean(i))
+			fmt.Fprintf(w, "[%t]", ls.ToBoolean(i))
 		case LUA_TNUMBER:
-			fmt.Printf("[%g]", ls.ToNumber(i))
+			fmt.Fprintf(w, "[%g]", ls.ToNumber(i))
 		case LUA_TSTRING:
-			fmt.Printf("[%q]", ls.ToString(i))
+			fmt.Fprintf(w, "[%q]", ls.ToString(i))
 		default:
-			fmt.Printf("[%s]", ls.TypeName(t))
+			fmt.Fprintf(w, "[%s]", ls.TypeName(t))
 		}
 	}
-	fmt.Println()
 }
 
 func GetFunctionName(i interface{}, seps ...rune) string {
@@ -0,0 +1,134 @@
+/*
+ *内置的追踪器（见api.Tracer和SetTracer()）：
+ *	NopTracer：什么都不做，可以嵌入到自己的追踪器里，只实现关心的方法
+ *	TextTracer：把事件以可读的文本输出到io.Writer，每条指令后面跟着执行后的栈
+ *	JSONTracer：把每个事件输出成一行JSON（JSON Lines），方便用程序分析
+ *关闭追踪只要SetTracer(nil)就行了
+ */
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	. "luago/api"
+	. "luago/vm"
+)
+
+// 什么都不做的追踪器
+type NopTracer struct{}
+
+func (NopTracer) Instruction(ls LuaState, ar *ActivationRecord, pc int, inst uint32) {}
+func (NopTracer) PushFrame(ls LuaState, ar *ActivationRecord)                        {}
+func (NopTracer) PopFrame(ls LuaState, ar *ActivationRecord)                         {}
+func (NopTracer) GoCall(ls LuaState, f GoFunction)                                   {}
+func (NopTracer) Metamethod(ls LuaState, event string)                               {}
+
+// 输出可读文本的追踪器
+type TextTracer struct {
+	w io.Writer
+}
+
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w}
+}
+
+// 输出形如"[03] GETTABUP 0 0 -1	[1][2]"的一行：指令序号、操作码、操作数以及指令执行后的栈
+func (self *TextTracer) Instruction(ls LuaState, ar *ActivationRecord, pc int, inst uint32) {
+	i := Instruction(inst)
+	fmt.Fprintf(self.w, "[%02d] %s ", pc+1, i.OpName())
+	printOperands(self.w, i)
+	fmt.Fprint(self.w, "\t")
+	printStack(self.w, ls)
+	fmt.Fprintln(self.w)
+}
+
+func (self *TextTracer) PushFrame(ls LuaState, ar *ActivationRecord) {
+	fmt.Fprintf(self.w, "call %s\n", funcDesc(ls, ar))
+}
+
+func (self *TextTracer) PopFrame(ls LuaState, ar *ActivationRecord) {
+	fmt.Fprintf(self.w, "return %s\n", funcDesc(ls, ar))
+}
+
+func (self *TextTracer) GoCall(ls LuaState, f GoFunction) {
+	fmt.Fprintf(self.w, "go call %s\n", GetFunctionName(f))
+}
+
+func (self *TextTracer) Metamethod(ls LuaState, event string) {
+	fmt.Fprintf(self.w, "metamethod %s\n", event)
+}
+
+// 描述活动记录对应的函数，比如"function 'f' <test.lua:3>"、"function 'print' [C]"、"main chunk <test.lua>"
+func funcDesc(ls LuaState, ar *ActivationRecord) string {
+	ls.GetInfo("nS", ar)
+	switch {
+	case ar.What == "main":
+		return fmt.Sprintf("main chunk <%s>", ar.ShortSrc)
+	case ar.Name == "":
+		return fmt.Sprintf("function <%s:%d>", ar.ShortSrc, ar.LineDefined)
+	case ar.What == "C":
+		return fmt.Sprintf("function '%s' [C]", ar.Name)
+	default:
+		return fmt.Sprintf("function '%s' <%s:%d>", ar.Name, ar.ShortSrc, ar.LineDefined)
+	}
+}
+
+// 输出JSON Lines的追踪器
+type JSONTracer struct {
+	enc *json.Encoder
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{json.NewEncoder(w)}
+}
+
+// 指令事件：{"event":"instruction","pc":2,"op":"GETTABUP","source":"test.lua","line":1}
+func (self *JSONTracer) Instruction(ls LuaState, ar *ActivationRecord, pc int, inst uint32) {
+	ls.GetInfo("Sl", ar)
+	self.enc.Encode(struct {
+		Event  string `json:"event"`
+		PC     int    `json:"pc"`
+		Op     string `json:"op"`
+		Source string `json:"source"`
+		Line   int    `json:"line"`
+	}{"instruction", pc, Instruction(inst).OpName(), ar.ShortSrc, ar.CurrentLine})
+}
+
+func (self *JSONTracer) PushFrame(ls LuaState, ar *ActivationRecord) {
+	self.frame("push", ls, ar)
+}
+
+func (self *JSONTracer) PopFrame(ls LuaState, ar *ActivationRecord) {
+	self.frame("pop", ls, ar)
+}
+
+// 调用帧事件：{"event":"push","name":"f","namewhat":"global","what":"Lua","source":"test.lua","linedefined":3}
+func (self *JSONTracer) frame(event string, ls LuaState, ar *ActivationRecord) {
+	ls.GetInfo("nS", ar)
+	self.enc.Encode(struct {
+		Event       string `json:"event"`
+		Name        string `json:"name,omitempty"`
+		NameWhat    string `json:"namewhat,omitempty"`
+		What        string `json:"what"`
+		Source      string `json:"source"`
+		LineDefined int    `json:"linedefined"`
+	}{event, ar.Name, ar.NameWhat, ar.What, ar.ShortSrc, ar.LineDefined})
+}
+
+// Go函数调用事件：{"event":"gocall","name":"luago/stdlib.basePrint"}
+func (self *JSONTracer) GoCall(ls LuaState, f GoFunction) {
+	self.named("gocall", GetFunctionName(f))
+}
+
+// 元方法事件：{"event":"metamethod","name":"__index"}
+func (self *JSONTracer) Metamethod(ls LuaState, event string) {
+	self.named("metamethod", event)
+}
+
+func (self *JSONTracer) named(event, name string) {
+	self.enc.Encode(struct {
+		Event string `json:"event"`
+		Name  string `json:"name"`
+	}{event, name})
+}
@@ -66,3 +66,41 @@ func forLoop(i Instruction, vm LuaVM) {
 		//否则直接结束指令，执行下一条指令，即结束循环
 	}
 }
+
+/*
+ *通用for循环需要借助TFORCALL和TFORLOOP两条指令来实现：
+ *for k, v in pairs(t) do f() end
+ *编译器会把pairs(t)的三个返回值（迭代器函数、不变状态、控制变量）放在三个连续的寄存器里：
+ * a     = 迭代器函数 f
+ * a + 1 = 不变状态 s
+ * a + 2 = 控制变量 var
+ * a + 3 = 用户定义的局部变量 k, v, ...
+ *
+ *TFORCALL指令（iABC模式）以s和var为参数调用迭代器函数，把C个返回值放到用户定义的局部变量里
+ *R(A+3), ... ,R(A+2+C) := R(A)(R(A+1), R(A+2));
+ */
+func tForCall(i Instruction, vm LuaVM) {
+	a, _, c := i.ABC()
+	a += 1
+
+	//把迭代器函数和两个参数推入栈顶，调用迭代器，需要C个返回值
+	_pushFuncAndArgs(a, 3, vm)
+	vm.Call(2, c)
+	//把返回值依次放进R(A+3)开始的寄存器
+	_popResults(a+3, c+1, vm)
+}
+
+/*
+ *TFORLOOP指令（iAsBx模式）判断迭代器返回的第一个值是否为nil，
+ *如果不是nil，则把它赋给控制变量，然后跳转到循环体继续循环；否则循环结束
+ *if R(A+1) ~= nil then { R(A)=R(A+1); pc += sBx }
+ */
+func tForLoop(i Instruction, vm LuaVM) {
+	a, sBx := i.AsBx()
+	a += 1
+
+	if !vm.IsNil(a + 1) {
+		vm.Copy(a+1, a)
+		vm.AddPC(sBx)
+	}
+}
@@ -73,6 +73,11 @@ func (self Instruction) CMode() byte {
 	return opcodes[self.Opcode()].argCMode
 }
 
+//指令是否会修改寄存器A（推断函数名时用来查找最后一次给某个寄存器赋值的指令）
+func (self Instruction) TestAMode() bool {
+	return opcodes[self.Opcode()].setAFlag == 1
+}
+
 func (self Instruction) Execute(vm api.LuaVM) {
 	action := opcodes[self.Opcode()].action
 	if action != nil {